@@ -3,10 +3,21 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path"
+	"runtime"
+
 	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_debug"
+	"github.com/crud-bird/bfe/bfe_server"
 	"github.com/crud-bird/bfe/bfe_util"
 	"github.com/sirupsen/logrus"
-	"path"
+)
+
+const (
+	logFileName    = "bfe.log"
+	logRotateWhen  = "D"
+	logBackupCount = 7
 )
 
 var (
@@ -16,6 +27,7 @@ var (
 	stdOut   *bool   = flag.Bool("s", false, "to show log in stdout")
 	showVer  *bool   = flag.Bool("v", false, "to show version of bfe")
 	debugLog *bool   = flag.Bool("d", false, "to show debug log")
+	testConf *bool   = flag.Bool("t", false, "to check configuration and exit")
 )
 
 var version string
@@ -24,7 +36,6 @@ func main() {
 	var (
 		err    error
 		config bfe_conf.BfeConfig
-		// logSwitch string
 	)
 
 	flag.Parse()
@@ -39,10 +50,71 @@ func main() {
 		return
 	}
 
+	if *testConf {
+		checkConf(*confRoot)
+		return
+	}
+
+	if err = initLog(*logPath, *stdOut, *debugLog); err != nil {
+		fmt.Printf("bfe: err in initLog(): %s\n", err)
+		bfe_util.AbnormalExit()
+	}
+
+	logrus.Infof("bfe[version:%s] start", version)
+
 	confPath := path.Join(*confRoot, "bfe.conf")
 	if config, err = bfe_conf.BfeConfigLoad(confPath, *confRoot); err != nil {
 		logrus.Errorf("main(): in BfeConfigLoad(): %s", err)
 		bfe_util.AbnormalExit()
 	}
 
+	runtime.GOMAXPROCS(config.Server.MaxCpus)
+	logrus.Infof("main(): set GOMAXPROCS to %d", config.Server.MaxCpus)
+
+	bfe_debug.SetDebugFlag(config.Server)
+
+	// StartUp returns only when bfe fails to start or to serve
+	if err = bfe_server.StartUp(config, version, *confRoot); err != nil {
+		logrus.Errorf("main(): bfe_server.StartUp(): %s", err)
+	}
+
+	bfe_util.AbnormalExit()
+}
+
+// checkConf checks all conf files under confRoot, prints errors found and
+// exits abnormally if there is any
+func checkConf(confRoot string) {
+	logrus.SetLevel(logrus.ErrorLevel)
+
+	errs := bfe_server.CheckConf(confRoot)
+	for _, err := range errs {
+		fmt.Printf("bfe: %s\n", err)
+	}
+
+	if len(errs) > 0 {
+		fmt.Printf("bfe: configuration check failed, %d error(s)\n", len(errs))
+		bfe_util.AbnormalExit()
+	}
+
+	fmt.Printf("bfe: configuration check ok\n")
+}
+
+func initLog(logDir string, toStdout bool, debug bool) error {
+	logrus.SetLevel(logrus.InfoLevel)
+	if debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	if toStdout {
+		logrus.SetOutput(os.Stdout)
+		return nil
+	}
+
+	writer, err := bfe_util.NewTimeRotateWriter(logDir, logFileName, logRotateWhen, logBackupCount)
+	if err != nil {
+		return err
+	}
+	logrus.SetOutput(writer)
+
+	return nil
 }
@@ -3,9 +3,25 @@ package backend
 import (
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ewmaDecay is decay time of latency ewma, samples older than it weigh
+// less than 1/e
+const ewmaDecay = 10 * time.Second
+
+// healthVersion increases whenever avail or ejected of any backend changes
+var healthVersion uint64
+
+// HealthVersion returns current health version. Callers may cache results
+// derived from backend status until it changes.
+func HealthVersion() uint64 {
+	return atomic.LoadUint64(&healthVersion)
+}
+
 type BfeBackend struct {
 	Name       string
 	Addr       string
@@ -19,13 +35,27 @@ type BfeBackend struct {
 	failNum int
 	succNum int
 
+	latency     float64 // ewma of response latency, in ns
+	latencyTime time.Time
+
+	recoverTime time.Time // last time backend became avail, for slow start
+	statusTime  time.Time // last time avail or ejected changed
+
+	outlier outlierStat
+
+	// result of last health check
+	checkTime    time.Time
+	checkLatency time.Duration
+	checkErr     string
+
 	closeChan chan bool
 }
 
 func NewBfeBackend() *BfeBackend {
 	return &BfeBackend{
-		avail:     true,
-		closeChan: make(chan bool),
+		avail:      true,
+		statusTime: time.Now(),
+		closeChan:  make(chan bool),
 	}
 }
 func (back *BfeBackend) Init(subCluster string, conf *cluster_table_conf.BackendConf) {
@@ -45,6 +75,15 @@ func (back *BfeBackend) GetAddrInfo() string {
 }
 
 func (back *BfeBackend) Avail() bool {
+	back.RLock()
+	avail := back.avail && !back.outlier.ejected
+	back.RUnlock()
+
+	return avail
+}
+
+// isAvail checks status set by health check, ignoring outlier ejection
+func (back *BfeBackend) isAvail() bool {
 	back.RLock()
 	avail := back.avail
 	back.RUnlock()
@@ -59,10 +98,51 @@ func (back *BfeBackend) SetAvail(avail bool) {
 }
 
 func (back *BfeBackend) setAvail(avail bool) {
+	if avail != back.avail {
+		atomic.AddUint64(&healthVersion, 1)
+		back.statusTime = time.Now()
+		if avail {
+			back.recoverTime = back.statusTime
+		}
+	}
 	back.avail = avail
-	if back.avail {
-		back.connNum = 0
+}
+
+// RecoverTime returns last time backend became avail, zero if backend
+// is avail since initialized
+func (back *BfeBackend) RecoverTime() time.Time {
+	back.RLock()
+	t := back.recoverTime
+	back.RUnlock()
+
+	return t
+}
+
+func (back *BfeBackend) SetRecoverTime(t time.Time) {
+	back.Lock()
+	back.recoverTime = t
+	back.Unlock()
+}
+
+// SetCheckResult records result of health check
+func (back *BfeBackend) SetCheckResult(latency time.Duration, err error) {
+	back.Lock()
+	back.checkTime = time.Now()
+	back.checkLatency = latency
+	back.checkErr = ""
+	if err != nil {
+		back.checkErr = err.Error()
 	}
+	back.Unlock()
+}
+
+// CheckResult returns time, latency and error of last health check
+func (back *BfeBackend) CheckResult() (time.Time, time.Duration, string) {
+	back.RLock()
+	t, latency, err := back.checkTime, back.checkLatency, back.checkErr
+	back.RUnlock()
+
+	return t, latency, err
 }
 
 func (back *BfeBackend) ConnNum() int {
@@ -85,6 +165,30 @@ func (back *BfeBackend) DecConnNum() {
 	back.Unlock()
 }
 
+// AddLatency updates ewma of response latency with a new sample
+func (back *BfeBackend) AddLatency(latency time.Duration) {
+	now := time.Now()
+
+	back.Lock()
+	if back.latencyTime.IsZero() {
+		back.latency = float64(latency)
+	} else {
+		w := math.Exp(-float64(now.Sub(back.latencyTime)) / float64(ewmaDecay))
+		back.latency = back.latency*w + float64(latency)*(1-w)
+	}
+	back.latencyTime = now
+	back.Unlock()
+}
+
+// Latency returns ewma of response latency, 0 if no sample
+func (back *BfeBackend) Latency() time.Duration {
+	back.RLock()
+	latency := back.latency
+	back.RUnlock()
+
+	return time.Duration(latency)
+}
+
 func (back *BfeBackend) AddFailNum() {
 	back.Lock()
 	back.failNum++
@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_debug"
+	"github.com/sirupsen/logrus"
+)
+
+// checkWorkerNum is num of goroutines running continuous health checks
+const checkWorkerNum = 32
+
+type checkTask struct {
+	backend *BfeBackend
+	cluster string
+	next    time.Time
+	index   int // index in heap
+}
+
+type checkTaskHeap []*checkTask
+
+func (h checkTaskHeap) Len() int           { return len(h) }
+func (h checkTaskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+
+func (h checkTaskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *checkTaskHeap) Push(x interface{}) {
+	task := x.(*checkTask)
+	task.index = len(*h)
+	*h = append(*h, task)
+}
+
+func (h *checkTaskHeap) Pop() interface{} {
+	old := *h
+	task := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return task
+}
+
+// checkScheduler runs continuous health checks of all backends with a
+// timer goroutine and a fixed num of workers
+type checkScheduler struct {
+	lock       sync.Mutex
+	tasks      checkTaskHeap
+	registered map[*BfeBackend]bool
+
+	wakeup chan bool
+	work   chan *checkTask
+	once   sync.Once
+}
+
+var scheduler = &checkScheduler{
+	registered: make(map[*BfeBackend]bool),
+	wakeup:     make(chan bool, 1),
+	work:       make(chan *checkTask, checkWorkerNum),
+}
+
+// ScheduleCheck starts continuous health check of backend, if it is
+// enabled in check conf of cluster. It is a no-op if backend is checked.
+func ScheduleCheck(backend *BfeBackend, cluster string) {
+	checkConf := getCheckConf(cluster)
+	if checkConf == nil || !*checkConf.Continuous {
+		return
+	}
+
+	scheduler.once.Do(scheduler.start)
+	scheduler.add(backend, cluster, checkInterval(checkConf))
+}
+
+func (s *checkScheduler) start() {
+	go s.loop()
+	for i := 0; i < checkWorkerNum; i++ {
+		go s.worker()
+	}
+}
+
+func (s *checkScheduler) add(backend *BfeBackend, cluster string, interval time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.registered[backend] {
+		return
+	}
+	s.registered[backend] = true
+
+	// spread first checks of backends in interval
+	next := time.Now().Add(time.Duration(rand.Int63n(int64(interval) + 1)))
+	s.pushLocked(&checkTask{backend: backend, cluster: cluster, next: next})
+}
+
+func (s *checkScheduler) pushLocked(task *checkTask) {
+	heap.Push(&s.tasks, task)
+
+	select {
+	case s.wakeup <- true:
+	default:
+	}
+}
+
+func (s *checkScheduler) remove(task *checkTask) {
+	s.lock.Lock()
+	delete(s.registered, task.backend)
+	s.lock.Unlock()
+}
+
+func (s *checkScheduler) reschedule(task *checkTask, next time.Time) {
+	s.lock.Lock()
+	task.next = next
+	s.pushLocked(task)
+	s.lock.Unlock()
+}
+
+// loop sends tasks to workers when they are due
+func (s *checkScheduler) loop() {
+	for {
+		s.lock.Lock()
+		wait := time.Hour
+		var task *checkTask
+		if len(s.tasks) > 0 {
+			if wait = time.Until(s.tasks[0].next); wait <= 0 {
+				task = heap.Pop(&s.tasks).(*checkTask)
+			}
+		}
+		s.lock.Unlock()
+
+		if task != nil {
+			s.work <- task
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wakeup:
+		}
+		timer.Stop()
+	}
+}
+
+func (s *checkScheduler) worker() {
+	for task := range s.work {
+		select {
+		case <-task.backend.CloseChan():
+			// backend is released
+			s.remove(task)
+			continue
+		default:
+		}
+
+		checkConf := getCheckConf(task.cluster)
+		if checkConf == nil || !*checkConf.Continuous {
+			s.remove(task)
+			// backend which is down is checked until it recovers, as
+			// in non-continuous mode
+			if !task.backend.isAvail() {
+				go check(task.backend, task.cluster)
+			}
+			continue
+		}
+
+		continuousCheck(task.backend, checkConf)
+		s.reschedule(task, time.Now().Add(checkInterval(checkConf)))
+	}
+}
+
+// checkInterval returns CheckInterval with random jitter
+func checkInterval(checkConf *cluster_conf.BackendCheck) time.Duration {
+	interval := time.Duration(*checkConf.CheckInterval) * time.Millisecond
+	jitter := int64(interval) * int64(*checkConf.CheckJitter) / 100
+	if jitter > 0 {
+		interval += time.Duration(rand.Int63n(2*jitter+1) - jitter)
+	}
+
+	return interval
+}
+
+// continuousCheck checks backend once, and marks it down or up by
+// num of consecutive failures or successes
+func continuousCheck(backend *BfeBackend, checkConf *cluster_conf.BackendCheck) {
+	start := time.Now()
+	ok, err := CheckConnect(backend, checkConf)
+	backend.SetCheckResult(time.Since(start), err)
+
+	if !ok {
+		backend.ResetSuccNum()
+		backend.AddFailNum()
+		if backend.UpdateStatus(*checkConf.FailNum) {
+			logrus.Infof("backend %s marked down by health check: %s", backend.Name, err)
+		}
+		return
+	}
+
+	if backend.isAvail() {
+		backend.ResetFailNum()
+		return
+	}
+
+	backend.AddSuccNum()
+	if !backend.CheckAvail(*checkConf.SuccNum) {
+		if bfe_debug.DebugHealthCheck {
+			logrus.Debugf("backend %s still not avail(check success, waiting for more checkes)", backend.Name)
+		}
+		return
+	}
+
+	logrus.Infof("backend %s back to Normal", backend.Name)
+	backend.ResetFailNum()
+	backend.SetAvail(true)
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+func newHTTPCheckConf(t *testing.T, continuous bool) *cluster_conf.BackendCheck {
+	schem, uri, statusCode := "http", "/", 200
+	failNum, succNum, interval, timeout := 1, 1, 10, 1000
+	conf := &cluster_conf.BackendCheck{
+		Schem:         &schem,
+		Uri:           &uri,
+		StatusCode:    &statusCode,
+		FailNum:       &failNum,
+		SuccNum:       &succNum,
+		CheckInterval: &interval,
+		CheckTimeout:  &timeout,
+		Continuous:    &continuous,
+	}
+	if err := cluster_conf.BackendCheckCheck(conf); err != nil {
+		t.Fatalf("BackendCheckCheck(): %s", err)
+	}
+
+	return conf
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func isScheduled(backend *BfeBackend) bool {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	return scheduler.registered[backend]
+}
+
+func TestCheckModeSwitch(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	var checkConf atomic.Value
+	checkConf.Store(newHTTPCheckConf(t, true))
+	SetCheckConfFetcher(func(cluster string) *cluster_conf.BackendCheck {
+		return checkConf.Load().(*cluster_conf.BackendCheck)
+	})
+	defer SetCheckConfFetcher(nil)
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	name := "b1"
+	portNum, _ := strconv.Atoi(port)
+	backend := NewBfeBackend()
+	backend.Init("sub1", &cluster_table_conf.BackendConf{Name: &name, Addr: &host, Port: &portNum})
+	defer backend.Release()
+
+	// marked down by continuous check
+	ScheduleCheck(backend, "c1")
+	waitFor(t, "backend marked down", func() bool { return !backend.isAvail() })
+
+	// continuous check turned off, backend down is still checked
+	checkConf.Store(newHTTPCheckConf(t, false))
+	waitFor(t, "continuous check stopped", func() bool { return !isScheduled(backend) })
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(t, "backend recovered", backend.isAvail)
+
+	// marked down by passive check, and checked until continuous check
+	// turned on again
+	atomic.StoreInt32(&healthy, 0)
+	backend.SetAvail(false)
+	go check(backend, "c1")
+	checkConf.Store(newHTTPCheckConf(t, true))
+	waitFor(t, "continuous check started", func() bool { return isScheduled(backend) })
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(t, "backend recovered", backend.isAvail)
+}
@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+)
+
+const (
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+	// ServingStatus in grpc.health.v1.HealthCheckResponse
+	grpcStatusUnknown    = 0
+	grpcStatusServing    = 1
+	grpcStatusNotServing = 2
+
+	// max size of HealthCheckResponse message
+	grpcMaxRespSize = 1024
+)
+
+// grpcHealthCheckRequest encodes HealthCheckRequest{service} in grpc
+// length-prefixed message
+func grpcHealthCheckRequest(service string) []byte {
+	var msg []byte
+	if len(service) > 0 {
+		// field 1, wire type 2 (length-delimited)
+		msg = append(msg, 0x0a)
+		msg = appendVarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+
+	return append(frame, msg...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	return append(b, byte(v))
+}
+
+func readVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("invalid varint")
+}
+
+// parseGrpcHealthCheckResponse decodes status in length-prefixed
+// HealthCheckResponse message
+func parseGrpcHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, fmt.Errorf("grpc response too short")
+	}
+	if body[0] != 0 {
+		return 0, fmt.Errorf("compressed grpc response not supported")
+	}
+
+	size := binary.BigEndian.Uint32(body[1:5])
+	msg := body[5:]
+	if uint32(len(msg)) != size {
+		return 0, fmt.Errorf("invalid grpc message length %d", size)
+	}
+
+	status := uint64(grpcStatusUnknown)
+	for len(msg) > 0 {
+		key, n, err := readVarint(msg)
+		if err != nil {
+			return 0, err
+		}
+		msg = msg[n:]
+
+		switch key & 0x7 {
+		case 0: // varint
+			v, n, err := readVarint(msg)
+			if err != nil {
+				return 0, err
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 2: // length-delimited, unknown field
+			l, n, err := readVarint(msg)
+			if err != nil || uint64(len(msg)-n) < l {
+				return 0, fmt.Errorf("invalid grpc message")
+			}
+			msg = msg[n+int(l):]
+		default:
+			return 0, fmt.Errorf("invalid grpc message")
+		}
+	}
+
+	return status, nil
+}
+
+// grpcTransport returns http2 transport, over tls if GrpcTLS is set, or h2c
+func grpcTransport(checkConf *cluster_conf.BackendCheck, host string) *http.Transport {
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		Protocols:         new(http.Protocols),
+	}
+
+	if *checkConf.GrpcTLS {
+		transport.Protocols.SetHTTP2(true)
+		transport.TLSClientConfig = &tls.Config{
+			ServerName:         tlsServerName(checkConf, host),
+			InsecureSkipVerify: *checkConf.InsecureSkipVerify,
+		}
+	} else {
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	return transport
+}
+
+// checkGrpcConnect calls grpc.health.v1.Health/Check of backend
+func checkGrpcConnect(backend *BfeBackend, checkConf *cluster_conf.BackendCheck) (bool, error) {
+	scheme := "http"
+	if *checkConf.GrpcTLS {
+		scheme = "https"
+	}
+
+	addrInfo := getHealthCheckAddrInfo(backend, checkConf)
+	urlStr := fmt.Sprintf("%s://%s%s", scheme, addrInfo, grpcHealthCheckPath)
+	req, err := http.NewRequest("POST", urlStr, bytes.NewReader(grpcHealthCheckRequest(*checkConf.GrpcService)))
+	if err != nil {
+		return false, err
+	}
+
+	if checkConf.Host != nil && *checkConf.Host != "" {
+		req.Host = *checkConf.Host
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	client := &http.Client{Transport: grpcTransport(checkConf, req.Host)}
+	if checkConf.CheckTimeout != nil {
+		client.Timeout = time.Duration(*checkConf.CheckTimeout) * time.Millisecond
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("grpc response status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, grpcMaxRespSize+1))
+	if err != nil {
+		return false, err
+	}
+	if len(body) > grpcMaxRespSize {
+		return false, fmt.Errorf("grpc response larger than %d bytes", grpcMaxRespSize)
+	}
+
+	// grpc-status is in trailers, or in headers for trailers-only response
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+	}
+	if grpcStatus != "0" {
+		grpcMessage := resp.Trailer.Get("Grpc-Message")
+		if grpcMessage == "" {
+			grpcMessage = resp.Header.Get("Grpc-Message")
+		}
+		return false, fmt.Errorf("grpc status %s: %s", grpcStatus, grpcMessage)
+	}
+
+	status, err := parseGrpcHealthCheckResponse(body)
+	if err != nil {
+		return false, err
+	}
+
+	switch status {
+	case grpcStatusServing:
+		return true, nil
+	case grpcStatusNotServing:
+		return false, fmt.Errorf("grpc health status NOT_SERVING")
+	}
+
+	return false, fmt.Errorf("grpc health status %d", status)
+}
@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+// grpcFrame encodes msg in grpc length-prefixed message
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+
+	return append(frame, msg...)
+}
+
+// grpcHealthServer implements grpc.health.v1.Health/Check, with status of
+// each service. Unknown service is replied with a trailers-only response
+// of status NOT_FOUND, as grpc-go does.
+type grpcHealthServer struct {
+	t        *testing.T
+	services map[string]uint64
+}
+
+func (s *grpcHealthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != "POST" || r.URL.Path != grpcHealthCheckPath ||
+		r.Header.Get("Content-Type") != "application/grpc" {
+		s.t.Errorf("unexpected grpc request %s %s %s", r.Proto, r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	service, err := parseHealthCheckRequest(body)
+	if err != nil {
+		s.t.Errorf("%s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	status, ok := s.services[service]
+	if !ok {
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "unknown service")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	var msg []byte
+	if status != grpcStatusUnknown {
+		msg = appendVarint([]byte{0x08}, status)
+	}
+	w.Write(grpcFrame(msg))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// parseHealthCheckRequest decodes service of HealthCheckRequest
+func parseHealthCheckRequest(body []byte) (string, error) {
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return "", errInvalidTestMessage
+	}
+
+	msg := body[5:]
+	if len(msg) == 0 {
+		return "", nil
+	}
+	if msg[0] != 0x0a {
+		return "", errInvalidTestMessage
+	}
+	l, n, err := readVarint(msg[1:])
+	if err != nil || uint64(len(msg)-1-n) != l {
+		return "", errInvalidTestMessage
+	}
+
+	return string(msg[1+n:]), nil
+}
+
+var errInvalidTestMessage = errors.New("invalid HealthCheckRequest")
+
+func newGrpcHealthServer(t *testing.T, overTLS bool) *httptest.Server {
+	srv := httptest.NewUnstartedServer(&grpcHealthServer{
+		t: t,
+		services: map[string]uint64{
+			"":        grpcStatusServing,
+			"serving": grpcStatusServing,
+			"down":    grpcStatusNotServing,
+			"unknown": grpcStatusUnknown,
+		},
+	})
+
+	if overTLS {
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+	} else {
+		srv.Config.Protocols = new(http.Protocols)
+		srv.Config.Protocols.SetUnencryptedHTTP2(true)
+		srv.Start()
+	}
+
+	return srv
+}
+
+func newGrpcCheckTarget(t *testing.T, srv *httptest.Server, service string, overTLS bool) (*BfeBackend, *cluster_conf.BackendCheck) {
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	name := "b1"
+	portNum, _ := strconv.Atoi(port)
+	backend := NewBfeBackend()
+	backend.Init("sub1", &cluster_table_conf.BackendConf{Name: &name, Addr: &host, Port: &portNum})
+
+	schem, timeout, skipVerify := "grpc", 1000, true
+	conf := &cluster_conf.BackendCheck{
+		Schem:              &schem,
+		CheckTimeout:       &timeout,
+		GrpcService:        &service,
+		GrpcTLS:            &overTLS,
+		InsecureSkipVerify: &skipVerify,
+	}
+	if err := cluster_conf.BackendCheckCheck(conf); err != nil {
+		t.Fatalf("BackendCheckCheck(): %s", err)
+	}
+
+	return backend, conf
+}
+
+func testGrpcCheck(t *testing.T, overTLS bool) {
+	srv := newGrpcHealthServer(t, overTLS)
+	defer srv.Close()
+
+	cases := []struct {
+		service string
+		ok      bool
+		errMsg  string
+	}{
+		{"", true, ""},
+		{"serving", true, ""},
+		{"down", false, "NOT_SERVING"},
+		{"unknown", false, "grpc health status 0"},
+		{"nosuchservice", false, "grpc status 5: unknown service"},
+	}
+
+	for _, c := range cases {
+		backend, conf := newGrpcCheckTarget(t, srv, c.service, overTLS)
+		ok, err := CheckConnect(backend, conf)
+		if ok != c.ok {
+			t.Errorf("service %q: got %v (%v), expect %v", c.service, ok, err, c.ok)
+			continue
+		}
+		if c.ok && err != nil {
+			t.Errorf("service %q: unexpected error %s", c.service, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), c.errMsg)) {
+			t.Errorf("service %q: got error %v, expect %q", c.service, err, c.errMsg)
+		}
+	}
+}
+
+func TestGrpcCheckH2c(t *testing.T) {
+	testGrpcCheck(t, false)
+}
+
+func TestGrpcCheckTLS(t *testing.T) {
+	testGrpcCheck(t, true)
+}
+
+func TestGrpcCheckFail(t *testing.T) {
+	// grpc over tls to h2c server
+	srv := newGrpcHealthServer(t, false)
+	backend, conf := newGrpcCheckTarget(t, srv, "", true)
+	if ok, err := CheckConnect(backend, conf); ok || err == nil {
+		t.Errorf("check over tls to h2c server should fail")
+	}
+
+	// server closed
+	srv.Close()
+	backend, conf = newGrpcCheckTarget(t, srv, "", false)
+	if ok, err := CheckConnect(backend, conf); ok || err == nil {
+		t.Errorf("check of closed server should fail")
+	}
+}
+
+func TestParseGrpcHealthCheckResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   []byte
+		status uint64
+		ok     bool
+	}{
+		{"serving", grpcFrame([]byte{0x08, 0x01}), grpcStatusServing, true},
+		{"not serving", grpcFrame([]byte{0x08, 0x02}), grpcStatusNotServing, true},
+		{"empty message", grpcFrame(nil), grpcStatusUnknown, true},
+		{"unknown fields", grpcFrame([]byte{0x12, 0x02, 'a', 'b', 0x08, 0x01, 0x18, 0x07}), grpcStatusServing, true},
+		{"multi-byte varint", grpcFrame([]byte{0x08, 0x81, 0x01}), 129, true},
+		{"too short", []byte{0, 0, 0}, 0, false},
+		{"compressed", append([]byte{1}, grpcFrame([]byte{0x08, 0x01})[1:]...), 0, false},
+		{"length mismatch", append(grpcFrame([]byte{0x08, 0x01}), 0), 0, false},
+		{"truncated varint", grpcFrame([]byte{0x08, 0x81}), 0, false},
+		{"truncated field", grpcFrame([]byte{0x12, 0x05, 'a'}), 0, false},
+		{"unsupported wire type", grpcFrame([]byte{0x0d, 0, 0, 0, 0}), 0, false},
+	}
+
+	for _, c := range cases {
+		status, err := parseGrpcHealthCheckResponse(c.body)
+		if c.ok && (err != nil || status != c.status) {
+			t.Errorf("%s: got %d, %v, expect %d", c.name, status, err, c.status)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expect error", c.name)
+		}
+	}
+}
+
+func TestGrpcHealthCheckRequest(t *testing.T) {
+	for _, service := range []string{"", "svc", strings.Repeat("s", 200)} {
+		got, err := parseHealthCheckRequest(grpcHealthCheckRequest(service))
+		if err != nil || got != service {
+			t.Errorf("service %q: got %q, %v", service, got, err)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package backend
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
 	"github.com/crud-bird/bfe/bfe_debug"
 	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
@@ -18,7 +21,10 @@ func UpdateStatus(backend *BfeBackend, cluster string) bool {
 	}
 
 	if backend.UpdateStatus(*checkConf.FailNum) {
-		go check(backend, cluster)
+		// backend is checked by scheduler in continuous mode
+		if !*checkConf.Continuous {
+			go check(backend, cluster)
+		}
 		return true
 	}
 
@@ -43,9 +49,18 @@ loop:
 			time.Sleep(time.Second)
 			continue
 		}
+		if *checkConf.Continuous {
+			// switched to continuous mode, leave backend to scheduler
+			logrus.Infof("stop health check for %s, checked continuously", backend.Name)
+			ScheduleCheck(backend, cluster)
+			break loop
+		}
 		checkInterval := time.Duration(*checkConf.CheckInterval) * time.Millisecond
 
-		if ok, err := CheckConnect(backend, checkConf); !ok {
+		start := time.Now()
+		ok, err := CheckConnect(backend, checkConf)
+		backend.SetCheckResult(time.Since(start), err)
+		if !ok {
 			backend.ResetSuccNum()
 			if bfe_debug.DebugHealthCheck {
 				logrus.Debugf("backend %s still not avail (check failure: %s)", backend.Name, err)
@@ -77,7 +92,7 @@ func getHealthCheckAddrInfo(backend *BfeBackend, checkConf *cluster_conf.Backend
 		}
 
 	}
-	return backend.GetAddr()
+	return backend.GetAddrInfo()
 }
 
 func checkTCPConnect(backend *BfeBackend, checkConf *cluster_conf.BackendCheck) (bool, error) {
@@ -99,55 +114,110 @@ func checkTCPConnect(backend *BfeBackend, checkConf *cluster_conf.BackendCheck)
 	return true, nil
 }
 
-func doHTTPHealthCheck(req *http.Request, timeout time.Duration) (int, error) {
+func doHTTPHealthCheck(req *http.Request, timeout time.Duration, transport http.RoundTripper, maxRespSize int) (int, []byte, error) {
 	client := &http.Client{
 		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
 		Timeout:       timeout,
+		Transport:     transport,
 	}
 
 	resp, err := client.Do((req))
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 
 	defer resp.Body.Close()
 
-	return resp.StatusCode, nil
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(maxRespSize)+1))
+	if err != nil {
+		return -1, nil, err
+	}
+	if len(body) > maxRespSize {
+		return -1, nil, fmt.Errorf("response body larger than %d bytes", maxRespSize)
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// tlsServerName returns SNI for tls check, host is used if SNI not set
+func tlsServerName(checkConf *cluster_conf.BackendCheck, host string) string {
+	if *checkConf.SNI != "" {
+		return *checkConf.SNI
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+
+	return host
+}
+
+// healthCheckTransport returns transport for https check, nil for http check
+func healthCheckTransport(checkConf *cluster_conf.BackendCheck, host string) http.RoundTripper {
+	if *checkConf.Schem != "https" {
+		return nil
+	}
+
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			ServerName:         tlsServerName(checkConf, host),
+			InsecureSkipVerify: *checkConf.InsecureSkipVerify,
+		},
+		DisableKeepAlives: true,
+	}
 }
 
 func checkHTTPConnect(backend *BfeBackend, checkConf *cluster_conf.BackendCheck) (bool, error) {
 	addrInfo := getHealthCheckAddrInfo(backend, checkConf)
-	urlStr := fmt.Sprintf("http://%s%s", addrInfo, *checkConf.Uri)
-	req, err := http.NewRequest("GET", urlStr, nil)
+	urlStr := fmt.Sprintf("%s://%s%s", *checkConf.Schem, addrInfo, *checkConf.Uri)
+	req, err := http.NewRequest(*checkConf.Method, urlStr, nil)
 	if err != nil {
 		return false, err
 	}
 
-	if checkConf.Host != nil {
+	if checkConf.Host != nil && *checkConf.Host != "" {
 		req.Host = *checkConf.Host
 	}
 
 	req.Header.Set("Accept", "*/*")
+	for key, value := range *checkConf.Headers {
+		req.Header.Set(key, value)
+	}
 
 	checkTimeout := time.Duration(0)
 	if checkConf.CheckTimeout != nil {
 		checkTimeout = time.Duration(*checkConf.CheckTimeout) * time.Millisecond
 	}
 
-	statusCode, err := doHTTPHealthCheck(req, checkTimeout)
+	transport := healthCheckTransport(checkConf, req.Host)
+	statusCode, body, err := doHTTPHealthCheck(req, checkTimeout, transport, *checkConf.MaxRespSize)
 	if err != nil {
 		return false, err
 	}
 
-	return cluster_conf.MatchStatusCode(statusCode, *checkConf.StatusCode)
+	if ok, err := cluster_conf.MatchStatusCode(statusCode, *checkConf.StatusCode); !ok {
+		return false, err
+	}
+
+	if len(*checkConf.ExpectBody) > 0 && !strings.Contains(string(body), *checkConf.ExpectBody) {
+		return false, fmt.Errorf("response body not contains %q", *checkConf.ExpectBody)
+	}
+
+	if regex := checkConf.BodyRegex(); regex != nil && !regex.Match(body) {
+		return false, fmt.Errorf("response body not matches %q", *checkConf.ExpectBodyRegex)
+	}
+
+	return true, nil
 }
 
 func CheckConnect(backend *BfeBackend, checkConf *cluster_conf.BackendCheck) (bool, error) {
 	switch *checkConf.Schem {
-	case "http":
+	case "http", "https":
 		return checkHTTPConnect(backend, checkConf)
 	case "tcp":
 		return checkTCPConnect(backend, checkConf)
+	case "grpc":
+		return checkGrpcConnect(backend, checkConf)
 	default:
 		return checkHTTPConnect(backend, checkConf)
 	}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+// checkRecorder records server name, method, host and headers of last
+// health check request
+type checkRecorder struct {
+	sync.Mutex
+	serverName string
+	method     string
+	host       string
+	header     http.Header
+}
+
+func (rec *checkRecorder) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		rec.Lock()
+		if r.TLS != nil {
+			rec.serverName = r.TLS.ServerName
+		}
+		rec.method, rec.host, rec.header = r.Method, r.Host, r.Header
+		rec.Unlock()
+
+		w.Write([]byte(`{"status": "ok", "version": 12}`))
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status": "down"}`))
+	})
+
+	return mux
+}
+
+// newHTTPCheckTarget returns backend of srv, and check conf in json
+func newHTTPCheckTarget(t *testing.T, srv *httptest.Server, conf string) (*BfeBackend, *cluster_conf.BackendCheck) {
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	name := "b1"
+	portNum, _ := strconv.Atoi(port)
+	backend := NewBfeBackend()
+	backend.Init("sub1", &cluster_table_conf.BackendConf{Name: &name, Addr: &host, Port: &portNum})
+
+	var checkConf cluster_conf.BackendCheck
+	if err := json.Unmarshal([]byte(conf), &checkConf); err != nil {
+		t.Fatalf("decode BackendCheck: %s", err)
+	}
+	if err := cluster_conf.BackendCheckCheck(&checkConf); err != nil {
+		t.Fatalf("BackendCheckCheck(): %s", err)
+	}
+
+	return backend, &checkConf
+}
+
+func TestHTTPSCheck(t *testing.T) {
+	rec := new(checkRecorder)
+	srv := httptest.NewTLSServer(rec.handler())
+	defer srv.Close()
+
+	cases := []struct {
+		conf   string
+		ok     bool
+		errMsg string
+	}{
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true}`, true, ""},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "ExpectBody": "\"ok\""}`, true, ""},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "ExpectBody": "ready"}`, false, `response body not contains "ready"`},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "ExpectBodyRegex": "\"version\": [0-9]+"}`, true, ""},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "ExpectBodyRegex": "^ok$"}`, false, `response body not matches "^ok$"`},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "MaxRespSize": 8}`, false, "response body larger than 8 bytes"},
+		{`{"Schem": "https", "Uri": "/down", "InsecureSkipVerify": true, "StatusCode": 200, "ExpectBody": "down"}`, false, "response statusCode[503]"},
+		{`{"Schem": "https", "Uri": "/down", "InsecureSkipVerify": true, "StatusCode": 503, "ExpectBody": "down"}`, true, ""},
+
+		// certificate of test server is not trusted
+		{`{"Schem": "https", "Uri": "/health"}`, false, "certificate"},
+		// plain http to tls server
+		{`{"Schem": "http", "Uri": "/health", "StatusCode": 200}`, false, "response statusCode[400]"},
+	}
+
+	for _, c := range cases {
+		backend, conf := newHTTPCheckTarget(t, srv, c.conf)
+		ok, err := CheckConnect(backend, conf)
+		if ok != c.ok {
+			t.Errorf("%s: got %v (%v), expect %v", c.conf, ok, err, c.ok)
+			continue
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), c.errMsg)) {
+			t.Errorf("%s: got error %v, expect %q", c.conf, err, c.errMsg)
+		}
+	}
+}
+
+func TestHTTPSCheckRequest(t *testing.T) {
+	rec := new(checkRecorder)
+	srv := httptest.NewTLSServer(rec.handler())
+	defer srv.Close()
+
+	cases := []struct {
+		conf       string
+		serverName string
+		host       string
+	}{
+		// server name is host of request if SNI not set
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "Host": "example.org"}`, "example.org", "example.org"},
+		{`{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true, "Host": "example.org", "SNI": "sni.example.org"}`, "sni.example.org", "example.org"},
+	}
+
+	for _, c := range cases {
+		backend, conf := newHTTPCheckTarget(t, srv, c.conf)
+		if ok, err := CheckConnect(backend, conf); !ok {
+			t.Errorf("%s: check failed: %v", c.conf, err)
+			continue
+		}
+
+		rec.Lock()
+		if rec.serverName != c.serverName || rec.host != c.host {
+			t.Errorf("%s: got server name %q and host %q, expect %q and %q",
+				c.conf, rec.serverName, rec.host, c.serverName, c.host)
+		}
+		rec.Unlock()
+	}
+
+	// method and headers
+	backend, conf := newHTTPCheckTarget(t, srv, `{"Schem": "https", "Uri": "/health", "InsecureSkipVerify": true,
+		"Method": "HEAD", "Headers": {"X-Check": "bfe", "Accept": "application/json"}}`)
+	if ok, err := CheckConnect(backend, conf); !ok {
+		t.Fatalf("check failed: %v", err)
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.method != "HEAD" || rec.header.Get("X-Check") != "bfe" || rec.header.Get("Accept") != "application/json" {
+		t.Errorf("got %s with headers %v, expect HEAD with X-Check and Accept", rec.method, rec.header)
+	}
+}
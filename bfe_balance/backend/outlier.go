@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// outlierStat is result of live traffic to backend, for outlier detection
+type outlierStat struct {
+	consecutive5xx    int
+	consecutiveGwFail int
+
+	reqNum  int // num of requests in current detection interval
+	succNum int // num of non-5xx responses in current detection interval
+
+	ejected   bool
+	ejectTime time.Time
+	ejectNum  int // times ejected recently, for exponential ejection time
+}
+
+// isGatewayFailure checks whether status is returned by gateway in
+// front of backend
+func isGatewayFailure(status int) bool {
+	return status == 502 || status == 503 || status == 504
+}
+
+// RecordResult records result of request to backend, status is 0 if no
+// response is got. Num of consecutive 5xx and gateway failures are returned.
+func (back *BfeBackend) RecordResult(status int) (int, int) {
+	back.Lock()
+	defer back.Unlock()
+
+	stat := &back.outlier
+	stat.reqNum++
+
+	switch {
+	case status == 0 || isGatewayFailure(status):
+		stat.consecutive5xx++
+		stat.consecutiveGwFail++
+	case status >= 500:
+		stat.consecutive5xx++
+		stat.consecutiveGwFail = 0
+	default:
+		stat.succNum++
+		stat.consecutive5xx = 0
+		stat.consecutiveGwFail = 0
+	}
+
+	return stat.consecutive5xx, stat.consecutiveGwFail
+}
+
+// ResetResult clears num of requests in detection interval. The numbers
+// before reset are returned.
+func (back *BfeBackend) ResetResult() (int, int) {
+	back.Lock()
+	reqNum, succNum := back.outlier.reqNum, back.outlier.succNum
+	back.outlier.reqNum = 0
+	back.outlier.succNum = 0
+	back.Unlock()
+
+	return reqNum, succNum
+}
+
+func (back *BfeBackend) Ejected() bool {
+	back.RLock()
+	ejected := back.outlier.ejected
+	back.RUnlock()
+
+	return ejected
+}
+
+// Eject ejects backend and returns times ejected recently, including this one
+func (back *BfeBackend) Eject(now time.Time) int {
+	back.Lock()
+	defer back.Unlock()
+
+	stat := &back.outlier
+	stat.ejected = true
+	stat.ejectTime = now
+	atomic.AddUint64(&healthVersion, 1)
+	back.statusTime = now
+	stat.ejectNum++
+	stat.consecutive5xx = 0
+	stat.consecutiveGwFail = 0
+
+	return stat.ejectNum
+}
+
+// EjectState returns time and times of last ejection
+func (back *BfeBackend) EjectState() (time.Time, int) {
+	back.RLock()
+	ejectTime, ejectNum := back.outlier.ejectTime, back.outlier.ejectNum
+	back.RUnlock()
+
+	return ejectTime, ejectNum
+}
+
+// Uneject brings ejected backend back, with weight ramping up in slow start
+func (back *BfeBackend) Uneject(now time.Time) {
+	back.Lock()
+	back.outlier.ejected = false
+	atomic.AddUint64(&healthVersion, 1)
+	back.recoverTime = now
+	back.statusTime = now
+	back.Unlock()
+}
+
+// DecEjectNum decreases times ejected recently, which is called when
+// backend keeps healthy in a detection interval
+func (back *BfeBackend) DecEjectNum() {
+	back.Lock()
+	if back.outlier.ejectNum > 0 {
+		back.outlier.ejectNum--
+	}
+	back.Unlock()
+}
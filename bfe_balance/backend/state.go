@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"time"
+)
+
+// BackendState is status of backend, for web monitor
+type BackendState struct {
+	Name    string
+	Addr    string
+	Port    int
+	Avail   bool // avail by health check and not ejected
+	Ejected bool // ejected by outlier detection
+	FailNum int
+	SuccNum int
+	ConnNum int
+
+	LastCheckTime    string // empty if never checked
+	LastCheckLatency int64  // ms
+	LastCheckError   string
+
+	StatusDuration int64 // seconds since last change of Avail
+}
+
+func (back *BfeBackend) State() BackendState {
+	back.RLock()
+	defer back.RUnlock()
+
+	state := BackendState{
+		Name:             back.Name,
+		Addr:             back.Addr,
+		Port:             back.Port,
+		Avail:            back.avail && !back.outlier.ejected,
+		Ejected:          back.outlier.ejected,
+		FailNum:          back.failNum,
+		SuccNum:          back.succNum,
+		ConnNum:          back.connNum,
+		LastCheckLatency: back.checkLatency.Nanoseconds() / 1000000,
+		LastCheckError:   back.checkErr,
+		StatusDuration:   int64(time.Since(back.statusTime).Seconds()),
+	}
+	if !back.checkTime.IsZero() {
+		state.LastCheckTime = back.checkTime.Format(time.RFC3339)
+	}
+
+	return state
+}
@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+func newTestBackend() *BfeBackend {
+	name, addr, port := "b1", "127.0.0.1", 8001
+	back := NewBfeBackend()
+	back.Init("sub1", &cluster_table_conf.BackendConf{Name: &name, Addr: &addr, Port: &port})
+
+	return back
+}
+
+// setStatusAgo pretends last change of status happened d ago
+func setStatusAgo(back *BfeBackend, d time.Duration) {
+	back.Lock()
+	back.statusTime = time.Now().Add(-d)
+	back.Unlock()
+}
+
+func TestBackendState(t *testing.T) {
+	back := newTestBackend()
+
+	state := back.State()
+	if state.Name != "b1" || state.Addr != "127.0.0.1" || state.Port != 8001 ||
+		!state.Avail || state.Ejected || state.LastCheckTime != "" || state.StatusDuration != 0 {
+		t.Errorf("got state %+v of new backend", state)
+	}
+
+	back.AddConnNum()
+	back.AddConnNum()
+	back.AddSuccNum()
+	if state = back.State(); state.ConnNum != 2 || state.SuccNum != 1 {
+		t.Errorf("got conn num %d and succ num %d, expect 2 and 1", state.ConnNum, state.SuccNum)
+	}
+
+	// result of health check
+	before := time.Now().Truncate(time.Second)
+	back.SetCheckResult(15*time.Millisecond, errors.New("connection refused"))
+	state = back.State()
+	checkTime, err := time.Parse(time.RFC3339, state.LastCheckTime)
+	if err != nil || checkTime.Before(before) || checkTime.After(time.Now()) {
+		t.Errorf("got last check time %q, expect now", state.LastCheckTime)
+	}
+	if state.LastCheckLatency != 15 || state.LastCheckError != "connection refused" {
+		t.Errorf("got last check latency %d and error %q", state.LastCheckLatency, state.LastCheckError)
+	}
+
+	back.SetCheckResult(time.Millisecond, nil)
+	if state = back.State(); state.LastCheckError != "" {
+		t.Errorf("got last check error %q after check succeeded", state.LastCheckError)
+	}
+}
+
+func TestBackendStateChange(t *testing.T) {
+	back := newTestBackend()
+	setStatusAgo(back, 90*time.Second)
+	if state := back.State(); state.StatusDuration != 90 {
+		t.Errorf("got status duration %d, expect 90", state.StatusDuration)
+	}
+
+	// down by health check
+	version := HealthVersion()
+	back.AddFailNum()
+	if back.UpdateStatus(2) {
+		t.Errorf("backend down before fail num reaches threshold")
+	}
+	back.AddFailNum()
+	if !back.UpdateStatus(2) {
+		t.Errorf("backend not down after fail num reaches threshold")
+	}
+	state := back.State()
+	if state.Avail || state.FailNum != 2 || state.StatusDuration != 0 {
+		t.Errorf("got state %+v after down, expect unavailable with status duration reset", state)
+	}
+	if HealthVersion() == version {
+		t.Errorf("health version not changed after down")
+	}
+
+	// status duration is not reset if status unchanged
+	setStatusAgo(back, 30*time.Second)
+	version = HealthVersion()
+	back.AddFailNum()
+	if back.UpdateStatus(2) {
+		t.Errorf("down backend reported down again")
+	}
+	back.SetAvail(false)
+	if state := back.State(); state.StatusDuration != 30 || HealthVersion() != version {
+		t.Errorf("status duration %d and health version changed with status unchanged", state.StatusDuration)
+	}
+
+	// back to avail
+	back.ResetFailNum()
+	back.SetAvail(true)
+	state = back.State()
+	if !state.Avail || state.FailNum != 0 || state.StatusDuration != 0 {
+		t.Errorf("got state %+v after recovery, expect available with status duration reset", state)
+	}
+	if back.RecoverTime().IsZero() {
+		t.Errorf("recover time not set after recovery")
+	}
+
+	// ejected by outlier detection
+	setStatusAgo(back, 30*time.Second)
+	back.Eject(time.Now())
+	state = back.State()
+	if state.Avail || !state.Ejected || state.StatusDuration != 0 {
+		t.Errorf("got state %+v after ejection, expect ejected and unavailable", state)
+	}
+
+	back.Uneject(time.Now())
+	if state = back.State(); !state.Avail || state.Ejected {
+		t.Errorf("got state %+v after unejection, expect available", state)
+	}
+
+	// ejected backend down by health check is still unavailable after unejection
+	back.Eject(time.Now())
+	back.SetAvail(false)
+	back.Uneject(time.Now())
+	if state = back.State(); state.Avail || state.Ejected {
+		t.Errorf("got state %+v, expect unavailable and not ejected", state)
+	}
+}
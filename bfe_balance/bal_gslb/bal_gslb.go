@@ -36,6 +36,24 @@ type BalanceGslb struct {
 	crossRetry  int
 	hashConf    cluster_conf.HashConf
 	BalanceMode string
+	slowStart   time.Duration
+	outlierConf *cluster_conf.OutlierDetection
+
+	panicThreshold int
+	maxConns       int // max concurrent requests to a backend
+
+	// priority tiers of sub clusters, see tierSubClusters
+	tiers      map[string]int
+	tierNum    int
+	spillover  int
+	activeTier int
+
+	// sub clusters without available backends, see updateEffectiveWeight
+	skipped         map[string]bool
+	effectiveWeight int // total weight of sub clusters not skipped
+	healthVersion   uint64
+
+	sticky *stickyCookie // nil if sticky cookie is disabled
 }
 
 func NewBalanceGslb(name string) *BalanceGslb {
@@ -59,11 +77,70 @@ func (bal *BalanceGslb) SetGslbBasic(basic cluster_conf.GslbBasicConf) {
 	bal.crossRetry = *basic.CrossRetry
 	bal.retryMax = *basic.RetryMax
 	bal.hashConf = *basic.HashConf
+	bal.sticky = newStickyCookie(basic.HashConf.StickyCookie)
 	bal.BalanceMode = *basic.BalanceMode
+	bal.slowStart = time.Duration(*basic.SlowStartTime) * time.Second
+	bal.panicThreshold = *basic.PanicThreshold
+	bal.setTiers(basic)
+	for _, sub := range bal.subClusters {
+		sub.backends.SetSlowStart(bal.slowStart)
+		sub.backends.SetPanicThreshold(bal.panicThreshold)
+	}
+
+	bal.lock.Unlock()
+}
+
+// SetMaxConnsPerBackend sets max concurrent requests to a backend, 0 means no limit
+func (bal *BalanceGslb) SetMaxConnsPerBackend(maxConns int) {
+	bal.lock.Lock()
+
+	bal.maxConns = maxConns
+	for _, sub := range bal.subClusters {
+		sub.backends.SetMaxConns(maxConns)
+	}
+
+	bal.lock.Unlock()
+}
+
+// ScheduleCheck starts continuous health check of all backends, if it is
+// enabled for the cluster
+func (bal *BalanceGslb) ScheduleCheck() {
+	bal.lock.Lock()
+	defer bal.lock.Unlock()
+
+	for _, sub := range bal.subClusters {
+		for _, backend := range sub.backends.Backends() {
+			bal_backend.ScheduleCheck(backend, bal.name)
+		}
+	}
+}
+
+// SetOutlierDetection sets outlier detection conf for all sub clusters
+func (bal *BalanceGslb) SetOutlierDetection(conf *cluster_conf.OutlierDetection) {
+	bal.lock.Lock()
+
+	bal.outlierConf = conf
+	for _, sub := range bal.subClusters {
+		sub.backends.SetOutlierDetection(conf)
+	}
 
 	bal.lock.Unlock()
 }
 
+// OnResult records result of request to backend for outlier detection,
+// status is 0 if no response is got
+func (bal *BalanceGslb) OnResult(backend *bal_backend.BfeBackend, status int) {
+	bal.lock.Lock()
+	defer bal.lock.Unlock()
+
+	for _, sub := range bal.subClusters {
+		if sub.Name == backend.SubCluster {
+			sub.backends.OnResult(backend, status)
+			return
+		}
+	}
+}
+
 func (bal *BalanceGslb) Init(conf gslb_conf.GslbClusterConf) error {
 	total := 0
 	for subName, weight := range conf {
@@ -103,6 +180,7 @@ func (bal *BalanceGslb) BackendInit(cBackend cluster_table_conf.ClusterBackend)
 			subCluster.init(backend)
 		}
 	}
+	bal.skipped = nil
 
 	bal.lock.Unlock()
 	return nil
@@ -131,6 +209,10 @@ func (bal *BalanceGslb) Reload(conf gslb_conf.GslbClusterConf) error {
 		if _, ok := subExist[name]; !ok {
 			sub := newSubCluster(name)
 			sub.weight = w
+			sub.backends.SetSlowStart(bal.slowStart)
+			sub.backends.SetOutlierDetection(bal.outlierConf)
+			sub.backends.SetPanicThreshold(bal.panicThreshold)
+			sub.backends.SetMaxConns(bal.maxConns)
 			newList = append(newList, sub)
 		}
 	}
@@ -163,6 +245,7 @@ func (bal *BalanceGslb) Reload(conf gslb_conf.GslbClusterConf) error {
 	}
 
 	bal.subClusters = newList
+	bal.skipped = nil
 
 	return nil
 }
@@ -174,6 +257,7 @@ func (bal *BalanceGslb) BackendReload(clusterBackend cluster_table_conf.ClusterB
 			subCluster.update(backend)
 		}
 	}
+	bal.skipped = nil
 	bal.lock.Unlock()
 
 	return nil
@@ -249,6 +333,8 @@ func (bal *BalanceGslb) Balance(req *bfe_basic.Request) (*bal_backend.BfeBackend
 	switch bal.BalanceMode {
 	case cluster_conf.BalanceModeWlc:
 		balAlgor = bal_slb.WlcSmooth
+	case cluster_conf.BalanceModeP2cEwma:
+		balAlgor = bal_slb.P2cEwma
 	default:
 		balAlgor = bal_slb.WrrSmooth
 	}
@@ -257,6 +343,18 @@ func (bal *BalanceGslb) Balance(req *bfe_basic.Request) (*bal_backend.BfeBackend
 		balAlgor = bal_slb.WrrSticky
 	}
 
+	if bal.BalanceMode == cluster_conf.BalanceModeMaglev {
+		balAlgor = bal_slb.ConsistentHash
+	}
+
+	// backend in sticky cookie is used unless request is retried
+	if req.RetryTime == 0 {
+		if backend = bal.stickyBackend(req); backend != nil {
+			req.Backend.SubclusterName = backend.SubCluster
+			return backend, nil
+		}
+	}
+
 	hashKey := bal.getHashKey(req)
 
 	current, err = bal.subClustersBalance(hashKey)
@@ -271,6 +369,12 @@ func (bal *BalanceGslb) Balance(req *bfe_basic.Request) (*bal_backend.BfeBackend
 		backend, err = current.balance(balAlgor, hashKey)
 		if err == nil {
 			return backend, nil
+		} else if err == bal_slb.ErrBackendSaturated {
+			// fail fast, other sub clusters are not tried
+			state.ErrBkCircuitOpen.Inc(1)
+			req.ErrCode = bfe_basic.ErrBkCircuitOpen
+			req.ErrMsg = fmt.Sprintf("cluster[%s], sub[%s], err[%s]", bal.name, current.Name, err.Error())
+			return nil, bfe_basic.ErrBkCircuitOpen
 		} else {
 			state.ErrBkNoBackend.Inc(1)
 			req.ErrMsg = fmt.Sprintf("cluster[%s], sub[%s], err[%s]", bal.name, current.Name, err.Error())
@@ -306,6 +410,54 @@ func (bal *BalanceGslb) Balance(req *bfe_basic.Request) (*bal_backend.BfeBackend
 	return backend, bfe_basic.ErrBkCrossRetryBalance
 }
 
+// BalanceExclude selects a backend other than exclude, e.g. for hedged
+// request. Backend in the same sub cluster as exclude is preferred, and
+// other sub clusters are tried if cross retry is enabled. Session sticky
+// and consistent hash are not followed, and request is not modified.
+func (bal *BalanceGslb) BalanceExclude(exclude *bal_backend.BfeBackend) (*bal_backend.BfeBackend, error) {
+	bal.lock.Lock()
+	defer bal.lock.Unlock()
+
+	var current *SubCluster
+	for _, sub := range bal.subClusters {
+		if sub.Name == exclude.SubCluster {
+			current = sub
+			break
+		}
+	}
+
+	if current != nil {
+		if backend, err := current.balanceExclude(exclude); err == nil {
+			return backend, nil
+		}
+	}
+
+	if bal.crossRetry <= 0 {
+		return nil, bfe_basic.ErrBkNoBackend
+	}
+
+	other, err := bal.randomSelectExclude(current)
+	if err != nil {
+		return nil, bfe_basic.ErrBkNoSubClusterCross
+	}
+
+	backend, err := other.balanceExclude(exclude)
+	if err != nil {
+		return nil, bfe_basic.ErrBkNoBackend
+	}
+
+	return backend, nil
+}
+
+// RetryAllowed checks whether request could be balanced once more without
+// exceeding RetryMax and CrossRetry
+func (bal *BalanceGslb) RetryAllowed(req *bfe_basic.Request) bool {
+	bal.lock.Lock()
+	defer bal.lock.Unlock()
+
+	return req.RetryTime < bal.retryMax+bal.crossRetry
+}
+
 func (bal *BalanceGslb) subClustersBalance(value []byte) (*SubCluster, error) {
 	var subCluster *SubCluster
 	var w int
@@ -318,14 +470,22 @@ func (bal *BalanceGslb) subClustersBalance(value []byte) (*SubCluster, error) {
 		return subCluster, fmt.Errorf("totalWeight is 0")
 	}
 
+	bal.updateEffectiveWeight()
+
+	if bal.tierNum > 0 {
+		if subs := bal.tierSubClusters(); len(subs) > 0 {
+			return hashSubClusters(subs, value), nil
+		}
+	}
+
 	if bal.single {
 		return bal.subClusters[bal.avail], nil
 	}
 
-	w = bal_slb.GetHash(value, uint(bal.totalWeight))
+	w = bal_slb.GetHash(value, uint(bal.effectiveWeight))
 	for i := 0; i < len(bal.subClusters); i++ {
 		subCluster = bal.subClusters[i]
-		if subCluster.weight <= 0 {
+		if subCluster.weight <= 0 || bal.skipped[subCluster.Name] {
 			continue
 		}
 		w -= subCluster.weight
@@ -337,31 +497,37 @@ func (bal *BalanceGslb) subClustersBalance(value []byte) (*SubCluster, error) {
 	return subCluster, nil
 }
 
+// randomSelectExclude selects a sub cluster other than excludeCluster for
+// cross retry. Sub clusters without available backends are not selected,
+// and those in the highest priority tier are preferred.
 func (bal *BalanceGslb) randomSelectExclude(excludeCluster *SubCluster) (*SubCluster, error) {
-	var subCluster *SubCluster
-	available := 0
+	var candidates SubClusterList
+	minTier := 0
+	for _, subCluster := range bal.subClusters {
+		if subCluster == excludeCluster || subCluster.weight < 0 || subCluster.sType == TypeGslbBlackhole {
+			continue
+		}
+		// the same as sub clusters skipped by updateEffectiveWeight, which
+		// does not check sub clusters of weight 0
+		if avail, _ := subCluster.backends.AvailNum(); avail == 0 {
+			continue
+		}
 
-	for i := 0; i < len(bal.subClusters); i++ {
-		subCluster = bal.subClusters[i]
-		if subCluster != excludeCluster && subCluster.weight >= 0 && subCluster.sType != TypeGslbBlackhole {
-			available++
+		tier := bal.tierOf(subCluster.Name)
+		if len(candidates) == 0 || tier < minTier {
+			candidates = candidates[:0]
+			minTier = tier
+		} else if tier > minTier {
+			continue
 		}
+		candidates = append(candidates, subCluster)
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	n := int(r.Int31()) % available
-	for i := 0; i < len(bal.subClusters); i++ {
-		subCluster = bal.subClusters[i]
-		if subCluster != excludeCluster && subCluster.weight >= 0 && subCluster.sType != TypeGslbBlackhole {
-			if n > 0 {
-				n--
-				continue
-			}
-			return subCluster, nil
-		}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no sub cluster for cross retry")
 	}
 
-	return subCluster, fmt.Errorf("randomSelectExclude(): should not reach here")
+	return candidates[rand.Intn(len(candidates))], nil
 }
 
 func (bal *BalanceGslb) SubClusterNum() int {
@@ -374,6 +540,9 @@ type BalErrState struct {
 	ErrBkNoBackend         *metrics.Counter
 	ErrBkRetryTooMany      *metrics.Counter
 	ErrGslbBlackhole       *metrics.Counter
+	ErrBkCircuitOpen       *metrics.Counter
+	BalancePanic           *metrics.Counter // requests balanced in panic mode
+	StickyCookieInvalid    *metrics.Counter
 }
 
 var state BalErrState
@@ -0,0 +1,288 @@
+package bal_gslb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/baidu/go-lib/web-monitor/metrics"
+
+	bal_backend "github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/gslb_conf"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+func TestMain(m *testing.M) {
+	var balMetrics metrics.Metrics
+	balMetrics.Init(GetBalErrState(), "PROXY", 20)
+
+	os.Exit(m.Run())
+}
+
+// newTestBal creates balancer of cluster c1. weights is weight of each sub
+// cluster, which has backendNum backends; basic is GslbBasicConf in json.
+func newTestBal(t *testing.T, weights map[string]int, backendNum int, basic string) *BalanceGslb {
+	bal := NewBalanceGslb("c1")
+	if err := bal.Init(gslb_conf.GslbClusterConf(weights)); err != nil {
+		t.Fatalf("Init(): %s", err)
+	}
+
+	backends := make(cluster_table_conf.ClusterBackend)
+	port := 8000
+	for sub := range weights {
+		for i := 0; i < backendNum; i++ {
+			name, addr, weight := fmt.Sprintf("%s-b%d", sub, i), "127.0.0.1", 10
+			p := port
+			port++
+			backends[sub] = append(backends[sub], &cluster_table_conf.BackendConf{
+				Name: &name, Addr: &addr, Port: &p, Weight: &weight,
+			})
+		}
+	}
+	if err := bal.BackendInit(backends); err != nil {
+		t.Fatalf("BackendInit(): %s", err)
+	}
+
+	var basicConf cluster_conf.GslbBasicConf
+	if err := json.Unmarshal([]byte(basic), &basicConf); err != nil {
+		t.Fatalf("decode GslbBasicConf: %s", err)
+	}
+	if err := cluster_conf.GslbBasicConfCheck(&basicConf); err != nil {
+		t.Fatalf("GslbBasicConfCheck(): %s", err)
+	}
+	bal.SetGslbBasic(basicConf)
+
+	return bal
+}
+
+// setSubAvail marks all backends of sub cluster up or down
+func setSubAvail(bal *BalanceGslb, name string, avail bool) {
+	for _, sub := range bal.subClusters {
+		if sub.Name != name {
+			continue
+		}
+		for _, backend := range sub.backends.Backends() {
+			backend.SetAvail(avail)
+		}
+	}
+}
+
+func newTestRequest(clientIP string) *bfe_basic.Request {
+	hreq := &bfe_http.Request{Header: make(bfe_http.Header)}
+	req := bfe_basic.NewRequest(hreq, nil, nil, nil, nil)
+	req.ClientAddr = &net.TCPAddr{IP: net.ParseIP(clientIP)}
+
+	return req
+}
+
+func TestCrossRetryNoOtherSubCluster(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 100}, 2, `{"CrossRetry": 1, "RetryMax": 1}`)
+	setSubAvail(bal, "sub1", false)
+
+	req := newTestRequest("10.0.0.1")
+	for req.RetryTime = 0; req.RetryTime <= 2; req.RetryTime++ {
+		req.ErrCode = nil
+		backend, err := bal.Balance(req)
+		if backend != nil || err == nil {
+			t.Fatalf("retry %d: expect no backend, got %v, %v", req.RetryTime, backend, err)
+		}
+	}
+	if req.ErrCode != bfe_basic.ErrBkNoSubClusterCross {
+		t.Errorf("got error %v, expect %v", req.ErrCode, bfe_basic.ErrBkNoSubClusterCross)
+	}
+}
+
+func TestCrossRetrySkipsUnavailable(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 50, "sub2": 30, "sub3": 20}, 2, `{"CrossRetry": 1, "RetryMax": 0}`)
+	setSubAvail(bal, "sub3", false)
+
+	for i := 0; i < 100; i++ {
+		req := newTestRequest(fmt.Sprintf("10.0.0.%d", i))
+		req.RetryTime = 1
+		backend, err := bal.Balance(req)
+		if err != nil {
+			t.Fatalf("Balance(): %s", err)
+		}
+		if backend.SubCluster == "sub3" {
+			t.Fatalf("sub cluster without available backend selected for cross retry")
+		}
+	}
+
+	// the only other sub cluster is down too
+	setSubAvail(bal, "sub2", false)
+	for i := 0; i < 20; i++ {
+		req := newTestRequest(fmt.Sprintf("10.0.0.%d", i))
+		req.RetryTime = 1
+		if _, err := bal.Balance(req); err != bfe_basic.ErrBkNoSubClusterCross {
+			t.Fatalf("got error %v, expect %v", err, bfe_basic.ErrBkNoSubClusterCross)
+		}
+	}
+}
+
+func TestCrossRetryPrefersTier(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"a1": 50, "a2": 50, "b1": 50, "c1": 50}, 2,
+		`{"CrossRetry": 1, "RetryMax": 0, "PriorityTiers": [["a1", "a2"], ["b1"]],
+		"SpilloverThreshold": 50}`)
+
+	// request goes to tier a, and is cross retried in the same tier
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		req := newTestRequest(fmt.Sprintf("10.0.%d.%d", i/250, i%250))
+		req.RetryTime = 1
+		backend, err := bal.Balance(req)
+		if err != nil {
+			t.Fatalf("Balance(): %s", err)
+		}
+		counts[backend.SubCluster]++
+	}
+	if counts["b1"] != 0 || counts["c1"] != 0 || counts["a1"] == 0 || counts["a2"] == 0 {
+		t.Errorf("cross retry should stay in first tier, got %v", counts)
+	}
+
+	// a2 is down: retry of a2 goes to a1, and retry of a1 goes to next tier
+	setSubAvail(bal, "a2", false)
+	counts = make(map[string]int)
+	for i := 0; i < 200; i++ {
+		req := newTestRequest(fmt.Sprintf("10.1.%d.%d", i/250, i%250))
+		req.RetryTime = 1
+		backend, err := bal.Balance(req)
+		if err != nil {
+			t.Fatalf("Balance(): %s", err)
+		}
+		counts[backend.SubCluster]++
+	}
+	if counts["a2"] != 0 || counts["c1"] != 0 || counts["b1"] == 0 {
+		t.Errorf("cross retry should go to a1 or b1, got %v", counts)
+	}
+}
+
+func TestBalanceExclude(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 50, "sub2": 50}, 3,
+		`{"CrossRetry": 1, "RetryMax": 2, "BalanceMode": "MAGLEV"}`)
+
+	req := newTestRequest("10.0.0.1")
+	backend, err := bal.Balance(req)
+	if err != nil {
+		t.Fatalf("Balance(): %s", err)
+	}
+
+	// the same backend is selected by consistent hash
+	if again, _ := bal.Balance(newTestRequest("10.0.0.1")); again != backend {
+		t.Fatalf("consistent hash selects %s and %s", backend.Name, again.Name)
+	}
+
+	for i := 0; i < 20; i++ {
+		other, err := bal.BalanceExclude(backend)
+		if err != nil {
+			t.Fatalf("BalanceExclude(): %s", err)
+		}
+		if other == backend || other.SubCluster != backend.SubCluster {
+			t.Fatalf("got %s, expect another backend in %s", other.Name, backend.SubCluster)
+		}
+	}
+
+	// other backends in the sub cluster are down, another sub cluster is used
+	for _, sub := range bal.subClusters {
+		if sub.Name != backend.SubCluster {
+			continue
+		}
+		for _, b := range sub.backends.Backends() {
+			if b != backend {
+				b.SetAvail(false)
+			}
+		}
+	}
+	other, err := bal.BalanceExclude(backend)
+	if err != nil || other.SubCluster == backend.SubCluster {
+		t.Fatalf("got %v, %v, expect backend in another sub cluster", other, err)
+	}
+
+	// cross retry disabled
+	bal = newTestBal(t, map[string]int{"sub1": 100}, 1, `{"CrossRetry": 0}`)
+	backend, _ = bal.Balance(newTestRequest("10.0.0.1"))
+	if other, err := bal.BalanceExclude(backend); err == nil {
+		t.Errorf("got %s, expect no backend", other.Name)
+	}
+}
+
+func TestStickyBackend(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 100}, 2,
+		`{"HashConf": {"StickyCookie": {"Enable": true, "Key": "k1"}}}`)
+	backends := bal.subClusters[0].backends.Backends()
+	sticky := backends[0]
+
+	balance := func() *bal_backend.BfeBackend {
+		req := newTestRequest("10.0.0.1")
+		cookie := bal.StickyCookie(req, sticky)
+		req.HttpRequest.Header.Set("Cookie", cookie.Name+"="+cookie.Value)
+		backend, err := bal.Balance(req)
+		if err != nil {
+			t.Fatalf("Balance(): %s", err)
+		}
+		return backend
+	}
+
+	for i := 0; i < 10; i++ {
+		if backend := balance(); backend != sticky {
+			t.Fatalf("got %s, expect backend in sticky cookie", backend.Name)
+		}
+	}
+
+	// backend in cookie reaches max conns
+	bal.SetMaxConnsPerBackend(1)
+	sticky.AddConnNum()
+	if backend := balance(); backend == sticky {
+		t.Errorf("saturated backend in sticky cookie selected")
+	}
+	sticky.DecConnNum()
+
+	// backend in cookie is down
+	sticky.SetAvail(false)
+	if backend := balance(); backend == sticky {
+		t.Errorf("unavailable backend in sticky cookie selected")
+	}
+
+	// all backends are used in panic mode
+	backends[1].SetAvail(false)
+	basic := `{"PanicThreshold": 50, "HashConf": {"StickyCookie": {"Enable": true, "Key": "k1"}}}`
+	var basicConf cluster_conf.GslbBasicConf
+	json.Unmarshal([]byte(basic), &basicConf)
+	cluster_conf.GslbBasicConfCheck(&basicConf)
+	bal.SetGslbBasic(basicConf)
+	if backend := balance(); backend != sticky {
+		t.Errorf("got %s, expect backend in sticky cookie in panic mode", backend.Name)
+	}
+}
+
+func TestBalanceSaturated(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 100, "sub2": 0}, 2, `{"CrossRetry": 1}`)
+	bal.SetMaxConnsPerBackend(1)
+	backends := bal.subClusters[0].backends.Backends()
+	if bal.subClusters[0].Name != "sub1" {
+		backends = bal.subClusters[1].backends.Backends()
+	}
+
+	// saturated backend is skipped
+	backends[0].AddConnNum()
+	for i := 0; i < 10; i++ {
+		backend, err := bal.Balance(newTestRequest(fmt.Sprintf("10.0.0.%d", i)))
+		if err != nil || backend != backends[1] {
+			t.Fatalf("got %v, %v, expect %s", backend, err, backends[1].Name)
+		}
+	}
+
+	// fail fast if all backends are saturated, without cross retry
+	backends[1].AddConnNum()
+	req := newTestRequest("10.0.0.1")
+	if backend, err := bal.Balance(req); err != bfe_basic.ErrBkCircuitOpen {
+		t.Errorf("got %v, %v, expect ErrBkCircuitOpen", backend, err)
+	}
+	if req.ErrCode != bfe_basic.ErrBkCircuitOpen || req.Stat != nil && req.Stat.IsCrossCLuster {
+		t.Errorf("got error code %v, expect ErrBkCircuitOpen without cross retry", req.ErrCode)
+	}
+}
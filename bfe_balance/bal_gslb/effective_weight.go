@@ -0,0 +1,68 @@
+package bal_gslb
+
+import (
+	"sort"
+
+	"github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/sirupsen/logrus"
+)
+
+// updateEffectiveWeight skips sub clusters without available backends, so
+// that their weight is redistributed to other sub clusters in proportion.
+// It is recomputed only when health of backends changes.
+func (bal *BalanceGslb) updateEffectiveWeight() {
+	version := backend.HealthVersion()
+	if bal.skipped != nil && version == bal.healthVersion {
+		return
+	}
+	bal.healthVersion = version
+
+	skipped := make(map[string]bool)
+	total := 0
+	for _, sub := range bal.subClusters {
+		if sub.weight <= 0 {
+			continue
+		}
+
+		// traffic to blackhole is dropped on purpose
+		if sub.sType == TypeGslbNormal {
+			if avail, _ := sub.backends.AvailNum(); avail == 0 {
+				skipped[sub.Name] = true
+				continue
+			}
+		}
+		total += sub.weight
+	}
+
+	// no sub cluster is available, keep configured weights
+	if total == 0 {
+		if len(bal.skipped) > 0 {
+			logrus.Warnf("gslb[%s]: no available backend in all sub clusters, use configured weights", bal.name)
+		}
+		bal.skipped = make(map[string]bool)
+		bal.effectiveWeight = bal.totalWeight
+		return
+	}
+
+	for _, sub := range bal.subClusters {
+		if skipped[sub.Name] && !bal.skipped[sub.Name] {
+			logrus.Warnf("gslb[%s]: no available backend in sub cluster[%s], redistribute its weight", bal.name, sub.Name)
+		} else if !skipped[sub.Name] && bal.skipped[sub.Name] {
+			logrus.Infof("gslb[%s]: sub cluster[%s] is available again", bal.name, sub.Name)
+		}
+	}
+
+	bal.skipped = skipped
+	bal.effectiveWeight = total
+}
+
+// skippedSubClusters returns names of sub clusters being skipped
+func (bal *BalanceGslb) skippedSubClusters() []string {
+	var names []string
+	for name := range bal.skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,122 @@
+package bal_gslb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// subClusterShare balances n hash keys to sub clusters, and returns share
+// of each sub cluster
+func subClusterShare(t *testing.T, bal *BalanceGslb, n int) map[string]float64 {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		sub, err := bal.subClustersBalance([]byte(fmt.Sprintf("key%d", i)))
+		if err != nil {
+			t.Fatalf("subClustersBalance(): %s", err)
+		}
+		counts[sub.Name]++
+	}
+
+	share := make(map[string]float64)
+	for name, count := range counts {
+		share[name] = float64(count) / float64(n)
+	}
+
+	return share
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	bal := newTestBal(t, map[string]int{"sub1": 50, "sub2": 30, "sub3": 20}, 2, `{}`)
+	sub3 := bal.subClusters[0]
+	for _, sub := range bal.subClusters {
+		if sub.Name == "sub3" {
+			sub3 = sub
+		}
+	}
+
+	tests := []struct {
+		name    string
+		update  func()
+		expect  map[string]float64
+		skipped []string
+	}{
+		{
+			"all available",
+			func() {},
+			map[string]float64{"sub1": 0.5, "sub2": 0.3, "sub3": 0.2},
+			nil,
+		},
+		{
+			// sub cluster with available backends keeps its weight
+			"part of sub3 down",
+			func() { sub3.backends.Backends()[0].SetAvail(false) },
+			map[string]float64{"sub1": 0.5, "sub2": 0.3, "sub3": 0.2},
+			nil,
+		},
+		{
+			"sub3 down",
+			func() { setSubAvail(bal, "sub3", false) },
+			map[string]float64{"sub1": 0.625, "sub2": 0.375},
+			[]string{"sub3"},
+		},
+		{
+			"sub2 and sub3 down",
+			func() { setSubAvail(bal, "sub2", false) },
+			map[string]float64{"sub1": 1},
+			[]string{"sub2", "sub3"},
+		},
+		{
+			// no sub cluster is available, configured weights are used
+			"all down",
+			func() { setSubAvail(bal, "sub1", false) },
+			map[string]float64{"sub1": 0.5, "sub2": 0.3, "sub3": 0.2},
+			nil,
+		},
+		{
+			"sub3 back",
+			func() { sub3.backends.Backends()[1].SetAvail(true) },
+			map[string]float64{"sub3": 1},
+			[]string{"sub1", "sub2"},
+		},
+		{
+			"sub1 back",
+			func() { setSubAvail(bal, "sub1", true) },
+			map[string]float64{"sub1": 50.0 / 70, "sub3": 20.0 / 70},
+			[]string{"sub2"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt.update()
+
+		share := subClusterShare(t, bal, 10000)
+		for _, name := range []string{"sub1", "sub2", "sub3"} {
+			if math.Abs(share[name]-tt.expect[name]) > 0.02 {
+				t.Errorf("%s: got share %v, expect %v", tt.name, share, tt.expect)
+				break
+			}
+		}
+
+		state := State(bal)
+		if !reflect.DeepEqual(state.Skipped, tt.skipped) {
+			t.Errorf("%s: got skipped %v, expect %v", tt.name, state.Skipped, tt.skipped)
+		}
+		for name, subState := range state.SubClusters {
+			if expect := contains(tt.skipped, name); subState.Skipped != expect {
+				t.Errorf("%s: got skipped %v of %s, expect %v", tt.name, subState.Skipped, name, expect)
+			}
+		}
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
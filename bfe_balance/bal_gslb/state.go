@@ -1,22 +1,39 @@
 package bal_gslb
 
+import (
+	"github.com/crud-bird/bfe/bfe_balance/backend"
+)
+
 type SubClusterState struct {
 	BackendNum int
+	AvailNum   int // num of available backends
+	Panic      bool
+	Tier       int  // priority tier
+	Skipped    bool // skipped for no available backend
 }
 
 type GslbState struct {
 	SubClusters map[string]*SubClusterState
 	BackendNum  int
+	ActiveTier  int      // priority tier receiving traffic
+	Skipped     []string // sub clusters skipped for no available backend
 }
 
 func State(bal *BalanceGslb) *GslbState {
 	gslbState := new(GslbState)
 	gslbState.SubClusters = make(map[string]*SubClusterState)
 	bal.lock.Lock()
+	gslbState.ActiveTier = bal.activeTier
+	bal.updateEffectiveWeight()
+	gslbState.Skipped = bal.skippedSubClusters()
 	for _, sub := range bal.subClusters {
 		subState := &SubClusterState{
 			BackendNum: sub.Len(),
+			Panic:      sub.backends.InPanic(),
+			Tier:       bal.tierOf(sub.Name),
+			Skipped:    bal.skipped[sub.Name],
 		}
+		subState.AvailNum, _ = sub.backends.AvailNum()
 
 		gslbState.SubClusters[sub.Name] = subState
 		gslbState.BackendNum += subState.BackendNum
@@ -26,3 +43,25 @@ func State(bal *BalanceGslb) *GslbState {
 
 	return gslbState
 }
+
+// BackendState returns status of backends in each sub cluster. Only given
+// sub cluster is returned if subCluster is not empty.
+func BackendState(bal *BalanceGslb, subCluster string) map[string][]backend.BackendState {
+	states := make(map[string][]backend.BackendState)
+
+	bal.lock.Lock()
+	for _, sub := range bal.subClusters {
+		if subCluster != "" && sub.Name != subCluster {
+			continue
+		}
+
+		subStates := make([]backend.BackendState, 0, sub.Len())
+		for _, back := range sub.backends.Backends() {
+			subStates = append(subStates, back.State())
+		}
+		states[sub.Name] = subStates
+	}
+	bal.lock.Unlock()
+
+	return states
+}
@@ -0,0 +1,177 @@
+package bal_gslb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	bal_backend "github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+const (
+	stickySep    = "\x00" // separator of sub cluster and backend in cookie
+	stickyMacLen = 16     // bytes of truncated HMAC-SHA256
+)
+
+// stickyContextKey is key in req.Context for backend in sticky cookie
+type stickyContextKey struct{}
+
+// stickyCookie encodes and decodes sticky cookie issued by BFE
+type stickyCookie struct {
+	conf   cluster_conf.StickyCookieConf
+	macKey []byte      // nil if encrypted
+	aead   cipher.AEAD // nil if signed
+}
+
+func newStickyCookie(conf *cluster_conf.StickyCookieConf) *stickyCookie {
+	if conf == nil || !*conf.Enable {
+		return nil
+	}
+
+	sc := &stickyCookie{conf: *conf}
+	if *conf.Encrypt {
+		// key of 32 bytes is always valid for aes and gcm
+		block, _ := aes.NewCipher(deriveKey(*conf.Key, "encrypt"))
+		sc.aead, _ = cipher.NewGCM(block)
+	} else {
+		sc.macKey = deriveKey(*conf.Key, "sign")
+	}
+
+	return sc
+}
+
+// deriveKey derives key for usage from configured key
+func deriveKey(key, usage string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(usage))
+
+	return mac.Sum(nil)
+}
+
+func (sc *stickyCookie) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, sc.macKey)
+	mac.Write(payload)
+
+	return mac.Sum(nil)[:stickyMacLen]
+}
+
+// encode returns cookie value for backend in sub cluster
+func (sc *stickyCookie) encode(sub, backend string) string {
+	payload := []byte(sub + stickySep + backend)
+	enc := base64.RawURLEncoding
+
+	if sc.aead != nil {
+		nonce := make([]byte, sc.aead.NonceSize())
+		rand.Read(nonce)
+		return enc.EncodeToString(sc.aead.Seal(nonce, nonce, payload, nil))
+	}
+
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(sc.sign(payload))
+}
+
+// decode returns sub cluster and backend in cookie value
+func (sc *stickyCookie) decode(value string) (string, string, bool) {
+	enc := base64.RawURLEncoding
+	var payload []byte
+	var err error
+
+	if sc.aead != nil {
+		var data []byte
+		if data, err = enc.DecodeString(value); err != nil || len(data) < sc.aead.NonceSize() {
+			return "", "", false
+		}
+		nonce, ciphertext := data[:sc.aead.NonceSize()], data[sc.aead.NonceSize():]
+		if payload, err = sc.aead.Open(nil, nonce, ciphertext, nil); err != nil {
+			return "", "", false
+		}
+	} else {
+		i := strings.IndexByte(value, '.')
+		if i < 0 {
+			return "", "", false
+		}
+		var mac []byte
+		if payload, err = enc.DecodeString(value[:i]); err != nil {
+			return "", "", false
+		}
+		if mac, err = enc.DecodeString(value[i+1:]); err != nil || !hmac.Equal(mac, sc.sign(payload)) {
+			return "", "", false
+		}
+	}
+
+	parts := strings.SplitN(string(payload), stickySep, 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// stickyBackend returns backend in sticky cookie of request, nil if cookie
+// is absent or invalid, or the backend could not be selected by balance
+func (bal *BalanceGslb) stickyBackend(req *bfe_basic.Request) *bal_backend.BfeBackend {
+	if bal.sticky == nil {
+		return nil
+	}
+
+	cookie, ok := req.Cookie(*bal.sticky.conf.Name)
+	if !ok {
+		return nil
+	}
+
+	subName, name, ok := bal.sticky.decode(cookie.Value)
+	if !ok {
+		state.StickyCookieInvalid.Inc(1)
+		return nil
+	}
+
+	for _, sub := range bal.subClusters {
+		if sub.Name != subName || sub.weight <= 0 {
+			continue
+		}
+
+		backend := sub.backends.StickyBackend(name)
+		if backend == nil {
+			return nil
+		}
+
+		if req.Context != nil {
+			req.Context[stickyContextKey{}] = backend
+		}
+		return backend
+	}
+
+	return nil
+}
+
+// StickyCookie returns sticky cookie for backend to be set in response, nil
+// if sticky cookie is disabled or request carries one for backend already
+func (bal *BalanceGslb) StickyCookie(req *bfe_basic.Request, backend *bal_backend.BfeBackend) *bfe_http.Cookie {
+	bal.lock.Lock()
+	sc := bal.sticky
+	bal.lock.Unlock()
+
+	if sc == nil || backend == nil {
+		return nil
+	}
+
+	if back, ok := req.Context[stickyContextKey{}]; ok && back == backend {
+		return nil
+	}
+
+	return &bfe_http.Cookie{
+		Name:     *sc.conf.Name,
+		Value:    sc.encode(backend.SubCluster, backend.Name),
+		Path:     *sc.conf.Path,
+		Domain:   *sc.conf.Domain,
+		MaxAge:   *sc.conf.MaxAge,
+		Secure:   *sc.conf.Secure,
+		HttpOnly: *sc.conf.HttpOnly,
+	}
+}
@@ -53,7 +53,21 @@ func (sub *SubCluster) balance(algor int, key []byte) (*backend.BfeBackend, erro
 		return nil, fmt.Errorf("no backend in sub cluster[%s]", sub.Name)
 	}
 
-	return sub.backends.Balance(algor, key)
+	backend, err := sub.backends.Balance(algor, key)
+	if err == nil && sub.backends.InPanic() {
+		state.BalancePanic.Inc(1)
+	}
+
+	return backend, err
+}
+
+func (sub *SubCluster) balanceExclude(exclude *backend.BfeBackend) (*backend.BfeBackend, error) {
+	backend, err := sub.backends.BalanceExclude(exclude)
+	if err == nil && sub.backends.InPanic() {
+		state.BalancePanic.Inc(1)
+	}
+
+	return backend, err
 }
 
 type SubClusterList []*SubCluster
@@ -0,0 +1,99 @@
+package bal_gslb
+
+import (
+	"github.com/crud-bird/bfe/bfe_balance/bal_slb"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/sirupsen/logrus"
+)
+
+// setTiers sets priority tiers of sub clusters
+func (bal *BalanceGslb) setTiers(basic cluster_conf.GslbBasicConf) {
+	bal.tiers = make(map[string]int)
+	for i, tier := range *basic.PriorityTiers {
+		for _, name := range tier {
+			bal.tiers[name] = i
+		}
+	}
+	bal.tierNum = len(*basic.PriorityTiers)
+	bal.spillover = *basic.SpilloverThreshold
+	bal.activeTier = 0
+}
+
+// tierOf returns priority tier of sub cluster, sub clusters not in
+// conf are in an extra last tier
+func (bal *BalanceGslb) tierOf(name string) int {
+	if tier, ok := bal.tiers[name]; ok {
+		return tier
+	}
+
+	return bal.tierNum
+}
+
+// tierSubClusters returns sub clusters in the first tier in which percent
+// of available backends is not below spillover threshold. If no tier is
+// healthy enough, the first tier with available backends is used.
+func (bal *BalanceGslb) tierSubClusters() SubClusterList {
+	num := bal.tierNum + 1
+	subs := make([]SubClusterList, num)
+	avail := make([]int, num)
+	total := make([]int, num)
+
+	for _, sub := range bal.subClusters {
+		if sub.weight <= 0 {
+			continue
+		}
+
+		tier := bal.tierOf(sub.Name)
+		subAvail, subTotal := sub.backends.AvailNum()
+		if !bal.skipped[sub.Name] {
+			subs[tier] = append(subs[tier], sub)
+		}
+		avail[tier] += subAvail
+		total[tier] += subTotal
+	}
+
+	selected := -1
+	for i := 0; i < num; i++ {
+		if len(subs[i]) > 0 && total[i] > 0 && avail[i]*100 >= bal.spillover*total[i] {
+			selected = i
+			break
+		}
+	}
+	if selected < 0 {
+		for i := 0; i < num; i++ {
+			if len(subs[i]) > 0 && avail[i] > 0 {
+				selected = i
+				break
+			}
+		}
+	}
+	if selected < 0 {
+		return nil
+	}
+
+	if selected != bal.activeTier {
+		logrus.Warnf("gslb[%s]: traffic moves from tier %d to tier %d, %d/%d backends available in tier %d",
+			bal.name, bal.activeTier, selected, avail[bal.activeTier], total[bal.activeTier], bal.activeTier)
+		bal.activeTier = selected
+	}
+
+	return subs[selected]
+}
+
+// hashSubClusters selects sub cluster by hash of value and weights of subs
+func hashSubClusters(subs SubClusterList, value []byte) *SubCluster {
+	total := 0
+	for _, sub := range subs {
+		total += sub.weight
+	}
+
+	w := bal_slb.GetHash(value, uint(total))
+	for _, sub := range subs {
+		w -= sub.weight
+		if w < 0 {
+			return sub
+		}
+	}
+
+	return subs[len(subs)-1]
+}
@@ -3,8 +3,12 @@ package bal_slb
 import (
 	"github.com/crud-bird/bfe/bfe_balance/backend"
 	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+	"time"
 )
 
+// slowStartFloor is percent of weight backend starts with in slow start
+const slowStartFloor = 10
+
 type BackendRR struct {
 	weight  int
 	current int
@@ -35,3 +39,28 @@ func (backRR *BackendRR) Release() {
 func (backRR *BackendRR) MatchAddrPort(addr string, port int) bool {
 	return backRR.backend.Addr == addr && backRR.backend.Port == port
 }
+
+// effectiveWeight returns weight ramping from slowStartFloor percent to
+// configured weight within slowStart after backend recovered
+func (backRR *BackendRR) effectiveWeight(slowStart time.Duration, now time.Time) int {
+	if slowStart <= 0 || backRR.weight <= 0 {
+		return backRR.weight
+	}
+
+	recoverTime := backRR.backend.RecoverTime()
+	if recoverTime.IsZero() {
+		return backRR.weight
+	}
+
+	elapsed := now.Sub(recoverTime)
+	if elapsed >= slowStart || elapsed < 0 {
+		return backRR.weight
+	}
+
+	floor := backRR.weight * slowStartFloor / 100
+	if floor < 1 {
+		floor = 1
+	}
+
+	return floor + int(int64(backRR.weight-floor)*int64(elapsed)/int64(slowStart))
+}
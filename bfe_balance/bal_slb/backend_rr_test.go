@@ -0,0 +1,76 @@
+package bal_slb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEffectiveWeight(t *testing.T) {
+	brr := newTestBalanceRR(100)
+	backendRR := brr.backends[0]
+	now := time.Now()
+	slowStart := 100 * time.Second
+
+	// backend avail since initialized is not in slow start
+	if w := backendRR.effectiveWeight(slowStart, now); w != 100 {
+		t.Errorf("got weight %d without recover time, expect 100", w)
+	}
+
+	tests := []struct {
+		elapsed time.Duration
+		expect  int
+	}{
+		{0, 10},
+		{25 * time.Second, 32},
+		{50 * time.Second, 55},
+		{99 * time.Second, 99},
+		{100 * time.Second, 100},
+		{200 * time.Second, 100},
+		{-time.Second, 100}, // clock moved back
+	}
+	for _, tt := range tests {
+		backendRR.backend.SetRecoverTime(now.Add(-tt.elapsed))
+		if w := backendRR.effectiveWeight(slowStart, now); w != tt.expect {
+			t.Errorf("%s after recovery: got weight %d, expect %d", tt.elapsed, w, tt.expect)
+		}
+	}
+
+	// slow start disabled
+	backendRR.backend.SetRecoverTime(now)
+	if w := backendRR.effectiveWeight(0, now); w != 100 {
+		t.Errorf("got weight %d with slow start disabled, expect 100", w)
+	}
+
+	// floor is at least 1
+	backendRR.weight = 5
+	if w := backendRR.effectiveWeight(slowStart, now); w != 1 {
+		t.Errorf("got weight %d, expect 1", w)
+	}
+}
+
+func TestSlowStartTraffic(t *testing.T) {
+	brr := newTestBalanceRR(100, 100)
+	brr.SetSlowStart(100 * time.Second)
+	b0 := mustBackend(brr, "b0")
+
+	// share of b0 is weight of b0 / (weight of b0 + 100)
+	for _, tc := range []struct {
+		elapsed time.Duration
+		weight  int
+	}{
+		{0, 10},
+		{50 * time.Second, 55},
+		{100 * time.Second, 100},
+	} {
+		b0.SetRecoverTime(time.Now().Add(-tc.elapsed))
+
+		for _, algor := range []int{WrrSmooth, WrrSticky, WlcSmooth} {
+			counts := balanceCount(brr, algor, 10000)
+			share := float64(counts["b0"]) / 10000
+			if expect := float64(tc.weight) / float64(tc.weight+100); math.Abs(share-expect) > 0.03 {
+				t.Errorf("algor %d, %s after recovery: got share %.3f, expect %.3f", algor, tc.elapsed, share, expect)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package bal_slb
 
 import (
+	"errors"
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_balance/backend"
 	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
@@ -8,6 +9,7 @@ import (
 	"math/rand"
 	"sort"
 	"sync"
+	"time"
 )
 
 const (
@@ -16,8 +18,13 @@ const (
 	WrrSticky
 	WlcSimple
 	WlcSmooth
+	ConsistentHash
+	P2cEwma
 )
 
+// ErrBackendSaturated is returned if all available backends reach max conns
+var ErrBackendSaturated = errors.New("rr_bal: all available backends are saturated")
+
 type BackendList []*BackendRR
 
 func (bl *BackendList) ResetWeight() {
@@ -48,6 +55,15 @@ type BalanceRR struct {
 	backends BackendList
 	sorted   bool
 	next     int
+	maglev   maglevTable // built on demand, reset on Init/Update
+
+	slowStart time.Duration // weight of recovered backend ramps up within it
+	outlier   *outlierDetector
+
+	panicThreshold int  // percent of healthy backends below which panic mode is entered
+	panic          bool // in panic mode, unavailable backends are also used
+
+	maxConns int // max concurrent requests to a backend, 0 means no limit
 }
 
 func NewBalanceRR(name string) *BalanceRR {
@@ -63,6 +79,60 @@ func (brr *BalanceRR) Init(conf cluster_table_conf.SubClusterBackend) {
 
 	brr.sorted = false
 	brr.next = 0
+	brr.maglev = nil
+}
+
+// Backends returns all backends of sub cluster
+func (brr *BalanceRR) Backends() []*backend.BfeBackend {
+	brr.Lock()
+	defer brr.Unlock()
+
+	backends := make([]*backend.BfeBackend, 0, len(brr.backends))
+	for _, backendRR := range brr.backends {
+		backends = append(backends, backendRR.backend)
+	}
+
+	return backends
+}
+
+// Backend returns backend with given name, nil if not found
+func (brr *BalanceRR) Backend(name string) *backend.BfeBackend {
+	brr.Lock()
+	defer brr.Unlock()
+
+	for _, backendRR := range brr.backends {
+		if backendRR.backend.Name == name {
+			return backendRR.backend
+		}
+	}
+
+	return nil
+}
+
+// StickyBackend returns backend with given name if it could be selected
+// by balance, nil otherwise. Backend status, panic mode and max conns are
+// checked as in balance, and backend in slow start is returned with
+// probability of its effective weight.
+func (brr *BalanceRR) StickyBackend(name string) *backend.BfeBackend {
+	brr.checkOutliers()
+	brr.checkPanic()
+
+	brr.Lock()
+	defer brr.Unlock()
+
+	for _, backendRR := range brr.backends {
+		if backendRR.backend.Name != name {
+			continue
+		}
+
+		w := brr.weightFunc()(backendRR)
+		if w <= 0 || (w < backendRR.weight && rand.Intn(backendRR.weight) >= w) {
+			return nil
+		}
+		return backendRR.backend
+	}
+
+	return nil
 }
 
 func (brr *BalanceRR) Release() {
@@ -102,12 +172,69 @@ func (brr *BalanceRR) Update(conf cluster_table_conf.SubClusterBackend) {
 	for _, bkConf := range confMap {
 		backendRR := NewBackendRR()
 		backendRR.Init(brr.Name, bkConf)
+		backendRR.backend.SetRecoverTime(time.Now())
 		backendsNew = append(backendsNew, backendRR)
 	}
 
 	brr.backends = backendsNew
 	brr.sorted = false
 	brr.next = 0
+	brr.maglev = nil
+}
+
+// SetSlowStart sets slow start window of backends, 0 disables slow start
+func (brr *BalanceRR) SetSlowStart(slowStart time.Duration) {
+	brr.Lock()
+	brr.slowStart = slowStart
+	brr.Unlock()
+}
+
+// weightFunc returns weight of backend used in balance, 0 if backend
+// should not be used
+type weightFunc func(backendRR *BackendRR) int
+
+func (brr *BalanceRR) weightFunc() weightFunc {
+	slowStart, now, panic, maxConns := brr.slowStart, time.Now(), brr.panic, brr.maxConns
+	return func(backendRR *BackendRR) int {
+		if !panic && !backendRR.backend.Avail() {
+			return 0
+		}
+		if maxConns > 0 && backendRR.backend.ConnNum() >= maxConns {
+			return 0
+		}
+		return backendRR.effectiveWeight(slowStart, now)
+	}
+}
+
+// SetMaxConns sets max concurrent requests to a backend, 0 means no limit
+func (brr *BalanceRR) SetMaxConns(maxConns int) {
+	brr.Lock()
+	brr.maxConns = maxConns
+	brr.Unlock()
+}
+
+// saturated checks whether there are available backends, but all of
+// them reach max conns
+func (brr *BalanceRR) saturated() bool {
+	brr.Lock()
+	defer brr.Unlock()
+
+	if brr.maxConns <= 0 {
+		return false
+	}
+
+	avail := false
+	for _, backendRR := range brr.backends {
+		if backendRR.weight <= 0 || (!brr.panic && !backendRR.backend.Avail()) {
+			continue
+		}
+		if backendRR.backend.ConnNum() < brr.maxConns {
+			return false
+		}
+		avail = true
+	}
+
+	return avail
 }
 
 func (brr *BalanceRR) initWeight() {
@@ -131,6 +258,36 @@ func (brr *BalanceRR) ensureSortedUnlocked() {
 }
 
 func (brr *BalanceRR) Balance(algor int, key []byte) (*backend.BfeBackend, error) {
+	brr.checkOutliers()
+	brr.checkPanic()
+
+	backend, err := brr.balance(algor, key)
+	if err != nil && brr.saturated() {
+		return nil, ErrBackendSaturated
+	}
+
+	return backend, err
+}
+
+// BalanceExclude selects a backend other than exclude by smooth weighted
+// round robin, regardless of balance algorithm of sub cluster
+func (brr *BalanceRR) BalanceExclude(exclude *backend.BfeBackend) (*backend.BfeBackend, error) {
+	brr.checkOutliers()
+	brr.checkPanic()
+
+	brr.Lock()
+	defer brr.Unlock()
+
+	weight := brr.weightFunc()
+	return smoothBalance(brr.backends, func(backendRR *BackendRR) int {
+		if backendRR.backend == exclude {
+			return 0
+		}
+		return weight(backendRR)
+	})
+}
+
+func (brr *BalanceRR) balance(algor int, key []byte) (*backend.BfeBackend, error) {
 	switch algor {
 	case WrrSimple:
 		return brr.simpleBalance()
@@ -142,6 +299,10 @@ func (brr *BalanceRR) Balance(algor int, key []byte) (*backend.BfeBackend, error
 		return brr.leastConnsSimpleBalance()
 	case WlcSmooth:
 		return brr.leastConnsSmoothBalance()
+	case ConsistentHash:
+		return brr.consistentHashBalance(key)
+	case P2cEwma:
+		return brr.p2cEwmaBalance()
 	default:
 		return brr.smoothBalance()
 	}
@@ -151,15 +312,15 @@ func (brr *BalanceRR) smoothBalance() (*backend.BfeBackend, error) {
 	brr.Lock()
 	defer brr.Unlock()
 
-	return smoothBalance(brr.backends)
+	return smoothBalance(brr.backends, brr.weightFunc())
 }
 
-func smoothBalance(backs BackendList) (*backend.BfeBackend, error) {
+func smoothBalance(backs BackendList, weight weightFunc) (*backend.BfeBackend, error) {
 	var best *BackendRR
 	total, max := 0, 0
 	for _, backendRR := range backs {
-		backend := backendRR.backend
-		if !backend.Avail() || backendRR.weight <= 0 {
+		w := weight(backendRR)
+		if w <= 0 {
 			continue
 		}
 
@@ -169,7 +330,7 @@ func smoothBalance(backs BackendList) (*backend.BfeBackend, error) {
 		}
 		total += backendRR.current
 
-		backendRR.current += backendRR.weight
+		backendRR.current += w
 	}
 
 	if best == nil {
@@ -185,7 +346,7 @@ func (brr *BalanceRR) leastConnsSmoothBalance() (*backend.BfeBackend, error) {
 	brr.Lock()
 	defer brr.Unlock()
 
-	candidates, err := leastConnsBalance(brr.backends)
+	candidates, err := leastConnsBalance(brr.backends, brr.weightFunc())
 	if err != nil {
 		return nil, err
 	}
@@ -194,14 +355,14 @@ func (brr *BalanceRR) leastConnsSmoothBalance() (*backend.BfeBackend, error) {
 		return candidates[0].backend, nil
 	}
 
-	return smoothBalance(candidates)
+	return smoothBalance(candidates, brr.weightFunc())
 }
 
 func (brr *BalanceRR) leastConnsSimpleBalance() (*backend.BfeBackend, error) {
 	brr.Lock()
 	defer brr.Unlock()
 
-	candidates, err := leastConnsBalance(brr.backends)
+	candidates, err := leastConnsBalance(brr.backends, brr.weightFunc())
 	if err != nil {
 		return nil, err
 	}
@@ -213,13 +374,13 @@ func (brr *BalanceRR) leastConnsSimpleBalance() (*backend.BfeBackend, error) {
 	return randomBalance(candidates)
 }
 
-func leastConnsBalance(backs BackendList) (BackendList, error) {
+func leastConnsBalance(backs BackendList, weight weightFunc) (BackendList, error) {
 	var best *BackendRR
 	candidates := make(BackendList, 0, len(backs))
 
 	single := true
 	for _, backendRR := range backs {
-		if backendRR.backend.Avail() || backendRR.weight <= 0 {
+		if weight(backendRR) <= 0 {
 			continue
 		}
 
@@ -229,7 +390,7 @@ func leastConnsBalance(backs BackendList) (BackendList, error) {
 			continue
 		}
 
-		if ret := compLCWeight(best, backendRR); ret > 0 {
+		if ret := compLCWeight(best, backendRR, weight); ret > 0 {
 			best = backendRR
 			single = true
 		} else if ret == 0 {
@@ -247,11 +408,11 @@ func leastConnsBalance(backs BackendList) (BackendList, error) {
 	}
 
 	for _, backendRR := range backs {
-		if !backendRR.backend.Avail() || backendRR.weight <= 0 {
+		if weight(backendRR) <= 0 {
 			continue
 		}
 
-		if ret := compLCWeight(best, backendRR); ret == 0 {
+		if ret := compLCWeight(best, backendRR, weight); ret == 0 {
 			candidates = append(candidates, backendRR)
 		}
 	}
@@ -272,18 +433,19 @@ func (brr *BalanceRR) simpleBalance() (*backend.BfeBackend, error) {
 
 	backends := brr.backends
 	allDown := true
+	weight := brr.weightFunc()
 
 	next := brr.next
 	for {
 		backendRR = backends[next]
 		backend = backendRR.backend
 
-		avail := backend.Avail()
+		avail := weight(backendRR) > 0
 		if avail && backendRR.current > 0 {
 			break
 		}
 
-		if avail && backendRR.weight != 0 {
+		if avail {
 			allDown = false
 		}
 
@@ -308,16 +470,19 @@ func (brr *BalanceRR) simpleBalance() (*backend.BfeBackend, error) {
 
 func (brr *BalanceRR) stickyBalance(key []byte) (*backend.BfeBackend, error) {
 	candidates := make(BackendList, 0, brr.Len())
+	weights := make([]int, 0, brr.Len())
 	total := 0
 
 	brr.Lock()
 	defer brr.Unlock()
 
 	brr.ensureSortedUnlocked()
+	weight := brr.weightFunc()
 	for _, backendRR := range brr.backends {
-		if backendRR.backend.Avail() && backendRR.weight > 0 {
+		if w := weight(backendRR); w > 0 {
 			candidates = append(candidates, backendRR)
-			total += backendRR.weight
+			weights = append(weights, w)
+			total += w
 		}
 	}
 
@@ -326,8 +491,8 @@ func (brr *BalanceRR) stickyBalance(key []byte) (*backend.BfeBackend, error) {
 	}
 
 	value := GetHash(key, uint(total))
-	for _, backendRR := range candidates {
-		value -= backendRR.weight
+	for i, backendRR := range candidates {
+		value -= weights[i]
 		if value < 0 {
 			return backendRR.backend, nil
 		}
@@ -336,8 +501,72 @@ func (brr *BalanceRR) stickyBalance(key []byte) (*backend.BfeBackend, error) {
 	return nil, fmt.Errorf("rr_bal: stickyBalance fail")
 }
 
-func compLCWeight(a, b *BackendRR) int {
-	ret := a.backend.ConnNum()*b.weight - b.backend.ConnNum()*a.weight
+func (brr *BalanceRR) consistentHashBalance(key []byte) (*backend.BfeBackend, error) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	if brr.maglev == nil {
+		brr.ensureSortedUnlocked()
+		brr.maglev = newMaglevTable(brr.backends)
+	}
+	if len(brr.maglev) == 0 {
+		return nil, fmt.Errorf("rr_bal: all backends are down")
+	}
+
+	idx := brr.maglev.lookup(key, brr.backends, brr.weightFunc())
+	if idx < 0 {
+		return nil, fmt.Errorf("rr_bal: all backends are down")
+	}
+
+	return brr.backends[idx].backend, nil
+}
+
+// p2cEwmaBalance picks the cheaper of two random available backends, see p2cCost
+func (brr *BalanceRR) p2cEwmaBalance() (*backend.BfeBackend, error) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	candidates := make(BackendList, 0, len(brr.backends))
+	weights := make([]int, 0, len(brr.backends))
+	weight := brr.weightFunc()
+	for _, backendRR := range brr.backends {
+		if w := weight(backendRR); w > 0 {
+			candidates = append(candidates, backendRR)
+			weights = append(weights, w)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("rr_bal: all backends are down")
+	case 1:
+		return candidates[0].backend, nil
+	}
+
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+
+	if p2cCost(candidates[j], weights[j]) < p2cCost(candidates[i], weights[i]) {
+		i = j
+	}
+
+	return candidates[i].backend, nil
+}
+
+// p2cCost is cost of sending request to backend, based on ewma latency
+// and in-flight requests, divided by effective weight of backend
+func p2cCost(backendRR *BackendRR, weight int) float64 {
+	latency := float64(backendRR.backend.Latency()) + 1
+	inflight := float64(backendRR.backend.ConnNum()) + 1
+
+	return latency * inflight / float64(weight)
+}
+
+func compLCWeight(a, b *BackendRR, weight weightFunc) int {
+	ret := a.backend.ConnNum()*weight(b) - b.backend.ConnNum()*weight(a)
 
 	if ret > 0 {
 		return 1
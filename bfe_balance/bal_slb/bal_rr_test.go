@@ -0,0 +1,148 @@
+package bal_slb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+// newTestBalanceRR creates sub cluster sub1 with a backend of each weight,
+// backend i is named "b<i>"
+func newTestBalanceRR(weights ...int) *BalanceRR {
+	brr := NewBalanceRR("sub1")
+	brr.Init(newTestBackendConf(weights...))
+
+	return brr
+}
+
+func newTestBackendConf(weights ...int) cluster_table_conf.SubClusterBackend {
+	var conf cluster_table_conf.SubClusterBackend
+	for i, weight := range weights {
+		name, addr, port, w := fmt.Sprintf("b%d", i), "127.0.0.1", 8000+i, weight
+		conf = append(conf, &cluster_table_conf.BackendConf{Name: &name, Addr: &addr, Port: &port, Weight: &w})
+	}
+
+	return conf
+}
+
+// balanceCount balances n times by algor, and counts requests of each backend
+func balanceCount(brr *BalanceRR, algor int, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		backend, err := brr.Balance(algor, nil)
+		if err != nil {
+			counts[""]++
+			continue
+		}
+		counts[backend.Name]++
+	}
+
+	return counts
+}
+
+func mustBackend(brr *BalanceRR, name string) *backend.BfeBackend {
+	b := brr.Backend(name)
+	if b == nil {
+		panic("backend " + name + " not found")
+	}
+
+	return b
+}
+
+func TestP2cEwmaLatency(t *testing.T) {
+	brr := newTestBalanceRR(10, 10, 10)
+	mustBackend(brr, "b0").AddLatency(100 * time.Millisecond)
+	mustBackend(brr, "b1").AddLatency(time.Millisecond)
+	mustBackend(brr, "b2").AddLatency(time.Millisecond)
+
+	counts := balanceCount(brr, P2cEwma, 3000)
+	if counts["b0"] > counts["b1"]/10 || counts["b0"] > counts["b2"]/10 {
+		t.Errorf("slow backend gets too many requests: %v", counts)
+	}
+
+	// in-flight requests raise cost too
+	for i := 0; i < 200; i++ {
+		mustBackend(brr, "b1").AddConnNum()
+	}
+	counts = balanceCount(brr, P2cEwma, 3000)
+	if counts["b1"] > counts["b2"]/10 {
+		t.Errorf("busy backend gets too many requests: %v", counts)
+	}
+}
+
+func TestP2cEwmaSlowStart(t *testing.T) {
+	brr := newTestBalanceRR(10, 10, 10)
+	brr.SetSlowStart(100 * time.Second)
+	for _, backend := range brr.Backends() {
+		backend.AddLatency(time.Millisecond)
+	}
+
+	// b0 recovered just now, and has 10% of its weight
+	mustBackend(brr, "b0").SetRecoverTime(time.Now())
+	counts := balanceCount(brr, P2cEwma, 3000)
+	if counts["b0"] > counts["b1"]/5 || counts["b0"] > counts["b2"]/5 {
+		t.Errorf("warming backend gets too many requests: %v", counts)
+	}
+
+	// b0 is out of slow start window
+	mustBackend(brr, "b0").SetRecoverTime(time.Now().Add(-200 * time.Second))
+	counts = balanceCount(brr, P2cEwma, 3000)
+	if counts["b0"] < 600 {
+		t.Errorf("backend out of slow start gets too few requests: %v", counts)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	algors := []int{WrrSimple, WrrSmooth, WrrSticky, WlcSimple, WlcSmooth, ConsistentHash, P2cEwma}
+
+	brr := newTestBalanceRR(10, 10, 10)
+	brr.SetMaxConns(2)
+	b0, b1, b2 := mustBackend(brr, "b0"), mustBackend(brr, "b1"), mustBackend(brr, "b2")
+	b0.AddConnNum()
+	b0.AddConnNum()
+
+	// saturated backend is skipped
+	for _, algor := range algors {
+		for i := 0; i < 100; i++ {
+			backend, err := brr.Balance(algor, []byte(fmt.Sprintf("key%d", i)))
+			if err != nil || backend == b0 {
+				t.Errorf("algor %d: got %v, %v, expect backend other than b0", algor, backend, err)
+				break
+			}
+		}
+	}
+
+	// all available backends are saturated, down backend is not counted
+	b1.AddConnNum()
+	b1.AddConnNum()
+	b2.SetAvail(false)
+	for _, algor := range algors {
+		if backend, err := brr.Balance(algor, []byte("key")); err != ErrBackendSaturated {
+			t.Errorf("algor %d: got %v, %v, expect ErrBackendSaturated", algor, backend, err)
+		}
+	}
+
+	// not saturated if no backend is available
+	b0.SetAvail(false)
+	b1.SetAvail(false)
+	if _, err := brr.Balance(WrrSmooth, nil); err == nil || err == ErrBackendSaturated {
+		t.Errorf("got error %v with all backends down, expect no backend", err)
+	}
+
+	// backend is selected again when its conns drop
+	b0.SetAvail(true)
+	b0.DecConnNum()
+	if backend, err := brr.Balance(WrrSmooth, nil); backend != b0 {
+		t.Errorf("got %v, %v, expect b0", backend, err)
+	}
+
+	// no limit
+	b1.SetAvail(true)
+	brr.SetMaxConns(0)
+	if counts := balanceCount(brr, WrrSmooth, 100); counts["b0"] < 45 || counts["b1"] < 45 {
+		t.Errorf("got %v without max conns, expect about half to b0 and b1", counts)
+	}
+}
@@ -0,0 +1,96 @@
+package bal_slb
+
+import (
+	"github.com/spaolacci/murmur3"
+)
+
+// maglevSizes are candidates of maglev table size, which should be prime
+var maglevSizes = []int{251, 509, 1021, 2039, 4093, 8191, 16381, 32749, 65521}
+
+// maglevEntriesPerBackend is min ratio of table size to num of backends
+const maglevEntriesPerBackend = 100
+
+// maglevTable is lookup table of maglev consistent hashing. Each entry is
+// index of backend in backend list.
+type maglevTable []int32
+
+func maglevSize(backendNum int) int {
+	for _, size := range maglevSizes {
+		if size >= backendNum*maglevEntriesPerBackend {
+			return size
+		}
+	}
+
+	return maglevSizes[len(maglevSizes)-1]
+}
+
+// newMaglevTable builds lookup table for backends. Entries are assigned
+// in proportion to weight of backend, backends with weight <= 0 get none.
+func newMaglevTable(backs BackendList) maglevTable {
+	maxWeight := 0
+	for _, backendRR := range backs {
+		if backendRR.weight > maxWeight {
+			maxWeight = backendRR.weight
+		}
+	}
+	if maxWeight == 0 {
+		return nil
+	}
+
+	size := maglevSize(len(backs))
+	offsets := make([]uint64, len(backs))
+	skips := make([]uint64, len(backs))
+	next := make([]uint64, len(backs))
+	credits := make([]int, len(backs))
+	for i, backendRR := range backs {
+		name := []byte(backendRR.backend.AddrInfo)
+		offsets[i] = murmur3.Sum64WithSeed(name, 0) % uint64(size)
+		skips[i] = murmur3.Sum64WithSeed(name, 1)%uint64(size-1) + 1
+	}
+
+	table := make(maglevTable, size)
+	for i := range table {
+		table[i] = -1
+	}
+
+	filled := 0
+	for filled < size {
+		for i, backendRR := range backs {
+			if backendRR.weight <= 0 {
+				continue
+			}
+
+			// backend with max weight takes one entry each round
+			credits[i] += backendRR.weight
+			for credits[i] >= maxWeight && filled < size {
+				credits[i] -= maxWeight
+
+				for {
+					c := (offsets[i] + next[i]*skips[i]) % uint64(size)
+					next[i]++
+					if table[c] < 0 {
+						table[c] = int32(i)
+						filled++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return table
+}
+
+// lookup returns index of backend for key. If owner of key is unavailable,
+// following entries are tried, so that only keys of unavailable backends move.
+func (t maglevTable) lookup(key []byte, backs BackendList, weight weightFunc) int {
+	pos := int(murmur3.Sum64(key) % uint64(len(t)))
+	for i := 0; i < len(t); i++ {
+		idx := t[(pos+i)%len(t)]
+		if weight(backs[idx]) > 0 {
+			return int(idx)
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,102 @@
+package bal_slb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+const maglevTestKeys = 20000
+
+// maglevOwners records backend of each key
+func maglevOwners(t *testing.T, brr *BalanceRR) []string {
+	owners := make([]string, maglevTestKeys)
+	for i := range owners {
+		backend, err := brr.Balance(ConsistentHash, []byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatalf("Balance(): %s", err)
+		}
+		owners[i] = backend.Name
+	}
+
+	return owners
+}
+
+func TestMaglevBackendDown(t *testing.T) {
+	brr := newTestBalanceRR(10, 10, 10, 10, 10)
+	owners := maglevOwners(t, brr)
+
+	// keys of other backends keep their backend when b2 is down
+	mustBackend(brr, "b2").SetAvail(false)
+	moved := 0
+	for i, owner := range maglevOwners(t, brr) {
+		if owner == "b2" {
+			t.Fatalf("key-%d: unavailable backend selected", i)
+		}
+		if owners[i] != "b2" && owner != owners[i] {
+			t.Fatalf("key-%d: moved from %s to %s", i, owners[i], owner)
+		}
+		if owner != owners[i] {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Errorf("no key moved")
+	}
+
+	// keys go back when b2 recovers
+	mustBackend(brr, "b2").SetAvail(true)
+	for i, owner := range maglevOwners(t, brr) {
+		if owner != owners[i] {
+			t.Fatalf("key-%d: got %s after recovery, expect %s", i, owner, owners[i])
+		}
+	}
+}
+
+func TestMaglevBackendRemoved(t *testing.T) {
+	brr := newTestBalanceRR(10, 10, 10, 10, 10)
+	owners := maglevOwners(t, brr)
+
+	// b4 is removed, and table is rebuilt
+	brr.Update(newTestBackendConf(10, 10, 10, 10))
+	moved := 0
+	for i, owner := range maglevOwners(t, brr) {
+		if owner == "b4" {
+			t.Fatalf("key-%d: removed backend selected", i)
+		}
+		if owners[i] != "b4" && owner != owners[i] {
+			moved++
+		}
+	}
+
+	// maglev moves few keys of remaining backends
+	if ratio := float64(moved) / maglevTestKeys; ratio > 0.05 {
+		t.Errorf("%.1f%% of keys of remaining backends moved", ratio*100)
+	}
+}
+
+func TestMaglevSpread(t *testing.T) {
+	weights := []int{10, 20, 30, 40}
+	brr := newTestBalanceRR(weights...)
+
+	counts := make(map[string]int)
+	for _, owner := range maglevOwners(t, brr) {
+		counts[owner]++
+	}
+
+	for i, weight := range weights {
+		name := fmt.Sprintf("b%d", i)
+		share := float64(counts[name]) / maglevTestKeys
+		if expect := float64(weight) / 100; math.Abs(share-expect) > 0.02 {
+			t.Errorf("%s: got share %.3f, expect %.3f", name, share, expect)
+		}
+	}
+
+	// backend with weight 0 owns no key
+	brr = newTestBalanceRR(10, 0, 10)
+	for i, owner := range maglevOwners(t, brr) {
+		if owner == "b1" {
+			t.Fatalf("key-%d: backend with weight 0 selected", i)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package bal_slb
+
+import (
+	"math"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/sirupsen/logrus"
+)
+
+// outlierDetector ejects backends of sub cluster by result of live traffic
+type outlierDetector struct {
+	interval           time.Duration
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent int
+
+	consecutive5xx    int
+	consecutiveGwFail int
+
+	successRateMinHosts      int
+	successRateRequestVolume int
+	successRateStdevFactor   float64
+
+	lastCheck time.Time
+}
+
+func newOutlierDetector(conf *cluster_conf.OutlierDetection) *outlierDetector {
+	if conf == nil || !*conf.Enable {
+		return nil
+	}
+
+	return &outlierDetector{
+		interval:                 time.Duration(*conf.Interval) * time.Millisecond,
+		baseEjectionTime:         time.Duration(*conf.BaseEjectionTime) * time.Millisecond,
+		maxEjectionTime:          time.Duration(*conf.MaxEjectionTime) * time.Millisecond,
+		maxEjectionPercent:       *conf.MaxEjectionPercent,
+		consecutive5xx:           *conf.Consecutive5xx,
+		consecutiveGwFail:        *conf.ConsecutiveGatewayFailure,
+		successRateMinHosts:      *conf.SuccessRateMinHosts,
+		successRateRequestVolume: *conf.SuccessRateRequestVolume,
+		successRateStdevFactor:   float64(*conf.SuccessRateStdevFactor) / 1000,
+		lastCheck:                time.Now(),
+	}
+}
+
+// ejectionTime is base ejection time doubled on each recent ejection
+func (d *outlierDetector) ejectionTime(ejectNum int) time.Duration {
+	t := d.baseEjectionTime
+	for i := 1; i < ejectNum && t < d.maxEjectionTime; i++ {
+		t *= 2
+	}
+
+	if t > d.maxEjectionTime {
+		t = d.maxEjectionTime
+	}
+
+	return t
+}
+
+// SetOutlierDetection sets outlier detection conf of sub cluster, nil disables it
+func (brr *BalanceRR) SetOutlierDetection(conf *cluster_conf.OutlierDetection) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	brr.outlier = newOutlierDetector(conf)
+	if brr.outlier != nil {
+		return
+	}
+
+	// detection disabled, bring back all ejected backends
+	now := time.Now()
+	for _, backendRR := range brr.backends {
+		if backendRR.backend.Ejected() {
+			backendRR.backend.Uneject(now)
+		}
+	}
+}
+
+// OnResult records result of request to backend, status is 0 if no
+// response is got. Backend is ejected if it fails consecutively.
+func (brr *BalanceRR) OnResult(back *backend.BfeBackend, status int) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	d := brr.outlier
+	if d == nil {
+		return
+	}
+
+	consecutive5xx, consecutiveGwFail := back.RecordResult(status)
+	if back.Ejected() {
+		return
+	}
+
+	if d.consecutive5xx > 0 && consecutive5xx >= d.consecutive5xx {
+		brr.ejectUnlocked(back, time.Now(), "consecutive 5xx")
+	} else if d.consecutiveGwFail > 0 && consecutiveGwFail >= d.consecutiveGwFail {
+		brr.ejectUnlocked(back, time.Now(), "consecutive gateway failure")
+	}
+}
+
+// maxEjectedUnlocked returns max num of ejected backends. At least one
+// backend may be ejected and at least one backend is kept.
+func (brr *BalanceRR) maxEjectedUnlocked() int {
+	total := len(brr.backends)
+	max := total * brr.outlier.maxEjectionPercent / 100
+	if max < 1 && brr.outlier.maxEjectionPercent > 0 {
+		max = 1
+	}
+	if max > total-1 {
+		max = total - 1
+	}
+
+	return max
+}
+
+func (brr *BalanceRR) ejectUnlocked(back *backend.BfeBackend, now time.Time, reason string) bool {
+	ejected := 0
+	for _, backendRR := range brr.backends {
+		if backendRR.backend.Ejected() {
+			ejected++
+		}
+	}
+	if ejected >= brr.maxEjectedUnlocked() {
+		logrus.Debugf("outlier: backend %s in %s not ejected (%s), max ejection percent reached",
+			back.Name, brr.Name, reason)
+		return false
+	}
+
+	ejectNum := back.Eject(now)
+	logrus.Warnf("outlier: eject backend %s in %s for %s (%s)",
+		back.Name, brr.Name, brr.outlier.ejectionTime(ejectNum), reason)
+
+	return true
+}
+
+// checkOutliers brings back backends whose ejection expires, and ejects
+// backends by success rate. It runs at most once in detection interval.
+func (brr *BalanceRR) checkOutliers() {
+	brr.checkOutliersAt(time.Now())
+}
+
+func (brr *BalanceRR) checkOutliersAt(now time.Time) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	d := brr.outlier
+	if d == nil {
+		return
+	}
+
+	if now.Sub(d.lastCheck) < d.interval {
+		return
+	}
+	d.lastCheck = now
+
+	for _, backendRR := range brr.backends {
+		back := backendRR.backend
+		ejectTime, ejectNum := back.EjectState()
+		if back.Ejected() {
+			if now.Sub(ejectTime) >= d.ejectionTime(ejectNum) {
+				back.Uneject(now)
+				logrus.Infof("outlier: backend %s in %s back from ejection", back.Name, brr.Name)
+			}
+		} else if ejectNum > 0 && now.Sub(ejectTime) >= d.ejectionTime(ejectNum)+d.interval {
+			back.DecEjectNum()
+		}
+	}
+
+	brr.checkSuccessRateUnlocked(now)
+}
+
+func (brr *BalanceRR) checkSuccessRateUnlocked(now time.Time) {
+	d := brr.outlier
+
+	var backs []*backend.BfeBackend
+	var rates []float64
+	for _, backendRR := range brr.backends {
+		reqNum, succNum := backendRR.backend.ResetResult()
+		if backendRR.backend.Ejected() || reqNum < d.successRateRequestVolume {
+			continue
+		}
+
+		backs = append(backs, backendRR.backend)
+		rates = append(rates, float64(succNum)/float64(reqNum))
+	}
+
+	if d.successRateStdevFactor == 0 || len(backs) < d.successRateMinHosts {
+		return
+	}
+
+	mean := 0.0
+	for _, rate := range rates {
+		mean += rate
+	}
+	mean /= float64(len(rates))
+
+	variance := 0.0
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(rates)))
+
+	threshold := mean - stdev*d.successRateStdevFactor
+	for i, back := range backs {
+		if rates[i] < threshold {
+			brr.ejectUnlocked(back, now, "low success rate")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package bal_slb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+)
+
+// newTestOutlierConf returns conf ejecting backend on one 5xx, with interval
+// 1s, base ejection time 10s, max ejection time 60s and success rate
+// detection off
+func newTestOutlierConf(maxEjectionPercent int) *cluster_conf.OutlierDetection {
+	enable, interval, base, max, consecutive5xx, factor := true, 1000, 10000, 60000, 1, 0
+	conf := &cluster_conf.OutlierDetection{
+		Enable:                 &enable,
+		Interval:               &interval,
+		BaseEjectionTime:       &base,
+		MaxEjectionTime:        &max,
+		MaxEjectionPercent:     &maxEjectionPercent,
+		Consecutive5xx:         &consecutive5xx,
+		SuccessRateStdevFactor: &factor,
+	}
+	if err := cluster_conf.OutlierDetectionCheck(conf); err != nil {
+		panic(err)
+	}
+
+	return conf
+}
+
+func TestOutlierEjectionTime(t *testing.T) {
+	d := newOutlierDetector(newTestOutlierConf(100))
+
+	// doubles on each ejection, up to max ejection time
+	for i, expect := range []time.Duration{10, 20, 40, 60, 60} {
+		if got := d.ejectionTime(i + 1); got != expect*time.Second {
+			t.Errorf("ejection %d: got %s, expect %s", i+1, got, expect*time.Second)
+		}
+	}
+}
+
+func TestOutlierEjectAndUneject(t *testing.T) {
+	brr := newTestBalanceRR(10, 10)
+	brr.SetOutlierDetection(newTestOutlierConf(50))
+	b0 := mustBackend(brr, "b0")
+
+	now := time.Now()
+	brr.OnResult(b0, 500)
+	if !b0.Ejected() {
+		t.Fatalf("b0 not ejected after 5xx")
+	}
+	if counts := balanceCount(brr, WrrSmooth, 100); counts["b1"] != 100 {
+		t.Errorf("got %v when b0 ejected, expect all to b1", counts)
+	}
+
+	// still ejected before base ejection time
+	brr.checkOutliersAt(now.Add(9 * time.Second))
+	if !b0.Ejected() {
+		t.Errorf("b0 unejected before 10s")
+	}
+
+	brr.checkOutliersAt(now.Add(11 * time.Second))
+	if b0.Ejected() {
+		t.Fatalf("b0 still ejected after 10s")
+	}
+	if counts := balanceCount(brr, WrrSmooth, 100); counts["b0"] != 50 {
+		t.Errorf("got %v when b0 unejected, expect half to b0", counts)
+	}
+
+	// ejection time doubles on repeated ejection
+	now = time.Now()
+	brr.OnResult(b0, 502)
+	if _, ejectNum := b0.EjectState(); !b0.Ejected() || ejectNum != 2 {
+		t.Fatalf("b0 ejected %v for %d times, expect 2", b0.Ejected(), ejectNum)
+	}
+	brr.checkOutliersAt(now.Add(15 * time.Second))
+	if !b0.Ejected() {
+		t.Errorf("b0 unejected before 20s on second ejection")
+	}
+	brr.checkOutliersAt(now.Add(21 * time.Second))
+	if b0.Ejected() {
+		t.Errorf("b0 still ejected after 20s on second ejection")
+	}
+
+	// disabling detection brings back ejected backend at once
+	brr.OnResult(b0, 500)
+	brr.SetOutlierDetection(nil)
+	if b0.Ejected() {
+		t.Errorf("b0 still ejected after detection disabled")
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		weights            []int
+		maxEjectionPercent int
+		expect             int
+	}{
+		{[]int{10, 10, 10, 10, 10, 10, 10, 10, 10, 10}, 20, 2},
+		{[]int{10, 10, 10, 10, 10, 10, 10, 10, 10, 10}, 25, 2},
+		{[]int{10, 10, 10}, 10, 1},  // at least one ejected
+		{[]int{10, 10, 10}, 100, 2}, // at least one kept
+		{[]int{10}, 100, 0},
+		{[]int{10, 10, 10}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		brr := newTestBalanceRR(tt.weights...)
+		brr.SetOutlierDetection(newTestOutlierConf(tt.maxEjectionPercent))
+
+		// all backends fail
+		for i := 0; i < 3; i++ {
+			for _, back := range brr.Backends() {
+				brr.OnResult(back, 503)
+			}
+		}
+
+		ejected := 0
+		for _, back := range brr.Backends() {
+			if back.Ejected() {
+				ejected++
+			}
+		}
+		if ejected != tt.expect {
+			t.Errorf("%d backends with %d%%: got %d ejected, expect %d",
+				len(tt.weights), tt.maxEjectionPercent, ejected, tt.expect)
+		}
+	}
+}
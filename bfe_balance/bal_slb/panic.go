@@ -0,0 +1,71 @@
+package bal_slb
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// SetPanicThreshold sets percent of healthy backends below which all
+// backends are used regardless of their status, 0 disables panic mode
+func (brr *BalanceRR) SetPanicThreshold(threshold int) {
+	brr.Lock()
+	brr.panicThreshold = threshold
+	brr.Unlock()
+}
+
+// InPanic checks whether sub cluster is in panic mode
+func (brr *BalanceRR) InPanic() bool {
+	brr.Lock()
+	panic := brr.panic
+	brr.Unlock()
+
+	return panic
+}
+
+// AvailNum returns num of available backends and num of all backends,
+// backends with weight <= 0 are not counted
+func (brr *BalanceRR) AvailNum() (int, int) {
+	brr.Lock()
+	defer brr.Unlock()
+
+	return brr.availNumUnlocked()
+}
+
+func (brr *BalanceRR) availNumUnlocked() (int, int) {
+	avail, total := 0, 0
+	for _, backendRR := range brr.backends {
+		if backendRR.weight <= 0 {
+			continue
+		}
+
+		total++
+		if backendRR.backend.Avail() {
+			avail++
+		}
+	}
+
+	return avail, total
+}
+
+// checkPanic enters or leaves panic mode by percent of healthy backends
+func (brr *BalanceRR) checkPanic() {
+	brr.Lock()
+	defer brr.Unlock()
+
+	healthy, total := 0, 0
+	if brr.panicThreshold > 0 {
+		healthy, total = brr.availNumUnlocked()
+	}
+
+	panic := total > 0 && healthy*100 < brr.panicThreshold*total
+	if panic == brr.panic {
+		return
+	}
+	brr.panic = panic
+
+	if panic {
+		logrus.Warnf("rr_bal: %s enters panic mode, %d/%d backends healthy, use all backends",
+			brr.Name, healthy, total)
+	} else {
+		logrus.Infof("rr_bal: %s leaves panic mode", brr.Name)
+	}
+}
@@ -0,0 +1,74 @@
+package bal_slb
+
+import (
+	"testing"
+)
+
+func TestPanicMode(t *testing.T) {
+	brr := newTestBalanceRR(10, 10, 10, 10)
+	brr.SetPanicThreshold(50)
+
+	// 3 of 4 backends healthy, down backend is not used
+	mustBackend(brr, "b0").SetAvail(false)
+	counts := balanceCount(brr, WrrSmooth, 300)
+	if brr.InPanic() || counts["b0"] != 0 || counts[""] != 0 {
+		t.Errorf("got %v with 3/4 healthy, expect b0 not used", counts)
+	}
+
+	// 1 of 4 backends healthy, all backends are used
+	mustBackend(brr, "b1").SetAvail(false)
+	mustBackend(brr, "b2").SetAvail(false)
+	counts = balanceCount(brr, WrrSmooth, 400)
+	if !brr.InPanic() {
+		t.Errorf("not in panic mode with 1/4 healthy")
+	}
+	for _, name := range []string{"b0", "b1", "b2", "b3"} {
+		if counts[name] != 100 {
+			t.Errorf("got %v in panic mode, expect 100 to each backend", counts)
+			break
+		}
+	}
+	if back := brr.StickyBackend("b0"); back == nil {
+		t.Errorf("down backend b0 not selected by sticky in panic mode")
+	}
+
+	// back to 3 of 4 healthy, normal selection resumes
+	mustBackend(brr, "b1").SetAvail(true)
+	mustBackend(brr, "b2").SetAvail(true)
+	counts = balanceCount(brr, WrrSmooth, 300)
+	if brr.InPanic() || counts["b0"] != 0 || counts[""] != 0 {
+		t.Errorf("got %v after panic mode left, expect b0 not used", counts)
+	}
+	if back := brr.StickyBackend("b0"); back != nil {
+		t.Errorf("down backend b0 selected by sticky after panic mode left")
+	}
+}
+
+func TestPanicThreshold(t *testing.T) {
+	tests := []struct {
+		weights   []int
+		down      []string
+		threshold int
+		expect    bool
+	}{
+		{[]int{10, 10, 10, 10}, []string{"b0", "b1"}, 50, false},
+		{[]int{10, 10, 10, 10}, []string{"b0", "b1", "b2"}, 50, true},
+		{[]int{10, 10, 10, 10}, []string{"b0", "b1", "b2", "b3"}, 0, false}, // disabled
+		{[]int{10, 10, 0, 0}, []string{"b0"}, 60, true},                     // weight 0 not counted
+		{[]int{0, 0}, []string{"b0", "b1"}, 50, false},
+	}
+
+	for _, tt := range tests {
+		brr := newTestBalanceRR(tt.weights...)
+		brr.SetPanicThreshold(tt.threshold)
+		for _, name := range tt.down {
+			mustBackend(brr, name).SetAvail(false)
+		}
+
+		brr.checkPanic()
+		if got := brr.InPanic(); got != tt.expect {
+			t.Errorf("%v with %v down, threshold %d: got panic %v, expect %v",
+				tt.weights, tt.down, tt.threshold, got, tt.expect)
+		}
+	}
+}
@@ -32,11 +32,21 @@ type BalTableState struct {
 
 func NewBalTable(fetcher backend.CheckConfFetcher) *BalTable {
 	backend.SetCheckConfFetcher(fetcher)
+	return newBalTable()
+}
+
+func newBalTable() *BalTable {
 	return &BalTable{
 		balTable: make(BalMap),
 	}
 }
 
+// BalTableConfCheck checks gslb conf and cluster table conf by loading them
+// into a new table, leaving check conf fetcher of backends untouched.
+func BalTableConfCheck(gFile, cFile string) error {
+	return newBalTable().Init(gFile, cFile)
+}
+
 func (t *BalTable) BalTableConfLoad(gFile, cFile string) (gslb_conf.GslbConf, cluster_table_conf.ClusterTableConf, error) {
 	var gslbConf gslb_conf.GslbConf
 	var backendConf cluster_table_conf.ClusterTableConf
@@ -129,6 +139,9 @@ func (t *BalTable) SetGslbBasic(table *bfe_route.ClusterTable) {
 		}
 
 		bal.SetGslbBasic(*cluster.GslbBasic)
+		bal.SetOutlierDetection(cluster.OutlierConf)
+		bal.SetMaxConnsPerBackend(*cluster.BackendConf().MaxConnsPerBackend)
+		bal.ScheduleCheck()
 	}
 }
 
@@ -217,6 +230,32 @@ func (t *BalTable) GetState() *BalTableState {
 	return state
 }
 
+// BalTableBackendState is status of backends, indexed by cluster and sub cluster
+type BalTableBackendState map[string]map[string][]backend.BackendState
+
+// GetBackendState returns status of backends. Results are filtered by
+// cluster and subCluster if they are not empty.
+func (t *BalTable) GetBackendState(cluster, subCluster string) (BalTableBackendState, error) {
+	state := make(BalTableBackendState)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if cluster != "" {
+		bal, ok := t.balTable[cluster]
+		if !ok {
+			return nil, fmt.Errorf("no balancer for cluster %s", cluster)
+		}
+		state[cluster] = bal_gslb.BackendState(bal, subCluster)
+	} else {
+		for name, bal := range t.balTable {
+			state[name] = bal_gslb.BackendState(bal, subCluster)
+		}
+	}
+
+	return state, nil
+}
+
 func (t *BalTable) GetVersions() BalVersion {
 	return t.versions
 }
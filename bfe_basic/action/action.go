@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -24,17 +28,35 @@ const (
 	ActionHostSet               = "HOST_SET"                  // set host
 
 	// path actions
-	ActionPathSet        = "PATH_SET"         // set path
-	ActionPathPrefixAdd  = "PATH_PREFIX_ADD"  // add path prefix
-	ActionPathPrefixTrim = "PATH_PREFIX_TRIM" // trim path prefix
+	ActionPathSet          = "PATH_SET"           // set path
+	ActionPathPrefixAdd    = "PATH_PREFIX_ADD"    // add path prefix
+	ActionPathPrefixTrim   = "PATH_PREFIX_TRIM"   // trim path prefix
+	ActionPathRegexReplace = "PATH_REGEX_REPLACE" // replace path by regex, e.g. "^/v1/(.*)" => "/api/$1"
 
 	// query actions
 	ActionQueryAdd          = "QUERY_ADD"            // add query
 	ActionQueryDel          = "QUERY_DEL"            // del query
 	ActionQueryRename       = "QUERY_RENAME"         // rename query
 	ActionQueryDelAllExcept = "QUERY_DEL_ALL_EXCEPT" // del query except given query key
+
+	// response actions
+	ActionRspHeaderAdd = "RSP_HEADER_ADD" // add response header
+	ActionRspHeaderSet = "RSP_HEADER_SET" // set response header
+	ActionRspHeaderDel = "RSP_HEADER_DEL" // del response header
+	ActionRspCookieSet = "RSP_COOKIE_SET" // set response cookie
+	ActionRspStatusSet = "RSP_STATUS_SET" // set response status code
 )
 
+// IsResponseAction checks whether cmd should be applied to response
+func IsResponseAction(cmd string) bool {
+	switch cmd {
+	case ActionRspHeaderAdd, ActionRspHeaderSet, ActionRspHeaderDel, ActionRspCookieSet, ActionRspStatusSet:
+		return true
+	}
+
+	return false
+}
+
 type ActionFile struct {
 	Cmd    *string
 	Params []string
@@ -43,6 +65,9 @@ type ActionFile struct {
 type Action struct {
 	Cmd    string
 	Params []string
+
+	regex  *regexp.Regexp   // compiled pattern of PATH_REGEX_REPLACE
+	values []*valueTemplate // compiled params, nil if param refers no variable
 }
 
 func (ac *Action) UnmarshalJSON(data []byte) error {
@@ -60,9 +85,57 @@ func (ac *Action) UnmarshalJSON(data []byte) error {
 	ac.Cmd = *actionFile.Cmd
 	ac.Params = actionFile.Params
 
+	return ac.compile()
+}
+
+// templateParams returns index of params which may refer variables
+func templateParams(cmd string) []int {
+	switch cmd {
+	case ActionReqHeaderAdd, ActionReqHeaderSet, ActionRspHeaderAdd, ActionRspHeaderSet, ActionQueryAdd:
+		return []int{1}
+	}
+
+	return nil
+}
+
+// compile compiles regex and variables in params
+func (ac *Action) compile() error {
+	if ac.Cmd == ActionPathRegexReplace {
+		regex, err := regexp.Compile(ac.Params[0])
+		if err != nil {
+			return fmt.Errorf("invalid regex %s: %s", ac.Params[0], err)
+		}
+		ac.regex = regex
+	}
+
+	ac.values = nil
+	for _, i := range templateParams(ac.Cmd) {
+		t, err := parseTemplate(ac.Params[i])
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			continue
+		}
+
+		if ac.values == nil {
+			ac.values = make([]*valueTemplate, len(ac.Params))
+		}
+		ac.values[i] = t
+	}
+
 	return nil
 }
 
+// param returns i-th param, with variables replaced by value in req
+func (ac *Action) param(req *bfe_basic.Request, i int, escape func(string) string) string {
+	if i < len(ac.values) && ac.values[i] != nil {
+		return ac.values[i].expand(req, escape)
+	}
+
+	return ac.Params[i]
+}
+
 func (ac *Action) Check(allowAction map[string]bool) error {
 	cmd := ac.Cmd
 	if _, ok := allowAction[cmd]; !ok {
@@ -75,9 +148,9 @@ func (ac *Action) Check(allowAction map[string]bool) error {
 func (ac *Action) Do(req *bfe_basic.Request) error {
 	switch ac.Cmd {
 	case ActionReqHeaderAdd:
-		req.HttpRequest.Header.Add(ac.Params[0], ac.Params[1])
+		req.HttpRequest.Header.Add(ac.Params[0], ac.param(req, 1, nil))
 	case ActionReqHeaderSet:
-		req.HttpRequest.Header.Set(ac.Params[0], ac.Params[1])
+		req.HttpRequest.Header.Set(ac.Params[0], ac.param(req, 1, nil))
 	case ActionReqHeaderDel:
 		req.HttpRequest.Header.Del(ac.Params[0])
 
@@ -92,9 +165,18 @@ func (ac *Action) Do(req *bfe_basic.Request) error {
 		ReqPathPrefixAdd(req, ac.Params[0])
 	case ActionPathPrefixTrim:
 		ReqPathPrefixTrim(req, ac.Params[0])
+	case ActionPathRegexReplace:
+		regex := ac.regex
+		if regex == nil {
+			var err error
+			if regex, err = regexp.Compile(ac.Params[0]); err != nil {
+				return fmt.Errorf("invalid regex %s: %s", ac.Params[0], err)
+			}
+		}
+		ReqPathRegexReplace(req, regex, ac.Params[1])
 
 	case ActionQueryAdd:
-		ReqQueryAdd(req, ac.Params)
+		ReqQueryAdd(req, []string{ac.Params[0], ac.param(req, 1, url.QueryEscape)})
 	case ActionQueryRename:
 		ReqQueryRename(req, ac.Params[0], ac.Params[1])
 	case ActionQueryDel:
@@ -110,6 +192,30 @@ func (ac *Action) Do(req *bfe_basic.Request) error {
 	return nil
 }
 
+// DoResponse applies response action to res
+func (ac *Action) DoResponse(req *bfe_basic.Request, res *bfe_http.Response) error {
+	if res == nil {
+		return fmt.Errorf("nil response")
+	}
+
+	switch ac.Cmd {
+	case ActionRspHeaderAdd:
+		res.Header.Add(ac.Params[0], ac.param(req, 1, nil))
+	case ActionRspHeaderSet:
+		res.Header.Set(ac.Params[0], ac.param(req, 1, nil))
+	case ActionRspHeaderDel:
+		res.Header.Del(ac.Params[0])
+	case ActionRspCookieSet:
+		RspCookieSet(res, ac.Params)
+	case ActionRspStatusSet:
+		RspStatusSet(res, ac.Params[0])
+	default:
+		return fmt.Errorf("unkown response cmd[%s]", ac.Cmd)
+	}
+
+	return nil
+}
+
 const HeaderPrefix = "X-BFE-"
 
 func ActionFileCheck(conf ActionFile) error {
@@ -133,10 +239,22 @@ func ActionFileCheck(conf ActionFile) error {
 		paramsLenCheck = 1
 	case ActionPathSet, ActionPathPrefixAdd, ActionPathPrefixTrim:
 		paramsLenCheck = 1
+	case ActionPathRegexReplace:
+		paramsLenCheck = 2
 	case ActionQueryAdd, ActionQueryRename:
 		paramsLenCheck = 2
 	case ActionQueryDel, ActionQueryDelAllExcept:
 		paramsLenCheck = -1
+	case ActionRspHeaderAdd, ActionRspHeaderSet:
+		paramsLenCheck = 2
+	case ActionRspHeaderDel, ActionRspStatusSet:
+		paramsLenCheck = 1
+	case ActionRspCookieSet:
+		// name, value, [max-age, [path, [domain]]]
+		if len(conf.Params) < 2 || len(conf.Params) > 5 {
+			return fmt.Errorf("num of params:[ok:2~5, now:%d]", len(conf.Params))
+		}
+		paramsLenCheck = -1
 	default:
 		return fmt.Errorf("invalid cmd[%s]", *conf.Cmd)
 	}
@@ -158,5 +276,32 @@ func ActionFileCheck(conf ActionFile) error {
 		}
 	}
 
+	for _, i := range templateParams(*conf.Cmd) {
+		if _, err := parseTemplate(conf.Params[i]); err != nil {
+			return err
+		}
+	}
+
+	switch *conf.Cmd {
+	case ActionPathRegexReplace:
+		if _, err := regexp.Compile(conf.Params[0]); err != nil {
+			return fmt.Errorf("invalid regex %s: %s", conf.Params[0], err)
+		}
+	case ActionRspStatusSet:
+		code, err := strconv.Atoi(conf.Params[0])
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code %s", conf.Params[0])
+		}
+	case ActionRspCookieSet:
+		if !bfe_http.IsCookieNameValid(conf.Params[0]) {
+			return fmt.Errorf("invalid cookie name %s", conf.Params[0])
+		}
+		if len(conf.Params) > 2 {
+			if _, err := strconv.Atoi(conf.Params[2]); err != nil {
+				return fmt.Errorf("invalid cookie max-age %s", conf.Params[2])
+			}
+		}
+	}
+
 	return nil
 }
@@ -2,6 +2,7 @@ package action
 
 import (
 	"github.com/crud-bird/bfe/bfe_basic"
+	"regexp"
 	"strings"
 )
 
@@ -31,3 +32,9 @@ func ReqPathPrefixTrim(req *bfe_basic.Request, prefix string) {
 	}
 	httpReq.URL.Path = pathStr
 }
+
+// ReqPathRegexReplace replaces path matched by regex with repl, in which
+// $1 is expanded to first submatch
+func ReqPathRegexReplace(req *bfe_basic.Request, regex *regexp.Regexp, repl string) {
+	req.HttpRequest.URL.Path = regex.ReplaceAllString(req.HttpRequest.URL.Path, repl)
+}
@@ -31,7 +31,7 @@ func queryDump(queries url.Values) string {
 func ReqQueryAdd(req *bfe_basic.Request, params []string) {
 	var addQueryString string
 	queries := queryParse(req)
-	pairNum := len(params)
+	pairNum := len(params) / 2
 
 	for i := 0; i < pairNum; i++ {
 		key := params[2*i]
@@ -0,0 +1,39 @@
+package action
+
+import (
+	"strconv"
+
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+// RspCookieSet adds Set-Cookie header to response.
+// params: name, value, [max-age, [path, [domain]]]
+func RspCookieSet(res *bfe_http.Response, params []string) {
+	cookie := &bfe_http.Cookie{
+		Name:  params[0],
+		Value: params[1],
+	}
+
+	if len(params) > 2 {
+		maxAge, _ := strconv.Atoi(params[2])
+		if maxAge < 0 {
+			maxAge = -1
+		}
+		cookie.MaxAge = maxAge
+	}
+	if len(params) > 3 {
+		cookie.Path = params[3]
+	}
+	if len(params) > 4 {
+		cookie.Domain = params[4]
+	}
+
+	res.Header.Add("Set-Cookie", cookie.String())
+}
+
+func RspStatusSet(res *bfe_http.Response, status string) {
+	code, _ := strconv.Atoi(status)
+
+	res.StatusCode = code
+	res.Status = strconv.Itoa(code) + " " + bfe_http.StatusText(code)
+}
@@ -0,0 +1,127 @@
+package action
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+)
+
+// varFetcher fetches value of request variable
+type varFetcher func(req *bfe_basic.Request) string
+
+// valueTemplate is action param which may refer request variables, e.g.
+// "%{client_ip}", "%{host}", "%{query:foo}", "%{cookie:bar}", "%{tag:x}"
+type valueTemplate struct {
+	literals []string     // literals[i] is followed by vars[i]
+	vars     []varFetcher // len(vars) == len(literals) - 1
+}
+
+func newVarFetcher(name string) (varFetcher, error) {
+	key := ""
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, key = name[:i], name[i+1:]
+	}
+
+	switch name {
+	case "client_ip":
+		if key == "" {
+			return clientIP, nil
+		}
+	case "host":
+		if key == "" {
+			return host, nil
+		}
+	case "query":
+		if key != "" {
+			return func(req *bfe_basic.Request) string {
+				return queryParse(req).Get(key)
+			}, nil
+		}
+	case "cookie":
+		if key != "" {
+			return func(req *bfe_basic.Request) string {
+				if cookie, ok := req.Cookie(key); ok {
+					return cookie.Value
+				}
+				return ""
+			}, nil
+		}
+	case "tag":
+		if key != "" {
+			return func(req *bfe_basic.Request) string {
+				return strings.Join(req.GetTags(key), ",")
+			}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown variable %s", name)
+	}
+
+	return nil, fmt.Errorf("invalid key for variable %s", name)
+}
+
+func clientIP(req *bfe_basic.Request) string {
+	if req.ClientAddr != nil {
+		return req.ClientAddr.IP.String()
+	}
+	if req.RemoteAddr != nil {
+		return req.RemoteAddr.IP.String()
+	}
+
+	return ""
+}
+
+func host(req *bfe_basic.Request) string {
+	return req.HttpRequest.Host
+}
+
+// parseTemplate compiles value into template. nil is returned if value
+// refers no variable.
+func parseTemplate(value string) (*valueTemplate, error) {
+	if !strings.Contains(value, "%{") {
+		return nil, nil
+	}
+
+	t := &valueTemplate{}
+	for {
+		start := strings.Index(value, "%{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("variable in %s not terminated by }", value)
+		}
+		end += start
+
+		fetcher, err := newVarFetcher(value[start+2 : end])
+		if err != nil {
+			return nil, err
+		}
+
+		t.literals = append(t.literals, value[:start])
+		t.vars = append(t.vars, fetcher)
+		value = value[end+1:]
+	}
+	t.literals = append(t.literals, value)
+
+	return t, nil
+}
+
+// expand replaces variables with their values in req. escape is applied
+// on value of variables if not nil.
+func (t *valueTemplate) expand(req *bfe_basic.Request, escape func(string) string) string {
+	var b strings.Builder
+	for i, fetch := range t.vars {
+		b.WriteString(t.literals[i])
+
+		value := fetch(req)
+		if escape != nil {
+			value = escape(value)
+		}
+		b.WriteString(value)
+	}
+	b.WriteString(t.literals[len(t.literals)-1])
+
+	return b.String()
+}
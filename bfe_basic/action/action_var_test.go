@@ -0,0 +1,158 @@
+package action
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+func newTestRequest(t *testing.T, rawurl string) *bfe_basic.Request {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hreq := &bfe_http.Request{
+		Method: "GET",
+		URL:    u,
+		Host:   u.Host,
+		Header: bfe_http.Header{"Cookie": {"bar=b1; other=o1"}},
+	}
+	req := bfe_basic.NewRequest(hreq, nil, nil, nil, nil)
+	req.ClientAddr = &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1234}
+	req.AddTags("x", []string{"t1", "t2"})
+
+	return req
+}
+
+func loadAction(t *testing.T, data string) Action {
+	var ac Action
+	if err := json.Unmarshal([]byte(data), &ac); err != nil {
+		t.Fatalf("load action %s: %s", data, err)
+	}
+
+	return ac
+}
+
+func TestActionVars(t *testing.T) {
+	cases := []struct {
+		value  string
+		expect string
+	}{
+		{"%{client_ip}", "10.1.2.3"},
+		{"%{host}", "example.org"},
+		{"%{query:foo}", "f 1"},
+		{"%{query:none}", ""},
+		{"%{cookie:bar}", "b1"},
+		{"%{cookie:none}", ""},
+		{"%{tag:x}", "t1,t2"},
+		{"%{tag:none}", ""},
+		{"literal", "literal"},
+		{"ip=%{client_ip};host=%{host}!", "ip=10.1.2.3;host=example.org!"},
+	}
+
+	for _, c := range cases {
+		ac := loadAction(t, `{"Cmd":"REQ_HEADER_SET","Params":["X-Bfe-Var",`+jsonString(c.value)+`]}`)
+		req := newTestRequest(t, "http://example.org/a?foo=f+1")
+		if err := ac.Do(req); err != nil {
+			t.Fatalf("%s: %s", c.value, err)
+		}
+		if got := req.HttpRequest.Header.Get("X-Bfe-Var"); got != c.expect {
+			t.Errorf("%s: got %q, expect %q", c.value, got, c.expect)
+		}
+	}
+}
+
+func TestActionVarClientIPFallback(t *testing.T) {
+	ac := loadAction(t, `{"Cmd":"REQ_HEADER_SET","Params":["X-Bfe-Ip","%{client_ip}"]}`)
+
+	req := newTestRequest(t, "http://example.org/")
+	req.ClientAddr = nil
+	req.RemoteAddr = &net.TCPAddr{IP: net.ParseIP("10.0.0.1")}
+	ac.Do(req)
+	if got := req.HttpRequest.Header.Get("X-Bfe-Ip"); got != "10.0.0.1" {
+		t.Errorf("got %q, expect address of connection", got)
+	}
+}
+
+func TestActionVarInvalid(t *testing.T) {
+	for _, value := range []string{
+		"%{client_ip",
+		"%{unknown}",
+		"%{client_ip:x}",
+		"%{host:x}",
+		"%{query}",
+		"%{query:}",
+		"%{cookie}",
+		"%{tag}",
+	} {
+		var ac Action
+		data := `{"Cmd":"REQ_HEADER_ADD","Params":["X-Bfe-Var",` + jsonString(value) + `]}`
+		if err := json.Unmarshal([]byte(data), &ac); err == nil {
+			t.Errorf("%s: expect error", value)
+		}
+	}
+}
+
+func TestResponseActionVars(t *testing.T) {
+	ac := loadAction(t, `{"Cmd":"RSP_HEADER_ADD","Params":["X-Tag","%{tag:x}"]}`)
+	req := newTestRequest(t, "http://example.org/")
+	res := &bfe_http.Response{Header: make(bfe_http.Header)}
+	if err := ac.DoResponse(req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Header.Get("X-Tag"); got != "t1,t2" {
+		t.Errorf("got %q, expect %q", got, "t1,t2")
+	}
+}
+
+func TestQueryAddVars(t *testing.T) {
+	ac := loadAction(t, `{"Cmd":"QUERY_ADD","Params":["from","%{cookie:bar}-%{query:foo}"]}`)
+	req := newTestRequest(t, "http://example.org/a?foo=f+1")
+	if err := ac.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// value of variables are escaped
+	if got, expect := req.HttpRequest.URL.RawQuery, "foo=f+1&from=b1-f+1"; got != expect {
+		t.Errorf("got %q, expect %q", got, expect)
+	}
+}
+
+func TestPathRegexReplace(t *testing.T) {
+	cases := []struct {
+		params string
+		path   string
+		expect string
+	}{
+		{`["^/v1/(.*)$", "/api/$1"]`, "/v1/users/1", "/api/users/1"},
+		{`["^/v1/(.*)$", "/api/$1"]`, "/v2/users/1", "/v2/users/1"},
+		{`["^/(\\w+)/(\\w+)$", "/$2/$1"]`, "/a/b", "/b/a"},
+		{`["/old/", "/new/"]`, "/old/x/old/", "/new/x/new/"},
+	}
+
+	for _, c := range cases {
+		ac := loadAction(t, `{"Cmd":"PATH_REGEX_REPLACE","Params":`+c.params+`}`)
+		req := newTestRequest(t, "http://example.org"+c.path)
+		if err := ac.Do(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.HttpRequest.URL.Path; got != c.expect {
+			t.Errorf("%s on %s: got %q, expect %q", c.params, c.path, got, c.expect)
+		}
+	}
+
+	var ac Action
+	if err := json.Unmarshal([]byte(`{"Cmd":"PATH_REGEX_REPLACE","Params":["(", "/"]}`), &ac); err == nil {
+		t.Errorf("invalid regex should be rejected")
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
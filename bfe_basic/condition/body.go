@@ -0,0 +1,177 @@
+package condition
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+)
+
+// DefaultBodyPeekLimit is default max bytes of request body peeked by body primitives
+const DefaultBodyPeekLimit = 64 * 1024
+
+// bodyPeekLimit is max bytes of request body peeked by body primitives
+var bodyPeekLimit = DefaultBodyPeekLimit
+
+// SetBodyPeekLimit sets max bytes of request body peeked by body primitives.
+// Body primitives never match if limit <= 0.
+func SetBodyPeekLimit(limit int) {
+	bodyPeekLimit = limit
+}
+
+type bodyContextKey int
+
+const (
+	jsonBodyKey bodyContextKey = iota
+	formBodyKey
+)
+
+func peekBody(req *bfe_basic.Request) ([]byte, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req.PeekBody(bodyPeekLimit)
+}
+
+// bodyTruncated checks whether body is only part of request body
+func bodyTruncated(req *bfe_basic.Request, body []byte) bool {
+	if req.HttpRequest.ContentLength >= 0 {
+		return req.HttpRequest.ContentLength > int64(len(body))
+	}
+
+	return len(body) >= bodyPeekLimit
+}
+
+// BodyFetcher fetches peeked request body
+type BodyFetcher struct{}
+
+func (bf *BodyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	body, err := peekBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(body), nil
+}
+
+// BodyJsonValueFetcher fetches value in json body by path, e.g. "operationName",
+// "params.0.method". Body which is larger than peek limit is not parsed.
+type BodyJsonValueFetcher struct {
+	path []string
+}
+
+func NewBodyJsonValueFetcher(path string) (*BodyJsonValueFetcher, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("json path is empty")
+	}
+
+	return &BodyJsonValueFetcher{path: strings.Split(path, ".")}, nil
+}
+
+func jsonBody(req *bfe_basic.Request) (interface{}, error) {
+	if v := req.GetContext(jsonBodyKey); v != nil {
+		return v, nil
+	}
+
+	body, err := peekBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("fetcher: invalid json body: %s", err)
+	}
+	req.SetContext(jsonBodyKey, value)
+
+	return value, nil
+}
+
+func (bf *BodyJsonValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	value, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range bf.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("fetcher: json index %s out of range", key)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("fetcher: json path %s not found", strings.Join(bf.path, "."))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	return nil, fmt.Errorf("fetcher: json path %s is not a scalar value", strings.Join(bf.path, "."))
+}
+
+// BodyFormValueFetcher fetches value of key in form body, only body with
+// content type application/x-www-form-urlencoded is parsed
+type BodyFormValueFetcher struct {
+	key string
+}
+
+func formBody(req *bfe_basic.Request) (url.Values, error) {
+	if v, ok := req.GetContext(formBodyKey).(url.Values); ok {
+		return v, nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.HttpRequest.Header.Get("Content-Type"))
+	if contentType != "application/x-www-form-urlencoded" {
+		return nil, fmt.Errorf("fetcher: not form body")
+	}
+
+	body, err := peekBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if bodyTruncated(req, body) {
+		return nil, fmt.Errorf("fetcher: form body larger than peek limit")
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("fetcher: invalid form body: %s", err)
+	}
+	req.SetContext(formBodyKey, values)
+
+	return values, nil
+}
+
+func (bf *BodyFormValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	values, err := formBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := values[bf.key]
+	if !ok || len(value) == 0 {
+		return nil, fmt.Errorf("fetcher: form key %s not found", bf.key)
+	}
+
+	return value[0], nil
+}
@@ -0,0 +1,139 @@
+package condition
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+// closeRecorder records whether body is closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newBodyTestRequest(body string, contentLength int64, contentType string) (*bfe_basic.Request, *closeRecorder) {
+	rc := &closeRecorder{Reader: strings.NewReader(body)}
+	hreq := &bfe_http.Request{
+		Method:        "POST",
+		Header:        bfe_http.Header{"Content-Type": {contentType}},
+		Body:          rc,
+		ContentLength: contentLength,
+	}
+
+	return bfe_basic.NewRequest(hreq, nil, nil, nil, nil), rc
+}
+
+func withBodyPeekLimit(t *testing.T, limit int) {
+	SetBodyPeekLimit(limit)
+	t.Cleanup(func() { SetBodyPeekLimit(DefaultBodyPeekLimit) })
+}
+
+func TestBodyPeekLimit(t *testing.T) {
+	withBodyPeekLimit(t, 16)
+
+	// "target" is after the first 16 bytes
+	body := "0123456789abcdef-target"
+	tests := []struct {
+		cond   string
+		expect bool
+	}{
+		{`req_body_contain("0123", false)`, true},
+		{`req_body_contain("ABCDEF", true)`, true},
+		{`req_body_contain("target", false)`, false},
+	}
+
+	for _, tt := range tests {
+		cond, err := Build(tt.cond)
+		if err != nil {
+			t.Fatalf("Build(%s): %s", tt.cond, err)
+		}
+
+		req, _ := newBodyTestRequest(body, int64(len(body)), "text/plain")
+		if got := cond.Match(req); got != tt.expect {
+			t.Errorf("%s: got %v, expect %v", tt.cond, got, tt.expect)
+		}
+		if len(req.ReqBody) != 16 {
+			t.Errorf("%s: %d bytes peeked, expect 16", tt.cond, len(req.ReqBody))
+		}
+	}
+
+	// body primitives never match if peeking is disabled
+	withBodyPeekLimit(t, 0)
+	cond, _ := Build(`req_body_contain("0123", false)`)
+	req, _ := newBodyTestRequest(body, int64(len(body)), "text/plain")
+	if cond.Match(req) {
+		t.Errorf("body matched with peek limit 0")
+	}
+}
+
+func TestBodyTruncated(t *testing.T) {
+	withBodyPeekLimit(t, 16)
+
+	// body larger than peek limit is not parsed, with or without content length
+	tests := []struct {
+		cond          string
+		body          string
+		contentLength int64
+		contentType   string
+		expect        bool
+	}{
+		{`req_body_form_value_in("a", "1")`, "a=1&b=2", 7, "application/x-www-form-urlencoded", true},
+		{`req_body_form_value_in("a", "1")`, "a=1&b=2", -1, "application/x-www-form-urlencoded", true},
+		{`req_body_form_value_in("a", "1")`, "a=1&b=0123456789", 16, "application/x-www-form-urlencoded", true},
+		{`req_body_form_value_in("a", "1")`, "a=1&b=0123456789abc", 19, "application/x-www-form-urlencoded", false},
+		{`req_body_form_value_in("a", "1")`, "a=1&b=0123456789abc", -1, "application/x-www-form-urlencoded", false},
+		{`req_body_form_value_in("a", "1")`, "a=1", 3, "text/plain", false},
+		{`req_body_json_value_in("a.0", "1")`, `{"a":[1,2]}`, 11, "application/json", true},
+		{`req_body_json_value_in("a.0", "1")`, `{"a":[1,2],"b":"0123"}`, 22, "application/json", false},
+	}
+
+	for _, tt := range tests {
+		cond, err := Build(tt.cond)
+		if err != nil {
+			t.Fatalf("Build(%s): %s", tt.cond, err)
+		}
+
+		req, _ := newBodyTestRequest(tt.body, tt.contentLength, tt.contentType)
+		if got := cond.Match(req); got != tt.expect {
+			t.Errorf("%s with body %q: got %v, expect %v", tt.cond, tt.body, got, tt.expect)
+		}
+	}
+}
+
+func TestBodyUnchangedAfterPeek(t *testing.T) {
+	withBodyPeekLimit(t, 16)
+
+	body := strings.Repeat("0123456789", 10)
+	req, rc := newBodyTestRequest(body, int64(len(body)), "text/plain")
+
+	// body is peeked once by conditions matched in order
+	for _, condStr := range []string{`req_body_contain("0123", false)`, `req_body_contain("4567", false)`} {
+		cond, _ := Build(condStr)
+		if !cond.Match(req) {
+			t.Errorf("%s: not matched", condStr)
+		}
+	}
+
+	data, err := ioutil.ReadAll(req.HttpRequest.Body)
+	if err != nil {
+		t.Fatalf("read body: %s", err)
+	}
+	if string(data) != body {
+		t.Errorf("got body %q, expect %q", data, body)
+	}
+
+	req.HttpRequest.Body.Close()
+	if !rc.closed {
+		t.Errorf("original body not closed")
+	}
+}
@@ -1,16 +1,247 @@
 package condition
 
 import (
-	"github.com/crud-bird/bfe/bfe_basic"
+	"fmt"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_basic/condition/parser"
+	"github.com/crud-bird/bfe/bfe_http"
 )
 
-func Build(str string) (Condition, error) {
-	// todo
-	return &Tmp{}, nil
+// Build parses condition expression and compiles it into condition
+func Build(condStr string) (Condition, error) {
+	return BuildWithVars("", condStr, nil)
+}
+
+// BuildWithVars builds condition expression which may refer variables in vars,
+// name identifies the expression in error messages
+func BuildWithVars(name string, condStr string, vars *parser.VarTable) (Condition, error) {
+	return BuildWithContext(&BuildContext{}, name, condStr, vars)
+}
+
+// BuildContext holds what conditions depend on besides request
+type BuildContext struct {
+	// Now returns current time for time primitives, time.Now if nil
+	Now func() time.Time
+}
+
+func (ctx *BuildContext) now() func() time.Time {
+	if ctx.Now == nil {
+		return time.Now
+	}
+
+	return ctx.Now
 }
 
-type Tmp struct{}
+// BuildWithContext builds condition expression like BuildWithVars, with
+// dependencies of conditions taken from ctx
+func BuildWithContext(ctx *BuildContext, name string, condStr string, vars *parser.VarTable) (Condition, error) {
+	node, err := parser.ParseWithVars(name, condStr, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return build(ctx, node)
+}
+
+func build(ctx *BuildContext, node parser.Node) (Condition, error) {
+	switch n := node.(type) {
+	case *parser.CallExpr:
+		return buildPrimitive(ctx, n)
+	case *parser.UnaryExpr:
+		cond, err := build(ctx, n.X)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryCond{op: n.Op, cond: cond}, nil
+	case *parser.BinaryExpr:
+		lc, err := build(ctx, n.X)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := build(ctx, n.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryCond{op: n.Op, lc: lc, rc: rc}, nil
+	case *parser.ParenExpr:
+		return build(ctx, n.X)
+	default:
+		return nil, fmt.Errorf("unsupported node %T", node)
+	}
+}
+
+func buildPrimitive(ctx *BuildContext, node *parser.CallExpr) (Condition, error) {
+	var fetcher Fetcher
+	var matcher Matcher
+	var err error
+
+	args := node.Args
+	switch node.Fun.Name {
+	case "default_t":
+		return &DefaultTrueCond{}, nil
+	case "req_cip_trusted":
+		fetcher = &TrustedCIPFetcher{}
+		matcher = &BoolMatcher{value: true}
+	case "req_vip_in":
+		fetcher = &VIPFetcher{}
+		matcher, err = NewIpInMatcher(args[0].Value)
+	case "req_proto_match":
+		fetcher = &ProtoFetcher{}
+		matcher = NewInMatcher(args[0].Value, true)
+	case "req_proto_secure":
+		fetcher = &SecureFetcher{}
+		matcher = &BoolMatcher{value: true}
+	case "req_host_in":
+		fetcher = &HostFetcher{}
+		matcher = NewInMatcher(args[0].Value, true)
+	case "req_host_regmatch":
+		fetcher = &HostFetcher{}
+		matcher, err = NewRegMatcher(args[0].Value)
+	case "req_path_in":
+		fetcher = &PathFetcher{}
+		matcher = NewInMatcher(args[0].Value, args[1].ToBool())
+	case "req_path_prefix_in":
+		fetcher = &PathFetcher{}
+		matcher = NewPrefixInMatcher(args[0].Value, args[1].ToBool())
+	case "req_path_suffix_in":
+		fetcher = &PathFetcher{}
+		matcher = NewSuffixInMatcher(args[0].Value, args[1].ToBool())
+	case "req_path_regmatch":
+		fetcher = &PathFetcher{}
+		matcher, err = NewRegMatcher(args[0].Value)
+	case "req_query_key_prefix_in":
+		fetcher = &QueryKeyFetcher{}
+		matcher = NewPrefixInMatcher(args[0].Value, false)
+	case "req_query_key_in":
+		fetcher = &QueryKeyFetcher{}
+		matcher = NewInMatcher(args[0].Value, false)
+	case "req_query_exist":
+		fetcher = &QueryExistFetcher{}
+		matcher = &BoolMatcher{value: true}
+	case "req_query_value_in":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher = NewInMatcher(args[1].Value, args[2].ToBool())
+	case "req_query_value_prefix_in":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher = NewPrefixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_query_value_suffix_in":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher = NewSuffixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_query_value_regmatch":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher, err = NewRegMatcher(args[1].Value)
+	case "req_query_value_contain":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher = NewContainMatcher(args[1].Value, args[2].ToBool())
+	case "req_query_value_hash_in":
+		fetcher = &QueryValueFetcher{key: args[0].Value}
+		matcher, err = NewHashMatcher(args[1].Value, args[2].ToBool())
+	case "req_url_regmatch":
+		fetcher = &UrlFetcher{}
+		matcher, err = NewRegMatcher(args[0].Value)
+	case "req_cookie_key_in":
+		fetcher = &CookieKeyFetcher{}
+		matcher = NewInMatcher(args[0].Value, false)
+	case "req_cookie_value_in":
+		fetcher = &CookieValueFetcher{key: args[0].Value}
+		matcher = NewInMatcher(args[1].Value, args[2].ToBool())
+	case "req_cookie_value_prefix_in":
+		fetcher = &CookieValueFetcher{key: args[0].Value}
+		matcher = NewPrefixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_cookie_value_suffix_in":
+		fetcher = &CookieValueFetcher{key: args[0].Value}
+		matcher = NewSuffixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_cookie_value_contain":
+		fetcher = &CookieValueFetcher{key: args[0].Value}
+		matcher = NewContainMatcher(args[1].Value, args[2].ToBool())
+	case "req_cookie_value_hash_in":
+		fetcher = &CookieValueFetcher{key: args[0].Value}
+		matcher, err = NewHashMatcher(args[1].Value, args[2].ToBool())
+	case "req_port_in":
+		fetcher = &PortFetcher{}
+		matcher = NewInMatcher(args[0].Value, false)
+	case "req_tag_match":
+		fetcher = &TagFetcher{key: args[0].Value}
+		matcher = NewInMatcher(args[1].Value, false)
+	case "req_ua_regmatch":
+		fetcher = &UAFetcher{}
+		matcher, err = NewRegMatcher(args[0].Value)
+	case "req_header_key_in":
+		fetcher = &HeaderKeyFetcher{}
+		matcher = NewInMatcher(args[0].Value, true)
+	case "req_header_value_in":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher = NewInMatcher(args[1].Value, args[2].ToBool())
+	case "req_header_value_prefix_in":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher = NewPrefixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_header_value_suffix_in":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher = NewSuffixInMatcher(args[1].Value, args[2].ToBool())
+	case "req_header_value_regmatch":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher, err = NewRegMatcher(args[1].Value)
+	case "req_header_value_contain":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher = NewContainMatcher(args[1].Value, args[2].ToBool())
+	case "req_header_value_hash_in":
+		fetcher = &HeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher, err = NewHashMatcher(args[1].Value, args[2].ToBool())
+	case "req_method_in":
+		fetcher = &MethodFetcher{}
+		matcher = NewInMatcher(args[0].Value, true)
+	case "req_cip_range":
+		fetcher = &CIPFetcher{}
+		matcher, err = NewIpRangeMatcher(args[0].Value, args[1].Value)
+	case "req_vip_range", "ses_vip_range":
+		fetcher = &VIPFetcher{}
+		matcher, err = NewIpRangeMatcher(args[0].Value, args[1].Value)
+	case "req_cip_hash_in":
+		fetcher = &CIPFetcher{}
+		matcher, err = NewHashMatcher(args[0].Value, false)
+	case "res_code_in":
+		fetcher = &ResCodeFetcher{}
+		matcher = NewInMatcher(args[0].Value, false)
+	case "res_header_key_in":
+		fetcher = &ResHeaderKeyFetcher{}
+		matcher = NewInMatcher(args[0].Value, true)
+	case "res_header_value_in":
+		fetcher = &ResHeaderValueFetcher{key: bfe_http.CanonicalHeaderKey(args[0].Value)}
+		matcher = NewInMatcher(args[1].Value, args[2].ToBool())
+	case "ses_sip_range":
+		fetcher = &SIPFetcher{}
+		matcher, err = NewIpRangeMatcher(args[0].Value, args[1].Value)
+	case "req_body_contain":
+		fetcher = &BodyFetcher{}
+		matcher = NewContainMatcher(args[0].Value, args[1].ToBool())
+	case "req_body_json_value_in":
+		fetcher, err = NewBodyJsonValueFetcher(args[0].Value)
+		matcher = NewInMatcher(args[1].Value, false)
+	case "req_body_form_value_in":
+		fetcher = &BodyFormValueFetcher{key: args[0].Value}
+		matcher = NewInMatcher(args[1].Value, false)
+	case "req_time_range":
+		fetcher = &TimeFetcher{now: ctx.now()}
+		matcher, err = NewTimeRangeMatcher(args[0].Value, args[1].Value)
+	case "req_weekday_in":
+		fetcher = &TimeFetcher{now: ctx.now()}
+		matcher, err = NewWeekdayMatcher(args[0].Value)
+	case "req_time_in_zone":
+		fetcher = &TimeFetcher{now: ctx.now()}
+		matcher, err = NewDailyTimeMatcher(args[0].Value, args[1].Value, args[2].Value)
+	default:
+		return nil, fmt.Errorf("unsupported primitive %s", node.Fun.Name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", node.Fun.Name, err)
+	}
 
-func (t *Tmp) Match(req *bfe_basic.Request) bool {
-	return false
+	return &PrimitiveCond{
+		name:    node.Fun.Name,
+		node:    node,
+		fetcher: fetcher,
+		matcher: matcher,
+	}, nil
 }
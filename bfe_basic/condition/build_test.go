@@ -0,0 +1,231 @@
+package condition
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+// newBuildTestRequest creates request of GET http://example.org/v1/users?id=123&from=mobile
+// from client 10.1.2.3 to vip 192.168.0.1
+func newBuildTestRequest() *bfe_basic.Request {
+	u, _ := url.Parse("http://example.org/v1/users?id=123&from=mobile")
+	hreq := &bfe_http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		Host:       "example.org",
+		RequestURI: "/v1/users?id=123&from=mobile",
+		Header: bfe_http.Header{
+			"Cookie":     {"uid=u123; lang=zh-CN"},
+			"User-Agent": {"Mozilla/5.0 (iPhone)"},
+			"X-Test":     {"Value1"},
+		},
+	}
+	session := &bfe_basic.Session{
+		RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 12345},
+		Vip:        net.ParseIP("192.168.0.1"),
+		IsTrustIP:  true,
+	}
+
+	req := bfe_basic.NewRequest(hreq, nil, nil, session, nil)
+	req.ClientAddr = &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}
+	req.AddTags("city", []string{"beijing"})
+	req.HttpResponse = &bfe_http.Response{
+		StatusCode: 200,
+		Header:     bfe_http.Header{"Content-Type": {"text/html"}},
+	}
+
+	return req
+}
+
+func TestBuildPrecedence(t *testing.T) {
+	// a, b and c are conditions whose results are set by request
+	a := `req_host_in("a.org")`
+	b := `req_path_in("/b", false)`
+	c := `req_method_in("POST")`
+
+	tests := []struct {
+		cond   string
+		expect func(a, b, c bool) bool
+	}{
+		{a + " || " + b + " && " + c, func(a, b, c bool) bool { return a || (b && c) }},
+		{a + " && " + b + " || " + c, func(a, b, c bool) bool { return (a && b) || c }},
+		{"(" + a + " || " + b + ") && " + c, func(a, b, c bool) bool { return (a || b) && c }},
+		{a + " && (" + b + " || " + c + ")", func(a, b, c bool) bool { return a && (b || c) }},
+		{"!" + a + " && " + b, func(a, b, c bool) bool { return !a && b }},
+		{"!(" + a + " && " + b + ")", func(a, b, c bool) bool { return !(a && b) }},
+		{"!" + a + " || !" + b + " && " + c, func(a, b, c bool) bool { return !a || (!b && c) }},
+		{"!!" + a, func(a, b, c bool) bool { return a }},
+		{a + " || " + b + " || " + c, func(a, b, c bool) bool { return a || b || c }},
+		{a + " && " + b + " && " + c, func(a, b, c bool) bool { return a && b && c }},
+	}
+
+	for _, tt := range tests {
+		cond, err := Build(tt.cond)
+		if err != nil {
+			t.Fatalf("Build(%s): %s", tt.cond, err)
+		}
+
+		for i := 0; i < 8; i++ {
+			va, vb, vc := i&1 != 0, i&2 != 0, i&4 != 0
+
+			u := &url.URL{Path: "/x"}
+			hreq := &bfe_http.Request{Method: "GET", URL: u, Host: "x.org", Header: make(bfe_http.Header)}
+			if va {
+				hreq.Host = "a.org"
+			}
+			if vb {
+				u.Path = "/b"
+			}
+			if vc {
+				hreq.Method = "POST"
+			}
+
+			req := bfe_basic.NewRequest(hreq, nil, nil, nil, nil)
+			if got, expect := cond.Match(req), tt.expect(va, vb, vc); got != expect {
+				t.Errorf("%s with a=%v b=%v c=%v: got %v, expect %v", tt.cond, va, vb, vc, got, expect)
+			}
+		}
+	}
+}
+
+func TestBuildPrimitives(t *testing.T) {
+	tests := []struct {
+		cond   string
+		expect bool
+	}{
+		{`default_t()`, true},
+
+		// host and url
+		{`req_host_in("b.org|EXAMPLE.org")`, true},
+		{`req_host_in("b.org")`, false},
+		{`req_host_regmatch("^exam.*\\.org$")`, true},
+		{`req_url_regmatch("^/v1/.*id=123")`, true},
+		{`req_method_in("post|get")`, true},
+		{`req_method_in("POST")`, false},
+		{`req_port_in("80|8080")`, true},
+		{`req_proto_match("HTTP/1.1")`, true},
+		{`req_proto_secure()`, false},
+
+		// path
+		{`req_path_in("/v1/users", false)`, true},
+		{`req_path_in("/V1/USERS", false)`, false},
+		{`req_path_in("/V1/USERS", true)`, true},
+		{`req_path_prefix_in("/v2/|/v1/", false)`, true},
+		{`req_path_suffix_in("/USERS", true)`, true},
+		{`req_path_suffix_in("/USERS", false)`, false},
+		{`req_path_regmatch("^/v[0-9]+/")`, true},
+
+		// query
+		{`req_query_exist()`, true},
+		{`req_query_key_in("from")`, true},
+		{`req_query_key_in("to")`, false},
+		{`req_query_key_prefix_in("fr")`, true},
+		{`req_query_value_in("from", "MOBILE", true)`, true},
+		{`req_query_value_in("from", "MOBILE", false)`, false},
+		{`req_query_value_in("to", "mobile", false)`, false},
+		{`req_query_value_prefix_in("id", "12", false)`, true},
+		{`req_query_value_suffix_in("id", "23", false)`, true},
+		{`req_query_value_regmatch("id", "^[0-9]+$")`, true},
+		{`req_query_value_contain("from", "OBI", true)`, true},
+		{`req_query_value_hash_in("id", "0-9999", false)`, true},
+
+		// cookie
+		{`req_cookie_key_in("uid")`, true},
+		{`req_cookie_key_in("sid")`, false},
+		{`req_cookie_value_in("uid", "u123", false)`, true},
+		{`req_cookie_value_in("sid", "u123", false)`, false},
+		{`req_cookie_value_prefix_in("lang", "ZH", true)`, true},
+		{`req_cookie_value_suffix_in("lang", "-CN", false)`, true},
+		{`req_cookie_value_contain("lang", "h-c", false)`, false},
+		{`req_cookie_value_hash_in("uid", "0-9999", false)`, true},
+
+		// header
+		{`req_header_key_in("x-test")`, true},
+		{`req_header_key_in("x-other")`, false},
+		{`req_header_value_in("x-test", "value1", true)`, true},
+		{`req_header_value_in("x-test", "value1", false)`, false},
+		{`req_header_value_prefix_in("X-Test", "Val", false)`, true},
+		{`req_header_value_suffix_in("X-Test", "UE1", true)`, true},
+		{`req_header_value_regmatch("X-Test", "^V.*1$")`, true},
+		{`req_header_value_contain("X-Test", "lue", false)`, true},
+		{`req_header_value_hash_in("X-Test", "0-9999", false)`, true},
+		{`req_ua_regmatch("iPhone|Android")`, true},
+
+		// ip
+		{`req_cip_range("10.1.0.0", "10.1.255.255")`, true},
+		{`req_cip_range("10.2.0.0", "10.2.255.255")`, false},
+		{`req_cip_hash_in("0-9999")`, true},
+		{`req_cip_trusted()`, true},
+		{`req_vip_in("192.168.0.2|192.168.0.1")`, true},
+		{`req_vip_range("192.168.0.0", "192.168.0.255")`, true},
+		{`ses_vip_range("192.168.1.0", "192.168.1.255")`, false},
+		{`ses_sip_range("10.0.0.0", "10.0.0.255")`, true},
+
+		// tag and response
+		{`req_tag_match("city", "beijing")`, true},
+		{`req_tag_match("city", "shanghai")`, false},
+		{`res_code_in("200|204")`, true},
+		{`res_header_key_in("content-type")`, true},
+		{`res_header_value_in("content-type", "TEXT/HTML", true)`, true},
+	}
+
+	for _, tt := range tests {
+		cond, err := Build(tt.cond)
+		if err != nil {
+			t.Errorf("Build(%s): %s", tt.cond, err)
+			continue
+		}
+
+		if got := cond.Match(newBuildTestRequest()); got != tt.expect {
+			t.Errorf("%s: got %v, expect %v", tt.cond, got, tt.expect)
+		}
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	tests := []struct {
+		cond string
+		err  string // substring of error
+	}{
+		// parse error
+		{`req_host_in("a.org") &&`, "route.conf:1:"},
+		{`req_host_in("a.org") & default_t()`, "route.conf:1:"},
+		{`(req_host_in("a.org")`, "route.conf:1:"},
+		{`req_host_in("a.org`, "route.conf:1:"},
+		{"default_t() &&\n  req_host_in(a.org)", "route.conf:2:"},
+
+		// unknown primitive
+		{`req_foo_in("a")`, "route.conf:1:1 primitive req_foo_in not found"},
+		{"default_t() ||\n  !req_foo_in(\"a\")", "route.conf:2:4 primitive req_foo_in not found"},
+
+		// wrong argument count or type
+		{`req_host_in()`, "route.conf:1:1 primitive args len error, expect 1, got 0"},
+		{`default_t(true)`, "route.conf:1:1 primitive args len error, expect 0, got 1"},
+		{`default_t() && req_path_in("/a", "false")`, "route.conf:1:16 primitive req_path_in arg 1 expect BOOL, got STRING"},
+		{`req_host_in(true)`, "route.conf:1:1 primitive req_host_in arg 0 expect STRING, got BOOL"},
+
+		// invalid argument value
+		{`req_host_regmatch("(")`, "req_host_regmatch: "},
+		{`req_cip_range("10.0.0.1", "x")`, "req_cip_range: invalid end ip x"},
+		{`req_cip_range("10.0.0.2", "10.0.0.1")`, "req_cip_range: start ip"},
+		{`req_query_value_hash_in("id", "0-10000", false)`, "req_query_value_hash_in: invalid hash bucket"},
+		{`req_vip_in("1.1.1.1|x")`, "req_vip_in: invalid ip x"},
+	}
+
+	for _, tt := range tests {
+		_, err := BuildWithVars("route.conf", tt.cond, nil)
+		if err == nil {
+			t.Errorf("%q: expect error", tt.cond)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %q, expect %q", tt.cond, err, tt.err)
+		}
+	}
+}
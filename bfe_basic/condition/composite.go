@@ -1,4 +1,39 @@
 package condition
 
+import (
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_basic/condition/parser"
+)
+
+// UnaryCond is composite condition for "!cond"
 type UnaryCond struct {
+	op   parser.Token
+	cond Condition
+}
+
+func (uc *UnaryCond) Match(req *bfe_basic.Request) bool {
+	switch uc.op {
+	case parser.NOT:
+		return !uc.cond.Match(req)
+	default:
+		return false
+	}
+}
+
+// BinaryCond is composite condition for "lc && rc" and "lc || rc"
+type BinaryCond struct {
+	op parser.Token
+	lc Condition
+	rc Condition
+}
+
+func (bc *BinaryCond) Match(req *bfe_basic.Request) bool {
+	switch bc.op {
+	case parser.LAND:
+		return bc.lc.Match(req) && bc.rc.Match(req)
+	case parser.LOR:
+		return bc.lc.Match(req) || bc.rc.Match(req)
+	default:
+		return false
+	}
 }
@@ -0,0 +1,66 @@
+package condition
+
+import (
+	"fmt"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_basic/condition/parser"
+)
+
+// TraceNode is evaluation result of a node in condition tree
+type TraceNode struct {
+	Expr     string
+	Result   bool
+	Children []*TraceNode `json:",omitempty"`
+}
+
+type tracer interface {
+	trace(req *bfe_basic.Request) *TraceNode
+}
+
+// Explain evaluates cond on req and records result of every node. Unlike
+// Match, nodes skipped by short circuit are evaluated too.
+func Explain(cond Condition, req *bfe_basic.Request) *TraceNode {
+	if t, ok := cond.(tracer); ok {
+		return t.trace(req)
+	}
+
+	return &TraceNode{Expr: fmt.Sprintf("%T", cond), Result: cond.Match(req)}
+}
+
+func (uc *UnaryCond) trace(req *bfe_basic.Request) *TraceNode {
+	child := Explain(uc.cond, req)
+
+	return &TraceNode{
+		Expr:     uc.op.Symbol(),
+		Result:   uc.op == parser.NOT && !child.Result,
+		Children: []*TraceNode{child},
+	}
+}
+
+func (bc *BinaryCond) trace(req *bfe_basic.Request) *TraceNode {
+	lt := Explain(bc.lc, req)
+	rt := Explain(bc.rc, req)
+
+	var result bool
+	switch bc.op {
+	case parser.LAND:
+		result = lt.Result && rt.Result
+	case parser.LOR:
+		result = lt.Result || rt.Result
+	}
+
+	return &TraceNode{
+		Expr:     bc.op.Symbol(),
+		Result:   result,
+		Children: []*TraceNode{lt, rt},
+	}
+}
+
+func (p *PrimitiveCond) trace(req *bfe_basic.Request) *TraceNode {
+	return &TraceNode{Expr: p.String(), Result: p.Match(req)}
+}
+
+func (dt *DefaultTrueCond) trace(req *bfe_basic.Request) *TraceNode {
+	return &TraceNode{Expr: "default_t()", Result: true}
+}
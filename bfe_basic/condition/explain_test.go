@@ -0,0 +1,72 @@
+package condition
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+// traceString formats trace as "expr=result" of nodes in pre-order, with
+// children in parentheses
+func traceString(node *TraceNode) string {
+	s := fmt.Sprintf("%s=%v", node.Expr, node.Result)
+	if len(node.Children) == 0 {
+		return s
+	}
+
+	var children []string
+	for _, child := range node.Children {
+		children = append(children, traceString(child))
+	}
+
+	return s + "(" + strings.Join(children, " ") + ")"
+}
+
+func TestExplainMixed(t *testing.T) {
+	cond, err := Build(`req_host_in("a.org") || (req_path_prefix_in("/v1", false) || default_t()) && !req_method_in("POST")`)
+	if err != nil {
+		t.Fatalf("Build(): %s", err)
+	}
+
+	tests := []struct {
+		host   string
+		method string
+		expect string
+	}{
+		{
+			"b.org", "GET",
+			`||=true(req_host_in("a.org")=false &&=true(||=true(req_path_prefix_in("/v1",false)=true default_t()=true) !=true(req_method_in("POST")=false)))`,
+		},
+		{
+			"b.org", "POST",
+			`||=false(req_host_in("a.org")=false &&=false(||=true(req_path_prefix_in("/v1",false)=true default_t()=true) !=false(req_method_in("POST")=true)))`,
+		},
+		{
+			// nodes skipped by short circuit are evaluated too
+			"a.org", "POST",
+			`||=true(req_host_in("a.org")=true &&=false(||=true(req_path_prefix_in("/v1",false)=true default_t()=true) !=false(req_method_in("POST")=true)))`,
+		},
+	}
+
+	for _, tt := range tests {
+		hreq := &bfe_http.Request{
+			Method: tt.method,
+			URL:    &url.URL{Path: "/v1/users"},
+			Host:   tt.host,
+			Header: make(bfe_http.Header),
+		}
+		req := bfe_basic.NewRequest(hreq, nil, nil, nil, nil)
+
+		trace := Explain(cond, req)
+		if got := traceString(trace); got != tt.expect {
+			t.Errorf("%s %s:\ngot    %s\nexpect %s", tt.method, tt.host, got, tt.expect)
+		}
+		if trace.Result != cond.Match(req) {
+			t.Errorf("%s %s: result of trace differs from Match", tt.method, tt.host)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package condition
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spaolacci/murmur3"
+)
+
+const HashMatcherBucketSize = 10000
+
+// matchAny applies f on fetched value, which is string or []string
+func matchAny(v interface{}, f func(string) bool) bool {
+	switch val := v.(type) {
+	case string:
+		return f(val)
+	case []string:
+		for _, s := range val {
+			if f(s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func splitPatterns(patterns string, foldCase bool) []string {
+	if foldCase {
+		patterns = strings.ToLower(patterns)
+	}
+
+	return strings.Split(patterns, "|")
+}
+
+func foldValue(v string, foldCase bool) string {
+	if foldCase {
+		return strings.ToLower(v)
+	}
+
+	return v
+}
+
+// InMatcher matches if value equals one of patterns
+type InMatcher struct {
+	patterns map[string]bool
+	foldCase bool
+}
+
+func NewInMatcher(patterns string, foldCase bool) *InMatcher {
+	m := &InMatcher{
+		patterns: make(map[string]bool),
+		foldCase: foldCase,
+	}
+	for _, p := range splitPatterns(patterns, foldCase) {
+		m.patterns[p] = true
+	}
+
+	return m
+}
+
+func (m *InMatcher) Match(v interface{}) bool {
+	return matchAny(v, func(s string) bool {
+		return m.patterns[foldValue(s, m.foldCase)]
+	})
+}
+
+// PrefixInMatcher matches if value has one of patterns as prefix
+type PrefixInMatcher struct {
+	patterns []string
+	foldCase bool
+}
+
+func NewPrefixInMatcher(patterns string, foldCase bool) *PrefixInMatcher {
+	return &PrefixInMatcher{
+		patterns: splitPatterns(patterns, foldCase),
+		foldCase: foldCase,
+	}
+}
+
+func (m *PrefixInMatcher) Match(v interface{}) bool {
+	return matchAny(v, func(s string) bool {
+		s = foldValue(s, m.foldCase)
+		for _, p := range m.patterns {
+			if strings.HasPrefix(s, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SuffixInMatcher matches if value has one of patterns as suffix
+type SuffixInMatcher struct {
+	patterns []string
+	foldCase bool
+}
+
+func NewSuffixInMatcher(patterns string, foldCase bool) *SuffixInMatcher {
+	return &SuffixInMatcher{
+		patterns: splitPatterns(patterns, foldCase),
+		foldCase: foldCase,
+	}
+}
+
+func (m *SuffixInMatcher) Match(v interface{}) bool {
+	return matchAny(v, func(s string) bool {
+		s = foldValue(s, m.foldCase)
+		for _, p := range m.patterns {
+			if strings.HasSuffix(s, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ContainMatcher matches if value contains one of patterns
+type ContainMatcher struct {
+	patterns []string
+	foldCase bool
+}
+
+func NewContainMatcher(patterns string, foldCase bool) *ContainMatcher {
+	return &ContainMatcher{
+		patterns: splitPatterns(patterns, foldCase),
+		foldCase: foldCase,
+	}
+}
+
+func (m *ContainMatcher) Match(v interface{}) bool {
+	return matchAny(v, func(s string) bool {
+		s = foldValue(s, m.foldCase)
+		for _, p := range m.patterns {
+			if strings.Contains(s, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+type RegMatcher struct {
+	regex *regexp.Regexp
+}
+
+func NewRegMatcher(pattern string) (*RegMatcher, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("regexp %s compile err: %s", pattern, err)
+	}
+
+	return &RegMatcher{regex: regex}, nil
+}
+
+func (m *RegMatcher) Match(v interface{}) bool {
+	return matchAny(v, m.regex.MatchString)
+}
+
+type BoolMatcher struct {
+	value bool
+}
+
+func (m *BoolMatcher) Match(v interface{}) bool {
+	val, ok := v.(bool)
+	return ok && val == m.value
+}
+
+// HashMatcher hashes value into HashMatcherBucketSize buckets, and matches
+// if bucket is in configured sections, e.g. "0-99|200"
+type HashMatcher struct {
+	buckets  []bool
+	foldCase bool
+}
+
+func NewHashMatcher(sections string, foldCase bool) (*HashMatcher, error) {
+	buckets, err := parseHashSections(sections)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HashMatcher{buckets: buckets, foldCase: foldCase}, nil
+}
+
+func parseHashSections(sections string) ([]bool, error) {
+	buckets := make([]bool, HashMatcherBucketSize)
+
+	for _, section := range strings.Split(sections, "|") {
+		bounds := strings.Split(strings.TrimSpace(section), "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid hash section %s", section)
+		}
+
+		start, err := parseBucket(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseBucket(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid hash section %s", section)
+		}
+
+		for i := start; i <= end; i++ {
+			buckets[i] = true
+		}
+	}
+
+	return buckets, nil
+}
+
+func parseBucket(s string) (int, error) {
+	bucket, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || bucket < 0 || bucket >= HashMatcherBucketSize {
+		return 0, fmt.Errorf("invalid hash bucket %s, should be in [0, %d)", s, HashMatcherBucketSize)
+	}
+
+	return bucket, nil
+}
+
+func (m *HashMatcher) bucketMatch(value []byte) bool {
+	return m.buckets[murmur3.Sum64(value)%HashMatcherBucketSize]
+}
+
+func (m *HashMatcher) Match(v interface{}) bool {
+	switch val := v.(type) {
+	case net.IP:
+		return m.bucketMatch(val.To16())
+	default:
+		return matchAny(v, func(s string) bool {
+			return m.bucketMatch([]byte(foldValue(s, m.foldCase)))
+		})
+	}
+}
+
+// IpInMatcher matches if ip is one of configured ips, e.g. "1.1.1.1|2.2.2.2"
+type IpInMatcher struct {
+	ips []net.IP
+}
+
+func NewIpInMatcher(patterns string) (*IpInMatcher, error) {
+	m := &IpInMatcher{}
+	for _, p := range strings.Split(patterns, "|") {
+		ip := net.ParseIP(strings.TrimSpace(p))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip %s", p)
+		}
+		m.ips = append(m.ips, ip)
+	}
+
+	return m, nil
+}
+
+func (m *IpInMatcher) Match(v interface{}) bool {
+	ip, ok := v.(net.IP)
+	if !ok {
+		return false
+	}
+
+	for _, i := range m.ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IpRangeMatcher matches if ip is in [start, end]
+type IpRangeMatcher struct {
+	start net.IP
+	end   net.IP
+}
+
+func NewIpRangeMatcher(start, end string) (*IpRangeMatcher, error) {
+	startIP := net.ParseIP(start)
+	if startIP == nil {
+		return nil, fmt.Errorf("invalid start ip %s", start)
+	}
+	endIP := net.ParseIP(end)
+	if endIP == nil {
+		return nil, fmt.Errorf("invalid end ip %s", end)
+	}
+
+	if bytes.Compare(startIP.To16(), endIP.To16()) > 0 {
+		return nil, fmt.Errorf("start ip %s is larger than end ip %s", start, end)
+	}
+
+	return &IpRangeMatcher{start: startIP.To16(), end: endIP.To16()}, nil
+}
+
+func (m *IpRangeMatcher) Match(v interface{}) bool {
+	ip, ok := v.(net.IP)
+	if !ok || ip.To16() == nil {
+		return false
+	}
+
+	ip = ip.To16()
+	return bytes.Compare(ip, m.start) >= 0 && bytes.Compare(ip, m.end) <= 0
+}
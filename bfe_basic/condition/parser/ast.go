@@ -56,8 +56,11 @@ func (c CallExpr) String() string {
 
 	var strArgs []string
 	for _, arg := range c.Args {
-		if arg.Kind == STRING {
+		switch arg.Kind {
+		case STRING:
 			strArgs = append(strArgs, strconv.Quote(arg.Value))
+		case BOOL:
+			strArgs = append(strArgs, arg.Value)
 		}
 	}
 
@@ -114,7 +117,7 @@ func (b BasicLitList) Pos() token.Pos {
 }
 
 func (b BasicLitList) End() token.Pos {
-	return b[len(b)].End()
+	return b[len(b)-1].End()
 }
 
 func (p ParenExpr) Pos() token.Pos {
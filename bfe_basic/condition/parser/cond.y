@@ -12,13 +12,14 @@ import (
 %union {
 	Node Node
 	str	string
+	pos	token.Pos
 }
 
 %token IDENT LAND LOR LPAREN RPAREN NOT SEMICOLON BASICLIT COMMA BOOL STRING INT FLOAT IMAG COMMENT ILLEGAL
 
-%left LAND
 %left LOR
-%right NOT	
+%left LAND
+%right NOT
 %%
 
 top:
@@ -42,7 +43,7 @@ expr:
 	}
 |	NOT expr
 	{
-		$$.Node = &UnaryExpr{$2.Node.(Expr), NOT, lastTokenPos}
+		$$.Node = &UnaryExpr{$2.Node.(Expr), NOT, $1.pos}
 	}
 |	callExpr
 	{
@@ -56,11 +57,11 @@ expr:
 callExpr:
 	IDENT LPAREN paramlist RPAREN
 	{
-		$$.Node = &CallExpr{$1.Node.(*Ident), $3.Node.(BasicLitList), lastPos}
+		$$.Node = &CallExpr{$1.Node.(*Ident), $3.Node.(BasicLitList), $4.pos}
 	}
 |   IDENT LPAREN RPAREN
     {
-        $$.Node = &CallExpr{$1.Node.(*Ident), nil, lastPos}
+        $$.Node = &CallExpr{$1.Node.(*Ident), nil, $3.pos}
     }
 
 paramlist:
@@ -81,9 +82,8 @@ paramlist:
 const EOF = 0
 
 var (
-    parseNode Node	// save parse node
-    lastPos      token.Pos
-	lastTokenPos token.Pos
+	parseNode Node // save parse node
+	lastPos   token.Pos
 )
 
 // The parser uses the type <prefix>Lex as a lexer.  It must provide
@@ -111,10 +111,10 @@ func (x *condLex) Lex(yylval *condSymType) int {
 			yylval.Node = &BasicLit{Kind:tok, Value:lit, ValuePos: pos}
 			return BASICLIT 
 		case LPAREN, RPAREN, LAND, LOR, SEMICOLON, COMMA, NOT:
-			lastTokenPos = pos
+			yylval.pos = pos
 			return int(tok)
 		default:
-			x.Error(fmt.Sprintf("unrecognized token %d", tok))
+			x.Error(fmt.Sprintf("unrecognized token %s %q", tok, lit))
 			return EOF
 		}
 	}
@@ -28,12 +28,13 @@ func (e Error) Error() string {
 	return fmt.Sprintf("%s %s", e.pos, e.msg)
 }
 
-func (p *Parser) Init(src []byte) {
+// Init prepares parser for src, filename is used in position of errors
+func (p *Parser) Init(filename string, src []byte) {
 	p.fset = token.NewFileSet()
 	p.errors = p.errors[0:0]
 	p.identList = p.identList[0:0]
 
-	file := p.fset.AddFile("", p.fset.Base(), len(src))
+	file := p.fset.AddFile(filename, p.fset.Base(), len(src))
 	p.scanner.Init(file, src, p.addError)
 	p.lexer = &condLex{
 		s:   &p.scanner,
@@ -59,6 +60,7 @@ func (p *Parser) Parse() {
 	parseLock.Lock()
 	defer parseLock.Unlock()
 
+	parseNode = nil
 	condParse(p.lexer)
 	p.ast = parseNode
 
@@ -88,7 +90,7 @@ func (p Parser) String() string {
 func Parse(condStr string) (Node, []*Ident, error) {
 	var p Parser
 
-	p.Init([]byte(condStr))
+	p.Init("", []byte(condStr))
 	p.Parse()
 
 	if err := p.Error(); err != nil {
@@ -97,3 +99,18 @@ func Parse(condStr string) (Node, []*Ident, error) {
 
 	return p.ast, p.identList, nil
 }
+
+// ParseWithVars parses condStr and replaces variables in it with expressions
+// defined in vars. name identifies condStr in error messages, e.g. conf file.
+func ParseWithVars(name string, condStr string, vars *VarTable) (Node, error) {
+	var p Parser
+
+	p.Init(name, []byte(condStr))
+	p.Parse()
+
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+
+	return vars.resolve(p.ast, p.fset, nil)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/token"
 	"path/filepath"
+	"strconv"
 	"unicode"
 	"unicode/utf8"
 )
@@ -81,7 +82,7 @@ func (s *Scanner) next() {
 			s.lineOffset = s.offset
 			s.file.AddLine(s.offset)
 		}
-		s.ch -= 1
+		s.ch = -1 // eof
 	}
 }
 
@@ -101,6 +102,9 @@ func isDigit(ch rune) bool {
 
 func (s *Scanner) scanIdentifier() string {
 	offs := s.offset
+	if s.ch == '$' {
+		s.next()
+	}
 	for isLetter(s.ch) || isDigit(s.ch) {
 		s.next()
 	}
@@ -138,7 +142,12 @@ func (s *Scanner) scanString() string {
 		}
 	}
 
-	return string(s.src[offs+1 : s.offset-1])
+	lit := string(s.src[offs:s.offset])
+	if value, err := strconv.Unquote(lit); err == nil {
+		return value
+	}
+
+	return lit[1:]
 }
 
 func (s *Scanner) scanEspace(quote rune) bool {
@@ -157,7 +166,7 @@ func (s *Scanner) scanEspace(quote rune) bool {
 		n, base, max = 2, 16, 255
 	case 'u':
 		s.next()
-		n, base, max = 4, 6, unicode.MaxRune
+		n, base, max = 4, 16, unicode.MaxRune
 	case 'U':
 		s.next()
 		n, base, max = 8, 16, unicode.MaxRune
@@ -329,7 +338,7 @@ acanAgain:
 	pos = s.file.Pos(s.offset)
 
 	switch ch := s.ch; {
-	case isLetter(ch):
+	case isLetter(ch) || ch == '$':
 		lit = s.scanIdentifier()
 		if len(lit) > 1 {
 			tok = Lookup(lit)
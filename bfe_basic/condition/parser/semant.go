@@ -52,6 +52,12 @@ var funcProtos = map[string][]Token{
 	"res_header_value_in":        {STRING, STRING, BOOL},
 	"ses_vip_range":              {STRING, STRING},
 	"ses_sip_range":              {STRING, STRING},
+	"req_body_contain":           {STRING, BOOL},
+	"req_body_json_value_in":     {STRING, STRING},
+	"req_body_form_value_in":     {STRING, STRING},
+	"req_time_range":             {STRING, STRING},
+	"req_weekday_in":             {STRING},
+	"req_time_in_zone":           {STRING, STRING, STRING},
 }
 
 func prototypeCheck(expr *CallExpr) error {
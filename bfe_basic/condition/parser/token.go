@@ -2,23 +2,6 @@ package parser
 
 type Token int
 
-const IDENT = 57346
-const LAND = 57347
-const LOR = 57348
-const LPAREN = 57349
-const RPAREN = 57350
-const NOT = 57351
-const SEMICOLON = 57352
-const BASICLIT = 57353
-const COMMA = 57354
-const BOOL = 57355
-const STRING = 57356
-const INT = 57357
-const FLOAT = 57358
-const IMAG = 57359
-const COMMENT = 57360
-const ILLEGAL = 57361
-
 var keywords = []string{
 	"break",
 	"case",
@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+const (
+	varUnresolved = iota
+	varResolving
+	varResolved
+)
+
+type variable struct {
+	name  string
+	fset  *token.FileSet
+	ast   Node // parsed expression, may refer other variables
+	node  Node // expression with all variables replaced
+	state int
+}
+
+// VarTable holds named conditions, e.g. "$is_mobile", which can be
+// referred in condition expressions
+type VarTable struct {
+	vars map[string]*variable
+}
+
+func isVarName(name string) bool {
+	if len(name) < 2 || name[0] != '$' {
+		return false
+	}
+
+	for _, ch := range name[1:] {
+		if !isLetter(ch) && !isDigit(ch) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewVarTable parses and resolves variable definitions. name identifies
+// definitions in error messages, e.g. conf file.
+func NewVarTable(name string, defs map[string]string) (*VarTable, error) {
+	vt := &VarTable{
+		vars: make(map[string]*variable),
+	}
+
+	var names []string
+	for varName := range defs {
+		names = append(names, varName)
+	}
+	sort.Strings(names)
+
+	for _, varName := range names {
+		if !isVarName(varName) {
+			return nil, fmt.Errorf("%s: invalid variable name %q, should be like $name", name, varName)
+		}
+
+		var p Parser
+		p.Init(fmt.Sprintf("%s[%s]", name, varName), []byte(defs[varName]))
+		p.Parse()
+		if err := p.Error(); err != nil {
+			return nil, err
+		}
+
+		vt.vars[varName] = &variable{name: varName, fset: p.fset, ast: p.ast}
+	}
+
+	for _, varName := range names {
+		if _, err := vt.resolveVar(vt.vars[varName], nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return vt, nil
+}
+
+func (vt *VarTable) lookup(name string) (*variable, bool) {
+	if vt == nil {
+		return nil, false
+	}
+
+	v, ok := vt.vars[name]
+	return v, ok
+}
+
+func (vt *VarTable) resolveVar(v *variable, path []string) (Node, error) {
+	if v.state == varResolved {
+		return v.node, nil
+	}
+
+	v.state = varResolving
+	path = append(path[:len(path):len(path)], v.name)
+	node, err := vt.resolve(v.ast, v.fset, path)
+	if err != nil {
+		return nil, err
+	}
+
+	v.node = &ParenExpr{node}
+	v.state = varResolved
+
+	return v.node, nil
+}
+
+// resolve returns a copy of node in which variables are replaced with their
+// expressions. path is the chain of variables being resolved, for cycle check.
+func (vt *VarTable) resolve(node Node, fset *token.FileSet, path []string) (Node, error) {
+	switch n := node.(type) {
+	case *BinaryExpr:
+		x, err := vt.resolve(n.X, fset, path)
+		if err != nil {
+			return nil, err
+		}
+		y, err := vt.resolve(n.Y, fset, path)
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{x, n.Op, y}, nil
+	case *UnaryExpr:
+		x, err := vt.resolve(n.X, fset, path)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{x, n.Op, n.OpPos}, nil
+	case *ParenExpr:
+		x, err := vt.resolve(n.X, fset, path)
+		if err != nil {
+			return nil, err
+		}
+		return &ParenExpr{x}, nil
+	case *Ident:
+		v, ok := vt.lookup(n.Name)
+		if !ok {
+			return nil, Error{pos: fset.Position(n.Pos()), msg: fmt.Sprintf("undefined variable %s", n.Name)}
+		}
+		if v.state == varResolving {
+			cycle := strings.Join(append(path, n.Name), " -> ")
+			return nil, Error{pos: fset.Position(n.Pos()), msg: fmt.Sprintf("variable cycle %s", cycle)}
+		}
+		return vt.resolveVar(v, path)
+	default:
+		return node, nil
+	}
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// exprString formats node with parentheses kept, for comparing expressions
+func exprString(node Node) string {
+	switch n := node.(type) {
+	case *BinaryExpr:
+		return exprString(n.X) + " " + n.Op.Symbol() + " " + exprString(n.Y)
+	case *UnaryExpr:
+		return n.Op.Symbol() + exprString(n.X)
+	case *ParenExpr:
+		return "(" + exprString(n.X) + ")"
+	case *CallExpr:
+		return n.String()
+	case *Ident:
+		return n.Name
+	default:
+		return "?"
+	}
+}
+
+func TestVarExpansion(t *testing.T) {
+	vars, err := NewVarTable("route.conf", map[string]string{
+		"$mobile":  `req_ua_regmatch("iPhone|Android")`,
+		"$beta":    `req_cookie_value_in("beta", "1", false) || req_query_exist()`,
+		"$mbeta":   `$mobile && $beta`,
+		"$notBeta": `!$beta`,
+	})
+	if err != nil {
+		t.Fatalf("NewVarTable(): %s", err)
+	}
+
+	tests := []struct {
+		cond   string
+		expect string
+	}{
+		{`$mobile`, `(req_ua_regmatch("iPhone|Android"))`},
+		{`req_host_in("a.org") && $beta`,
+			`req_host_in("a.org") && (req_cookie_value_in("beta","1",false) || req_query_exist())`},
+		{`$mbeta || default_t()`,
+			`((req_ua_regmatch("iPhone|Android")) && (req_cookie_value_in("beta","1",false) || req_query_exist())) || default_t()`},
+		{`$notBeta`, `(!(req_cookie_value_in("beta","1",false) || req_query_exist()))`},
+		{`!$mobile && $mobile`, `!(req_ua_regmatch("iPhone|Android")) && (req_ua_regmatch("iPhone|Android"))`},
+	}
+
+	for _, tt := range tests {
+		node, err := ParseWithVars("route.conf[p1][0]", tt.cond, vars)
+		if err != nil {
+			t.Errorf("ParseWithVars(%s): %s", tt.cond, err)
+			continue
+		}
+		if got := exprString(node); got != tt.expect {
+			t.Errorf("%s:\ngot    %s\nexpect %s", tt.cond, got, tt.expect)
+		}
+	}
+}
+
+func TestVarCycle(t *testing.T) {
+	tests := []struct {
+		defs map[string]string
+		err  string
+	}{
+		{
+			map[string]string{"$a": `$a || default_t()`},
+			"route.conf[$a]:1:1 variable cycle $a -> $a",
+		},
+		{
+			map[string]string{
+				"$a": `default_t() && $b`,
+				"$b": `!$c`,
+				"$c": `req_query_exist() || $a`,
+			},
+			"route.conf[$c]:1:22 variable cycle $a -> $b -> $c -> $a",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := NewVarTable("route.conf", tt.defs)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%v: got error %v, expect %s", tt.defs, err, tt.err)
+		}
+	}
+}
+
+func TestVarUndefined(t *testing.T) {
+	// undefined in definition of variable
+	_, err := NewVarTable("route.conf", map[string]string{
+		"$a": "default_t() &&\n  $missing",
+	})
+	if err == nil || err.Error() != "route.conf[$a]:2:3 undefined variable $missing" {
+		t.Errorf("got error %v", err)
+	}
+
+	// undefined in condition
+	vars, err := NewVarTable("route.conf", map[string]string{"$a": `default_t()`})
+	if err != nil {
+		t.Fatalf("NewVarTable(): %s", err)
+	}
+	for _, tt := range []struct {
+		vars *VarTable
+		cond string
+		err  string
+	}{
+		{vars, `$a && $b`, "route.conf[p1][0]:1:7 undefined variable $b"},
+		{nil, `default_t() || !$a`, "route.conf[p1][0]:1:17 undefined variable $a"},
+	} {
+		_, err := ParseWithVars("route.conf[p1][0]", tt.cond, tt.vars)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v, expect %s", tt.cond, err, tt.err)
+		}
+	}
+}
+
+func TestVarInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		defs map[string]string
+		err  string
+	}{
+		{map[string]string{"mobile": `default_t()`}, `invalid variable name "mobile"`},
+		{map[string]string{"$": `default_t()`}, `invalid variable name "$"`},
+		{map[string]string{"$a.b": `default_t()`}, `invalid variable name "$a.b"`},
+		{map[string]string{"$a": `default_t(`}, "route.conf[$a]:1:"},
+		{map[string]string{"$a": `req_foo()`}, "route.conf[$a]:1:1 primitive req_foo not found"},
+	} {
+		_, err := NewVarTable("route.conf", tt.defs)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: got error %v, expect %s", tt.defs, err, tt.err)
+		}
+	}
+}
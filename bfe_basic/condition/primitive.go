@@ -1 +1,371 @@
 package condition
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_basic/condition/parser"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+// Fetcher fetches target value from request
+type Fetcher interface {
+	Fetch(req *bfe_basic.Request) (interface{}, error)
+}
+
+// Matcher checks whether fetched value matches
+type Matcher interface {
+	Match(v interface{}) bool
+}
+
+// PrimitiveCond is condition for primitive, e.g. req_host_in("a.com")
+type PrimitiveCond struct {
+	name    string
+	node    *parser.CallExpr
+	fetcher Fetcher
+	matcher Matcher
+}
+
+func (p *PrimitiveCond) String() string {
+	return p.node.String()
+}
+
+func (p *PrimitiveCond) Match(req *bfe_basic.Request) bool {
+	if req == nil {
+		return false
+	}
+
+	v, err := p.fetcher.Fetch(req)
+	if err != nil || v == nil {
+		return false
+	}
+
+	return p.matcher.Match(v)
+}
+
+// DefaultTrueCond always matches
+type DefaultTrueCond struct{}
+
+func (dt *DefaultTrueCond) Match(req *bfe_basic.Request) bool {
+	return true
+}
+
+var errNilField = fmt.Errorf("fetcher: nil pointer")
+
+func checkHttpRequest(req *bfe_basic.Request) error {
+	if req.HttpRequest == nil {
+		return errNilField
+	}
+
+	return nil
+}
+
+type HostFetcher struct{}
+
+func (hf *HostFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return hostWithoutPort(req.HttpRequest.Host), nil
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
+
+type PathFetcher struct{}
+
+func (pf *PathFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+	if req.HttpRequest.URL == nil {
+		return nil, errNilField
+	}
+
+	return req.HttpRequest.URL.Path, nil
+}
+
+type UrlFetcher struct{}
+
+func (uf *UrlFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req.HttpRequest.RequestURI, nil
+}
+
+type MethodFetcher struct{}
+
+func (mf *MethodFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req.HttpRequest.Method, nil
+}
+
+// PortFetcher fetches port from host header, default port is used if absent
+type PortFetcher struct{}
+
+func (pf *PortFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	if _, port, err := net.SplitHostPort(req.HttpRequest.Host); err == nil {
+		return port, nil
+	}
+
+	if req.Session != nil && req.Session.IsSecure {
+		return "443", nil
+	}
+
+	return "80", nil
+}
+
+type ProtoFetcher struct{}
+
+func (pf *ProtoFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+	if req.Session == nil {
+		return nil, errNilField
+	}
+
+	return req.Protocali(), nil
+}
+
+type SecureFetcher struct{}
+
+func (sf *SecureFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.Session == nil {
+		return nil, errNilField
+	}
+
+	return req.Session.IsSecure, nil
+}
+
+type TrustedCIPFetcher struct{}
+
+func (tf *TrustedCIPFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.Session == nil {
+		return nil, errNilField
+	}
+
+	return req.Session.IsTrustIP, nil
+}
+
+type UAFetcher struct{}
+
+func (uf *UAFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return req.HttpRequest.Header.Get("User-Agent"), nil
+}
+
+type QueryExistFetcher struct{}
+
+func (qf *QueryExistFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return len(req.CachedQuery()) > 0, nil
+}
+
+type QueryKeyFetcher struct{}
+
+func (qf *QueryKeyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range req.CachedQuery() {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+type QueryValueFetcher struct {
+	key string
+}
+
+func (qf *QueryValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	values, ok := req.CachedQuery()[qf.key]
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("fetcher: query %s not found", qf.key)
+	}
+
+	return values[0], nil
+}
+
+type CookieKeyFetcher struct{}
+
+func (cf *CookieKeyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range req.CachedCookie() {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+type CookieValueFetcher struct {
+	key string
+}
+
+func (cf *CookieValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	cookie, ok := req.Cookie(cf.key)
+	if !ok {
+		return nil, fmt.Errorf("fetcher: cookie %s not found", cf.key)
+	}
+
+	return cookie.Value, nil
+}
+
+func headerKeys(header bfe_http.Header) []string {
+	var keys []string
+	for key := range header {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func headerValue(header bfe_http.Header, key string) (interface{}, error) {
+	values, ok := header[key]
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("fetcher: header %s not found", key)
+	}
+
+	return values[0], nil
+}
+
+type HeaderKeyFetcher struct{}
+
+func (hf *HeaderKeyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return headerKeys(req.HttpRequest.Header), nil
+}
+
+type HeaderValueFetcher struct {
+	key string
+}
+
+func (hf *HeaderValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if err := checkHttpRequest(req); err != nil {
+		return nil, err
+	}
+
+	return headerValue(req.HttpRequest.Header, hf.key)
+}
+
+type TagFetcher struct {
+	key string
+}
+
+func (tf *TagFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.Tags.TagTable == nil {
+		return nil, errNilField
+	}
+
+	return req.Tags.TagTable[tf.key], nil
+}
+
+// CIPFetcher fetches client ip, which may be different from source ip
+// of connection if request is forwarded by trusted proxy
+type CIPFetcher struct{}
+
+func (cf *CIPFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.ClientAddr != nil {
+		return req.ClientAddr.IP, nil
+	}
+	if req.RemoteAddr != nil {
+		return req.RemoteAddr.IP, nil
+	}
+
+	return nil, errNilField
+}
+
+type VIPFetcher struct{}
+
+func (vf *VIPFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.Session == nil || req.Session.Vip == nil {
+		return nil, errNilField
+	}
+
+	return req.Session.Vip, nil
+}
+
+// SIPFetcher fetches source ip of connection
+type SIPFetcher struct{}
+
+func (sf *SIPFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.Session == nil || req.Session.RemoteAddr == nil {
+		return nil, errNilField
+	}
+
+	return req.Session.RemoteAddr.IP, nil
+}
+
+type ResCodeFetcher struct{}
+
+func (rf *ResCodeFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.HttpResponse == nil {
+		return nil, errNilField
+	}
+
+	return strconv.Itoa(req.HttpResponse.StatusCode), nil
+}
+
+type ResHeaderKeyFetcher struct{}
+
+func (rf *ResHeaderKeyFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.HttpResponse == nil {
+		return nil, errNilField
+	}
+
+	return headerKeys(req.HttpResponse.Header), nil
+}
+
+type ResHeaderValueFetcher struct {
+	key string
+}
+
+func (rf *ResHeaderValueFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if req.HttpResponse == nil {
+		return nil, errNilField
+	}
+
+	return headerValue(req.HttpResponse.Header, rf.key)
+}
@@ -0,0 +1,172 @@
+package condition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+)
+
+// TimeFetcher fetches current time
+type TimeFetcher struct {
+	now func() time.Time
+}
+
+func (tf *TimeFetcher) Fetch(req *bfe_basic.Request) (interface{}, error) {
+	if tf.now == nil {
+		return time.Now(), nil
+	}
+
+	return tf.now(), nil
+}
+
+// timeRangeLayout is time format for req_time_range, e.g. "20191001120000+0800",
+// "20191001120000Z". Server local timezone is used if zone is omitted.
+const timeRangeLayout = "20060102150405Z0700"
+
+func parseRangeTime(value string) (time.Time, error) {
+	if len(value) == len("20060102150405") {
+		return time.ParseInLocation("20060102150405", value, time.Local)
+	}
+
+	return time.Parse(timeRangeLayout, value)
+}
+
+// TimeRangeMatcher matches if time is in [start, end)
+type TimeRangeMatcher struct {
+	start time.Time
+	end   time.Time
+}
+
+func NewTimeRangeMatcher(start, end string) (*TimeRangeMatcher, error) {
+	startTime, err := parseRangeTime(start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time %s: %s", start, err)
+	}
+	endTime, err := parseRangeTime(end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time %s: %s", end, err)
+	}
+
+	if !startTime.Before(endTime) {
+		return nil, fmt.Errorf("start time %s should be before end time %s", start, end)
+	}
+
+	return &TimeRangeMatcher{start: startTime, end: endTime}, nil
+}
+
+func (m *TimeRangeMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	return !t.Before(m.start) && t.Before(m.end)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// WeekdayMatcher matches if weekday of time in server local timezone is
+// one of configured days, e.g. "Mon|Tue"
+type WeekdayMatcher struct {
+	days [7]bool
+}
+
+func NewWeekdayMatcher(days string) (*WeekdayMatcher, error) {
+	m := &WeekdayMatcher{}
+	for _, day := range strings.Split(days, "|") {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %s, should be like Mon", day)
+		}
+		m.days[weekday] = true
+	}
+
+	return m, nil
+}
+
+func (m *WeekdayMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	return m.days[t.In(time.Local).Weekday()]
+}
+
+// DailyTimeMatcher matches if time of day in given timezone is in [start, end).
+// If start is after end, the window crosses midnight.
+type DailyTimeMatcher struct {
+	loc   *time.Location
+	start int // seconds since midnight
+	end   int
+}
+
+func NewDailyTimeMatcher(zone, start, end string) (*DailyTimeMatcher, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %s", zone, err)
+	}
+
+	m := &DailyTimeMatcher{loc: loc}
+	if m.start, err = parseDayTime(start); err != nil {
+		return nil, err
+	}
+	if m.end, err = parseDayTime(end); err != nil {
+		return nil, err
+	}
+	if m.start == m.end {
+		return nil, fmt.Errorf("start time %s equals to end time %s", start, end)
+	}
+
+	return m, nil
+}
+
+// parseDayTime parses "hh:mm" or "hh:mm:ss" into seconds since midnight
+func parseDayTime(value string) (int, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) != 2 && len(fields) != 3 {
+		return 0, fmt.Errorf("invalid time of day %s, should be hh:mm or hh:mm:ss", value)
+	}
+
+	limits := []int{24, 60, 60}
+	secs := 0
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || n >= limits[i] {
+			return 0, fmt.Errorf("invalid time of day %s, should be hh:mm or hh:mm:ss", value)
+		}
+		secs = secs*60 + n
+	}
+	if len(fields) == 2 {
+		secs *= 60
+	}
+
+	return secs, nil
+}
+
+func (m *DailyTimeMatcher) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	hour, min, sec := t.In(m.loc).Clock()
+	secs := hour*3600 + min*60 + sec
+
+	if m.start < m.end {
+		return secs >= m.start && secs < m.end
+	}
+
+	return secs >= m.start || secs < m.end
+}
@@ -0,0 +1,128 @@
+package condition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %s", name, err)
+	}
+
+	return loc
+}
+
+// checkTimeCond builds cond with clock fixed at each time of cases, and
+// checks whether it matches as expected
+func checkTimeCond(t *testing.T, condStr string, cases map[time.Time]bool) {
+	var now time.Time
+	ctx := &BuildContext{Now: func() time.Time { return now }}
+
+	cond, err := BuildWithContext(ctx, "", condStr, nil)
+	if err != nil {
+		t.Fatalf("build %s: %s", condStr, err)
+	}
+
+	for tm, expect := range cases {
+		now = tm
+		if got := cond.Match(&bfe_basic.Request{}); got != expect {
+			t.Errorf("%s at %s: got %v, expect %v", condStr, tm, got, expect)
+		}
+	}
+}
+
+func TestTimeInZoneCrossMidnight(t *testing.T) {
+	shanghai := mustLoadLocation(t, "Asia/Shanghai")
+
+	checkTimeCond(t, `req_time_in_zone("Asia/Shanghai", "22:00", "06:00")`, map[time.Time]bool{
+		time.Date(2019, 10, 1, 21, 59, 59, 0, shanghai): false,
+		time.Date(2019, 10, 1, 22, 0, 0, 0, shanghai):   true,
+		time.Date(2019, 10, 1, 23, 59, 59, 0, shanghai): true,
+		time.Date(2019, 10, 2, 0, 0, 0, 0, shanghai):    true,
+		time.Date(2019, 10, 2, 5, 59, 59, 0, shanghai):  true,
+		time.Date(2019, 10, 2, 6, 0, 0, 0, shanghai):    false,
+		time.Date(2019, 10, 2, 12, 0, 0, 0, shanghai):   false,
+	})
+}
+
+func TestTimeInZoneConvertsZone(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	// 09:00-17:00 in New York is 13:00-21:00 UTC during daylight saving time,
+	// and 14:00-22:00 UTC otherwise
+	checkTimeCond(t, `req_time_in_zone("America/New_York", "09:00", "17:00")`, map[time.Time]bool{
+		time.Date(2019, 7, 1, 12, 59, 0, 0, time.UTC):  false,
+		time.Date(2019, 7, 1, 13, 0, 0, 0, time.UTC):   true,
+		time.Date(2019, 7, 1, 20, 59, 0, 0, time.UTC):  true,
+		time.Date(2019, 7, 1, 21, 0, 0, 0, time.UTC):   false,
+		time.Date(2019, 12, 2, 13, 30, 0, 0, time.UTC): false,
+		time.Date(2019, 12, 2, 21, 30, 0, 0, time.UTC): true,
+		time.Date(2019, 12, 2, 9, 0, 0, 0, newYork):    true,
+	})
+
+	checkTimeCond(t, `req_time_in_zone("UTC", "09:00:30", "17:00")`, map[time.Time]bool{
+		time.Date(2019, 7, 1, 9, 0, 29, 0, time.UTC): false,
+		time.Date(2019, 7, 1, 9, 0, 30, 0, time.UTC): true,
+		time.Date(2019, 7, 1, 5, 30, 0, 0, newYork):  true,
+	})
+}
+
+func TestWeekdayIn(t *testing.T) {
+	// 2019-10-05 is Saturday
+	checkTimeCond(t, `req_weekday_in("sat|SUN")`, map[time.Time]bool{
+		time.Date(2019, 10, 4, 23, 59, 59, 0, time.Local): false,
+		time.Date(2019, 10, 5, 0, 0, 0, 0, time.Local):    true,
+		time.Date(2019, 10, 6, 23, 59, 59, 0, time.Local): true,
+		time.Date(2019, 10, 7, 0, 0, 0, 0, time.Local):    false,
+	})
+
+	checkTimeCond(t, `req_weekday_in("Mon|Tue|Wed|Thu|Fri")`, map[time.Time]bool{
+		time.Date(2019, 10, 4, 12, 0, 0, 0, time.Local): true,
+		time.Date(2019, 10, 5, 12, 0, 0, 0, time.Local): false,
+		time.Date(2019, 10, 7, 12, 0, 0, 0, time.Local): true,
+	})
+}
+
+func TestTimeRange(t *testing.T) {
+	checkTimeCond(t, `req_time_range("20191001120000+0800", "20191001130000+0800")`, map[time.Time]bool{
+		time.Date(2019, 10, 1, 3, 59, 59, 0, time.UTC): false,
+		time.Date(2019, 10, 1, 4, 0, 0, 0, time.UTC):   true,
+		time.Date(2019, 10, 1, 4, 59, 59, 0, time.UTC): true,
+		time.Date(2019, 10, 1, 5, 0, 0, 0, time.UTC):   false,
+	})
+
+	checkTimeCond(t, `req_time_range("20191001120000Z", "20191002120000Z")`, map[time.Time]bool{
+		time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC): true,
+		time.Date(2019, 10, 2, 12, 0, 0, 0, time.UTC): false,
+	})
+}
+
+func TestTimeCondInvalid(t *testing.T) {
+	for _, condStr := range []string{
+		`req_time_in_zone("No/Such_Zone", "09:00", "17:00")`,
+		`req_time_in_zone("UTC", "09:00", "09:00")`,
+		`req_time_in_zone("UTC", "24:00", "09:00")`,
+		`req_time_in_zone("UTC", "9", "10:00")`,
+		`req_weekday_in("Mon|Someday")`,
+		`req_time_range("20191002120000Z", "20191001120000Z")`,
+		`req_time_range("2019-10-01", "20191002120000Z")`,
+	} {
+		if _, err := Build(condStr); err == nil {
+			t.Errorf("build %s: expect error", condStr)
+		}
+	}
+}
+
+func TestTimeFetcherDefaultClock(t *testing.T) {
+	cond, err := Build(`req_time_range("20000101000000Z", "21000101000000Z")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cond.Match(&bfe_basic.Request{}) {
+		t.Errorf("current time should be in range")
+	}
+}
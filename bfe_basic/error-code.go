@@ -33,6 +33,7 @@ var (
 	ErrBkRetryTooMany      = errors.New("BK_RETRY_TOOMANY")        // reach retry max
 	ErrBkNoSubClusterCross = errors.New("BK_NO_SUB_CLUSTER_CROSS") // no sub-cluster found
 	ErrBkCrossRetryBalance = errors.New("BK_CROSS_RETRY_BALANCE")  // cross retry balance failed
+	ErrBkCircuitOpen       = errors.New("BK_CIRCUIT_OPEN")         // backends or cluster reach limit
 
 	// GSLB error
 	ErrGslbBlackhole = errors.New("GSLB_BLACKHOLE") // deny by blackhole
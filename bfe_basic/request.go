@@ -1,8 +1,11 @@
 package bfe_basic
 
 import (
+	"bytes"
 	"github.com/crud-bird/bfe/bfe_balance/backend"
 	"github.com/crud-bird/bfe/bfe_http"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/url"
 )
@@ -67,8 +70,9 @@ type Request struct {
 
 	Stat *RequestStat
 
-	RetryTime int
-	Backend   BackendInfo
+	RetryTime      int
+	RetryDecisions []string // "cause:decision" of each failed attempt
+	Backend        BackendInfo
 
 	Redirect RedirectInfo
 
@@ -125,6 +129,35 @@ func (req *Request) Cookie(name string) (*bfe_http.Cookie, bool) {
 	return req.CookieMap.Get(name)
 }
 
+// peekedBody replays peeked data before the rest of original body
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// PeekBody reads at most limit bytes of request body into ReqBody. The body
+// is not consumed: HttpRequest.Body still returns the whole body afterwards.
+func (req *Request) PeekBody(limit int) ([]byte, error) {
+	if req.ReqBodyPeeked {
+		return req.ReqBody, nil
+	}
+	req.ReqBodyPeeked = true
+
+	body := req.HttpRequest.Body
+	if body == nil || limit <= 0 {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, int64(limit)))
+	req.ReqBody = data
+	req.HttpRequest.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(data), body),
+		Closer: body,
+	}
+
+	return data, err
+}
+
 func (req *Request) SetRequestTransport(backend *backend.BfeBackend, transport bfe_http.RoundTripper) {
 	req.Trans.Backend = backend
 	req.Trans.Transport = transport
@@ -135,7 +135,7 @@ func (b *Reader) Read(p []byte) (n int, err error) {
 				b.TotalRead += n
 			}
 
-			return n, b, readErr()
+			return n, b.readErr()
 		}
 		b.fill()
 		if b.w == b.r {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	json "github.com/pquerna/ffjson/ffjson"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -20,8 +21,10 @@ const (
 )
 
 const (
-	BalanceModeWrr = "WRR"
-	BalanceModeWlc = "WLC"
+	BalanceModeWrr     = "WRR"
+	BalanceModeWlc     = "WLC"
+	BalanceModeMaglev  = "MAGLEV"   // consistent hashing by hash key
+	BalanceModeP2cEwma = "P2C_EWMA" // power of two choices by ewma latency and in-flight requests
 )
 
 const (
@@ -37,6 +40,32 @@ type BackendCheck struct {
 	SuccNum       *int
 	CheckTimeout  *int
 	CheckInterval *int
+
+	// check backends all the time rather than only after they are down
+	Continuous  *bool
+	CheckJitter *int // percent of CheckInterval randomly added or subtracted
+
+	// for http/https check
+	Method          *string
+	Headers         *map[string]string
+	ExpectBody      *string // substring expected in response body
+	ExpectBodyRegex *string // regex expected to match response body
+	MaxRespSize     *int    // max bytes of response body read
+
+	// for https check, and grpc check over tls
+	SNI                *string // server name, host is used if empty
+	InsecureSkipVerify *bool
+
+	// for grpc check, grpc.health.v1.Health/Check is called
+	GrpcService *string // service name, empty for overall health of server
+	GrpcTLS     *bool   // over tls if true, or h2c
+
+	bodyRegex *regexp.Regexp
+}
+
+// BodyRegex returns compiled ExpectBodyRegex, nil if not set
+func (conf *BackendCheck) BodyRegex() *regexp.Regexp {
+	return conf.bodyRegex
 }
 
 type BackendBasic struct {
@@ -44,12 +73,36 @@ type BackendBasic struct {
 	TimeoutResponseHeader *int
 	MaxIdleConnsPerHost   *int
 	RetryLevel            *int
+
+	// circuit breakers, 0 means no limit
+	MaxConnsPerBackend *int // max concurrent requests to a backend
+	MaxPendingRequests *int // max concurrent requests to the cluster
+	MaxRetries         *int // max concurrent retries to the cluster
 }
 
 type HashConf struct {
 	HashStrategy  *int
 	HashHeader    *string
 	SessionSticky *bool
+	StickyCookie  *StickyCookieConf
+}
+
+// StickyCookieConf makes BFE issue a cookie which encodes the selected sub
+// cluster and backend. Later requests with the cookie go to the same backend
+// as long as it could be selected by balance.
+type StickyCookieConf struct {
+	Enable   *bool
+	Name     *string
+	Path     *string
+	Domain   *string
+	MaxAge   *int // seconds, 0 for session cookie
+	Secure   *bool
+	HttpOnly *bool
+
+	// cookie is signed with HMAC-SHA256, or encrypted with AES-GCM if
+	// Encrypt is true. Keys are derived from Key, which is required.
+	Key     *string
+	Encrypt *bool
 }
 
 type GslbBasicConf struct {
@@ -57,6 +110,86 @@ type GslbBasicConf struct {
 	RetryMax    *int
 	HashConf    *HashConf
 	BalanceMode *string
+
+	// weight of recovered or newly added backend ramps up to configured
+	// weight within SlowStartTime seconds, 0 disables slow start
+	SlowStartTime *int
+
+	// if percent of healthy backends in sub cluster is below PanicThreshold,
+	// all backends are used regardless of their status, 0 disables it
+	PanicThreshold *int
+
+	// sub clusters in priority tiers, e.g. [["idc1"], ["idc2", "idc3"]].
+	// Sub clusters not listed are in an extra last tier. Traffic goes to
+	// the first tier in which percent of available backends is not below
+	// SpilloverThreshold.
+	PriorityTiers      *[][]string
+	SpilloverThreshold *int
+}
+
+// OutlierDetection ejects backend based on result of live traffic
+type OutlierDetection struct {
+	Enable             *bool
+	Interval           *int // ms, interval of success rate detection and unejection
+	BaseEjectionTime   *int // ms, ejection time doubles on each ejection
+	MaxEjectionTime    *int // ms
+	MaxEjectionPercent *int // max percent of ejected backends in a sub cluster
+
+	Consecutive5xx            *int // 0 disables
+	ConsecutiveGatewayFailure *int // 502/503/504 and transport errors, 0 disables
+
+	SuccessRateMinHosts      *int // min num of backends with enough requests
+	SuccessRateRequestVolume *int // min num of requests of backend in interval
+	SuccessRateStdevFactor   *int // in 1/1000, eject if rate < mean - stdev * factor, 0 disables
+}
+
+// RetryPolicy decides whether failed request is retried on another backend.
+// If enabled, it replaces RetryLevel of BackendBasic. Request failed to
+// connect backend is always retried since it has not been sent yet. Other
+// failures are retried only for idempotent methods without request body.
+type RetryPolicy struct {
+	Enable         *bool
+	StatusCodes    *[]int    // retry on these response status codes, e.g. [502, 503, 504]
+	RetryOnReset   *bool     // retry if connection is broken before response header is read
+	RetryOnTimeout *bool     // retry if response header timeout
+	Methods        *[]string // methods allowed to retry, idempotent methods by default
+
+	// retries to the cluster are limited to BudgetPercent of active requests,
+	// but MinRetryConcurrency retries are always allowed. 0 disables budget.
+	BudgetPercent       *int
+	MinRetryConcurrency *int
+
+	// backoff before retry is BackoffBase * 2^(n-1) for nth retry, capped
+	// at BackoffMax, with random jitter of half of it. 0 disables backoff.
+	BackoffBase *int // ms
+	BackoffMax  *int // ms
+}
+
+// idempotentMethods are methods which could be retried safely
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// HedgePolicy sends a hedged request to another backend if no response
+// header is received within hedge delay, and the first response wins. Only
+// GET requests without body are hedged.
+type HedgePolicy struct {
+	Enable *bool
+	Delay  *int // ms, hedge delay
+
+	// if > 0, hedge delay is this percentile of recent latency of the
+	// cluster, and Delay is used as lower bound
+	DelayPercentile *int
+
+	// concurrent hedged requests are limited to BudgetPercent of active
+	// requests, but MinHedgeConcurrency hedged requests are always allowed
+	BudgetPercent       *int
+	MinHedgeConcurrency *int
 }
 
 type ClusterBasicConf struct {
@@ -75,6 +208,9 @@ type ClusterConf struct {
 	CheckConf    *BackendCheck
 	GslbBasic    *GslbBasicConf
 	ClusterBasic *ClusterBasicConf
+	OutlierConf  *OutlierDetection
+	RetryConf    *RetryPolicy
+	HedgeConf    *HedgePolicy
 }
 
 type ClusterToConf map[string]ClusterConf
@@ -87,7 +223,7 @@ type BfeClusterConf struct {
 func BackendBasicCheck(conf *BackendBasic) error {
 	if conf.TimeoutConnSrv == nil {
 		defaultTimeoutSrv := 2000
-		conf.TimeoutResponseHeader = &defaultTimeoutSrv
+		conf.TimeoutConnSrv = &defaultTimeoutSrv
 	}
 
 	if conf.TimeoutResponseHeader == nil {
@@ -105,6 +241,25 @@ func BackendBasicCheck(conf *BackendBasic) error {
 		conf.RetryLevel = &retryLevel
 	}
 
+	if conf.MaxConnsPerBackend == nil {
+		tmp := 0
+		conf.MaxConnsPerBackend = &tmp
+	}
+
+	if conf.MaxPendingRequests == nil {
+		tmp := 0
+		conf.MaxPendingRequests = &tmp
+	}
+
+	if conf.MaxRetries == nil {
+		tmp := 0
+		conf.MaxRetries = &tmp
+	}
+
+	if *conf.MaxConnsPerBackend < 0 || *conf.MaxPendingRequests < 0 || *conf.MaxRetries < 0 {
+		return fmt.Errorf("MaxConnsPerBackend/MaxPendingRequests/MaxRetries should >= 0")
+	}
+
 	return nil
 }
 
@@ -199,11 +354,76 @@ func BackendCheckCheck(conf *BackendCheck) error {
 		conf.SuccNum = &num
 	}
 
-	if *conf.Schem != "http" && *conf.Schem != "tcp" {
-		return errors.New("cheme for BackendCheck should be http/tcp")
+	if conf.Continuous == nil {
+		continuous := false
+		conf.Continuous = &continuous
+	}
+
+	if conf.CheckJitter == nil {
+		jitter := 10
+		conf.CheckJitter = &jitter
+	}
+
+	if *conf.CheckInterval <= 0 {
+		return errors.New("CheckInterval should be bigger than 0")
+	}
+
+	if *conf.CheckJitter < 0 || *conf.CheckJitter > 100 {
+		return errors.New("CheckJitter should be in [0, 100]")
+	}
+
+	if conf.Method == nil {
+		method := "GET"
+		conf.Method = &method
+	}
+
+	if conf.Headers == nil {
+		headers := make(map[string]string)
+		conf.Headers = &headers
+	}
+
+	if conf.ExpectBody == nil {
+		body := ""
+		conf.ExpectBody = &body
+	}
+
+	if conf.ExpectBodyRegex == nil {
+		body := ""
+		conf.ExpectBodyRegex = &body
+	}
+
+	if conf.MaxRespSize == nil {
+		size := 64 * 1024
+		conf.MaxRespSize = &size
+	}
+
+	if conf.SNI == nil {
+		sni := ""
+		conf.SNI = &sni
 	}
 
-	if *conf.Schem == "http" {
+	if conf.InsecureSkipVerify == nil {
+		skip := false
+		conf.InsecureSkipVerify = &skip
+	}
+
+	if conf.GrpcService == nil {
+		service := ""
+		conf.GrpcService = &service
+	}
+
+	if conf.GrpcTLS == nil {
+		grpcTLS := false
+		conf.GrpcTLS = &grpcTLS
+	}
+
+	switch *conf.Schem {
+	case "http", "https", "tcp", "grpc":
+	default:
+		return errors.New("cheme for BackendCheck should be http/https/tcp/grpc")
+	}
+
+	if *conf.Schem == "http" || *conf.Schem == "https" {
 		if !strings.HasPrefix(*conf.Uri, "/") {
 			return errors.New("uri should be start with '/'")
 		}
@@ -211,6 +431,23 @@ func BackendCheckCheck(conf *BackendCheck) error {
 		if err := checkStatusCode(*conf.StatusCode); err != nil {
 			return err
 		}
+
+		*conf.Method = strings.ToUpper(*conf.Method)
+		if len(*conf.Method) == 0 {
+			return errors.New("method should not be empty")
+		}
+
+		if *conf.MaxRespSize <= 0 {
+			return errors.New("MaxRespSize should be bigger than 0")
+		}
+
+		if len(*conf.ExpectBodyRegex) > 0 {
+			regex, err := regexp.Compile(*conf.ExpectBodyRegex)
+			if err != nil {
+				return fmt.Errorf("invalid ExpectBodyRegex: %s", err)
+			}
+			conf.bodyRegex = regex
+		}
 	}
 
 	if *conf.SuccNum < 1 {
@@ -240,6 +477,51 @@ func GslbBasicConfCheck(conf *GslbBasicConf) error {
 		conf.BalanceMode = &tmp
 	}
 
+	if conf.SlowStartTime == nil {
+		tmp := 0
+		conf.SlowStartTime = &tmp
+	}
+
+	if *conf.SlowStartTime < 0 {
+		return fmt.Errorf("SlowStartTime should >= 0")
+	}
+
+	if conf.PanicThreshold == nil {
+		tmp := 0
+		conf.PanicThreshold = &tmp
+	}
+
+	if *conf.PanicThreshold < 0 || *conf.PanicThreshold > 100 {
+		return fmt.Errorf("PanicThreshold should be in [0, 100]")
+	}
+
+	if conf.PriorityTiers == nil {
+		tiers := make([][]string, 0)
+		conf.PriorityTiers = &tiers
+	}
+
+	if conf.SpilloverThreshold == nil {
+		tmp := 70
+		conf.SpilloverThreshold = &tmp
+	}
+
+	subs := make(map[string]bool)
+	for _, tier := range *conf.PriorityTiers {
+		if len(tier) == 0 {
+			return fmt.Errorf("empty tier in PriorityTiers")
+		}
+		for _, sub := range tier {
+			if subs[sub] {
+				return fmt.Errorf("sub cluster %s in more than one tier", sub)
+			}
+			subs[sub] = true
+		}
+	}
+
+	if *conf.SpilloverThreshold < 0 || *conf.SpilloverThreshold > 100 {
+		return fmt.Errorf("SpilloverThreshold should be in [0, 100]")
+	}
+
 	if err := HashConfCheck(conf.HashConf); err != nil {
 		return err
 	}
@@ -248,6 +530,8 @@ func GslbBasicConfCheck(conf *GslbBasicConf) error {
 	switch *conf.BalanceMode {
 	case BalanceModeWlc:
 	case BalanceModeWrr:
+	case BalanceModeMaglev:
+	case BalanceModeP2cEwma:
 	default:
 		return fmt.Errorf("unsupported bal mode %s", *conf.BalanceMode)
 	}
@@ -266,6 +550,13 @@ func HashConfCheck(conf *HashConf) error {
 		conf.SessionSticky = &tmp
 	}
 
+	if conf.StickyCookie == nil {
+		conf.StickyCookie = &StickyCookieConf{}
+	}
+	if err := StickyCookieConfCheck(conf.StickyCookie); err != nil {
+		return fmt.Errorf("StickyCookie: %s", err.Error())
+	}
+
 	if *conf.HashStrategy != ClientIPOnly && *conf.HashStrategy != ClientIDOnly && *conf.HashStrategy != ClientIDPreferred {
 		return fmt.Errorf("invalid HashStrategy[%d]", *conf.HashStrategy)
 	}
@@ -282,6 +573,67 @@ func HashConfCheck(conf *HashConf) error {
 	return nil
 }
 
+func StickyCookieConfCheck(conf *StickyCookieConf) error {
+	if conf.Enable == nil {
+		tmp := false
+		conf.Enable = &tmp
+	}
+
+	if conf.Name == nil {
+		tmp := "BFE_STICKY"
+		conf.Name = &tmp
+	}
+
+	if conf.Path == nil {
+		tmp := "/"
+		conf.Path = &tmp
+	}
+
+	if conf.Domain == nil {
+		tmp := ""
+		conf.Domain = &tmp
+	}
+
+	if conf.MaxAge == nil {
+		tmp := 0
+		conf.MaxAge = &tmp
+	}
+
+	if conf.Secure == nil {
+		tmp := false
+		conf.Secure = &tmp
+	}
+
+	if conf.HttpOnly == nil {
+		tmp := true
+		conf.HttpOnly = &tmp
+	}
+
+	if conf.Key == nil {
+		tmp := ""
+		conf.Key = &tmp
+	}
+
+	if conf.Encrypt == nil {
+		tmp := false
+		conf.Encrypt = &tmp
+	}
+
+	if len(*conf.Name) == 0 || strings.ContainsAny(*conf.Name, " \t\r\n=;,") {
+		return fmt.Errorf("invalid Name %q", *conf.Name)
+	}
+
+	if *conf.MaxAge < 0 {
+		return errors.New("MaxAge should >= 0")
+	}
+
+	if *conf.Enable && len(*conf.Key) == 0 {
+		return errors.New("Key is required")
+	}
+
+	return nil
+}
+
 func ClusterBasicConfCheck(conf *ClusterBasicConf) error {
 	if conf.TimeoutReadClient == nil {
 		tmp := 30000
@@ -321,12 +673,232 @@ func ClusterBasicConfCheck(conf *ClusterBasicConf) error {
 	return nil
 }
 
+func OutlierDetectionCheck(conf *OutlierDetection) error {
+	if conf.Enable == nil {
+		tmp := false
+		conf.Enable = &tmp
+	}
+
+	if conf.Interval == nil {
+		tmp := 10000
+		conf.Interval = &tmp
+	}
+
+	if conf.BaseEjectionTime == nil {
+		tmp := 30000
+		conf.BaseEjectionTime = &tmp
+	}
+
+	if conf.MaxEjectionTime == nil {
+		tmp := 300000
+		conf.MaxEjectionTime = &tmp
+	}
+
+	if conf.MaxEjectionPercent == nil {
+		tmp := 10
+		conf.MaxEjectionPercent = &tmp
+	}
+
+	if conf.Consecutive5xx == nil {
+		tmp := 5
+		conf.Consecutive5xx = &tmp
+	}
+
+	if conf.ConsecutiveGatewayFailure == nil {
+		tmp := 0
+		conf.ConsecutiveGatewayFailure = &tmp
+	}
+
+	if conf.SuccessRateMinHosts == nil {
+		tmp := 5
+		conf.SuccessRateMinHosts = &tmp
+	}
+
+	if conf.SuccessRateRequestVolume == nil {
+		tmp := 100
+		conf.SuccessRateRequestVolume = &tmp
+	}
+
+	if conf.SuccessRateStdevFactor == nil {
+		tmp := 1900
+		conf.SuccessRateStdevFactor = &tmp
+	}
+
+	if *conf.Interval <= 0 {
+		return errors.New("Interval should be bigger than 0")
+	}
+
+	if *conf.BaseEjectionTime <= 0 {
+		return errors.New("BaseEjectionTime should be bigger than 0")
+	}
+
+	if *conf.MaxEjectionTime < *conf.BaseEjectionTime {
+		return errors.New("MaxEjectionTime should not be less than BaseEjectionTime")
+	}
+
+	if *conf.MaxEjectionPercent < 0 || *conf.MaxEjectionPercent > 100 {
+		return errors.New("MaxEjectionPercent should be in [0, 100]")
+	}
+
+	if *conf.Consecutive5xx < 0 || *conf.ConsecutiveGatewayFailure < 0 {
+		return errors.New("Consecutive5xx/ConsecutiveGatewayFailure should >= 0")
+	}
+
+	if *conf.SuccessRateMinHosts < 1 || *conf.SuccessRateRequestVolume < 1 {
+		return errors.New("SuccessRateMinHosts/SuccessRateRequestVolume should be bigger than 0")
+	}
+
+	if *conf.SuccessRateStdevFactor < 0 {
+		return errors.New("SuccessRateStdevFactor should >= 0")
+	}
+
+	return nil
+}
+
+func RetryPolicyCheck(conf *RetryPolicy) error {
+	if conf.Enable == nil {
+		tmp := false
+		conf.Enable = &tmp
+	}
+
+	if conf.StatusCodes == nil {
+		codes := []int{502, 503, 504}
+		conf.StatusCodes = &codes
+	}
+
+	if conf.RetryOnReset == nil {
+		tmp := true
+		conf.RetryOnReset = &tmp
+	}
+
+	if conf.RetryOnTimeout == nil {
+		tmp := false
+		conf.RetryOnTimeout = &tmp
+	}
+
+	if conf.Methods == nil {
+		methods := []string{"GET", "HEAD", "OPTIONS"}
+		conf.Methods = &methods
+	}
+
+	if conf.BudgetPercent == nil {
+		tmp := 20
+		conf.BudgetPercent = &tmp
+	}
+
+	if conf.MinRetryConcurrency == nil {
+		tmp := 3
+		conf.MinRetryConcurrency = &tmp
+	}
+
+	if conf.BackoffBase == nil {
+		tmp := 25
+		conf.BackoffBase = &tmp
+	}
+
+	if conf.BackoffMax == nil {
+		tmp := 250
+		conf.BackoffMax = &tmp
+	}
+
+	for _, code := range *conf.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code %d in StatusCodes", code)
+		}
+	}
+
+	for i, method := range *conf.Methods {
+		method = strings.ToUpper(method)
+		if !idempotentMethods[method] {
+			return fmt.Errorf("method %s is not idempotent", method)
+		}
+		(*conf.Methods)[i] = method
+	}
+
+	if *conf.BudgetPercent < 0 || *conf.MinRetryConcurrency < 0 {
+		return errors.New("BudgetPercent/MinRetryConcurrency should >= 0")
+	}
+
+	if *conf.BackoffBase < 0 || *conf.BackoffMax < *conf.BackoffBase {
+		return errors.New("BackoffBase should >= 0 and BackoffMax should not be less than BackoffBase")
+	}
+
+	return nil
+}
+
+// RetryOnStatus checks whether response with status code should be retried
+func (conf *RetryPolicy) RetryOnStatus(code int) bool {
+	for _, c := range *conf.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MethodAllowed checks whether request with method could be retried
+func (conf *RetryPolicy) MethodAllowed(method string) bool {
+	for _, m := range *conf.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func HedgePolicyCheck(conf *HedgePolicy) error {
+	if conf.Enable == nil {
+		tmp := false
+		conf.Enable = &tmp
+	}
+
+	if conf.Delay == nil {
+		tmp := 50
+		conf.Delay = &tmp
+	}
+
+	if conf.DelayPercentile == nil {
+		tmp := 0
+		conf.DelayPercentile = &tmp
+	}
+
+	if conf.BudgetPercent == nil {
+		tmp := 10
+		conf.BudgetPercent = &tmp
+	}
+
+	if conf.MinHedgeConcurrency == nil {
+		tmp := 1
+		conf.MinHedgeConcurrency = &tmp
+	}
+
+	if *conf.Delay <= 0 {
+		return errors.New("Delay should be bigger than 0")
+	}
+
+	if *conf.DelayPercentile < 0 || *conf.DelayPercentile > 99 {
+		return errors.New("DelayPercentile should be in [0, 99]")
+	}
+
+	if *conf.BudgetPercent < 0 || *conf.BudgetPercent > 100 {
+		return errors.New("BudgetPercent should be in [0, 100]")
+	}
+
+	if *conf.MinHedgeConcurrency < 0 {
+		return errors.New("MinHedgeConcurrency should >= 0")
+	}
+
+	return nil
+}
+
 func ClusterConfCheck(conf *ClusterConf) error {
 	if conf.BackendConf == nil {
 		conf.BackendConf = &BackendBasic{}
 	}
 	if err := BackendBasicCheck(conf.BackendConf); err != nil {
-		return fmt.Errorf("BackendConf: %s", err.Error)
+		return fmt.Errorf("BackendConf: %s", err.Error())
 	}
 
 	if conf.CheckConf == nil {
@@ -350,6 +922,27 @@ func ClusterConfCheck(conf *ClusterConf) error {
 		return fmt.Errorf("ClusterBasic: %s", err.Error())
 	}
 
+	if conf.OutlierConf == nil {
+		conf.OutlierConf = &OutlierDetection{}
+	}
+	if err := OutlierDetectionCheck(conf.OutlierConf); err != nil {
+		return fmt.Errorf("OutlierConf: %s", err.Error())
+	}
+
+	if conf.RetryConf == nil {
+		conf.RetryConf = &RetryPolicy{}
+	}
+	if err := RetryPolicyCheck(conf.RetryConf); err != nil {
+		return fmt.Errorf("RetryConf: %s", err.Error())
+	}
+
+	if conf.HedgeConf == nil {
+		conf.HedgeConf = &HedgePolicy{}
+	}
+	if err := HedgePolicyCheck(conf.HedgeConf); err != nil {
+		return fmt.Errorf("HedgeConf: %s", err.Error())
+	}
+
 	return nil
 }
 
@@ -358,6 +951,7 @@ func ClusterToConfCheck(conf *ClusterToConf) error {
 		if err := ClusterConfCheck(&c); err != nil {
 			return fmt.Errorf("conf for %s: %s", name, err.Error())
 		}
+		(*conf)[name] = c
 	}
 
 	return nil
@@ -0,0 +1,31 @@
+package cluster_conf
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStickyCookieConfCheck(t *testing.T) {
+	cases := []struct {
+		conf string
+		ok   bool
+	}{
+		{`{}`, true},
+		{`{"Enable": true, "Key": "k1"}`, true},
+		{`{"Enable": true, "Key": "k1", "Encrypt": true}`, true},
+		{`{"Enable": true}`, false},
+		{`{"Enable": true, "Key": ""}`, false},
+		{`{"Enable": true, "Key": "k1", "Name": "a=b"}`, false},
+		{`{"Enable": true, "Key": "k1", "MaxAge": -1}`, false},
+	}
+
+	for _, c := range cases {
+		var conf StickyCookieConf
+		if err := json.Unmarshal([]byte(c.conf), &conf); err != nil {
+			t.Fatalf("decode %s: %s", c.conf, err)
+		}
+		if err := StickyCookieConfCheck(&conf); (err == nil) != c.ok {
+			t.Errorf("%s: got error %v, expect ok %v", c.conf, err, c.ok)
+		}
+	}
+}
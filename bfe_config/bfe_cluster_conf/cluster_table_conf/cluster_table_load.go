@@ -19,7 +19,7 @@ type BackendConf struct {
 }
 
 func (b *BackendConf) AddrInfo() string {
-	return fmt.Sprintf("%s:%d", *b.Addr, b.Port)
+	return fmt.Sprintf("%s:%d", *b.Addr, *b.Port)
 }
 
 type SubClusterBackend []*BackendConf
@@ -28,6 +28,7 @@ type ConfigBasic struct {
 	MaxHeaderBytes          int
 	MaxHeaderUriBytes       int
 	MaxProxyHeaderBytes     int
+	MaxReqBodyPeekBytes     int // max bytes of request body peeked by conditions
 	KeepAlivedEnabled       bool
 
 	Modules []string
@@ -61,18 +62,19 @@ func (cfg *ConfigBasic) SetDeafaultConf() {
 	cfg.GracefulShutdownTimeout = 10
 	cfg.MaxHeaderBytes = 1048576
 	cfg.MaxHeaderUriBytes = 8192
+	cfg.MaxReqBodyPeekBytes = 65536
 	cfg.KeepAlivedEnabled = true
 
 	cfg.HostRuleConf = "server_data_conf/host_rule.data"
-	cfg.VipRuleConf = "server_data_conf/vip_rule_data"
-	cfg.RouteRuleConf = "server_data_conf/route_rule_data"
+	cfg.VipRuleConf = "server_data_conf/vip_rule.data"
+	cfg.RouteRuleConf = "server_data_conf/route_rule.data"
 
 	cfg.ClusterTableConf = "cluster_conf/cluster_table.data"
 	cfg.GslbConf = "cluster_conf/gslb.data"
-	cfg.ClusterTableConf = "server_data_conf/cluster_conf.data"
+	cfg.ClusterConf = "server_data_conf/cluster_conf.data"
 	cfg.NameConf = "server_data_conf/name_conf.data"
 
-	cfg.MonitorPort = 20
+	cfg.MonitorIterval = 20
 }
 
 func (cfg *ConfigBasic) Check(confRoot string) error {
@@ -84,6 +86,10 @@ func ConfBasicCheck(cfg *ConfigBasic, confRoot string) error {
 		return err
 	}
 
+	if err := dataFIleConfCheck(cfg, confRoot); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -92,12 +98,12 @@ func basicConfCheck(cfg *ConfigBasic) error {
 		return fmt.Errorf("HttpPort[%d] should be in [1, 65535]", cfg.HttpPort)
 	}
 
-	if cfg.HttpsPort < 1 || cfg.HttpsPort > 65536 {
+	if cfg.HttpsPort < 1 || cfg.HttpsPort > 65535 {
 		return fmt.Errorf("HttpsPort[%d] should be in [1, 65535]", cfg.HttpsPort)
 	}
 
-	if cfg.MonitorIterval < 1 || cfg.MonitorPort > 65536 {
-		return fmt.Errorf("MonitorIterval[%d] should be in [1, 65535]", cfg.MonitorPort)
+	if cfg.MonitorPort < 1 || cfg.MonitorPort > 65535 {
+		return fmt.Errorf("MonitorPort[%d] should be in [1, 65535]", cfg.MonitorPort)
 	}
 
 	if cfg.MaxCpus < 0 {
@@ -134,7 +140,8 @@ func basicConfCheck(cfg *ConfigBasic) error {
 		logrus.Warn("cfg.MonitorIterval not set value, use default value 20")
 		cfg.MonitorIterval = 20
 	} else if cfg.MonitorIterval > 60 {
-		logrus.Warn("MonitorIterval[%d] > 60, use 60", cfg.MonitorIterval)
+		logrus.Warnf("MonitorIterval[%d] > 60, use 60", cfg.MonitorIterval)
+		cfg.MonitorIterval = 60
 	} else {
 		if 60%cfg.MonitorIterval > 0 {
 			return fmt.Errorf("MonitorIterval[%d] can not devide 60", cfg.MonitorIterval)
@@ -153,6 +160,10 @@ func basicConfCheck(cfg *ConfigBasic) error {
 		return fmt.Errorf("MaxHeaderBytes[%d] should be > 0", cfg.MaxHeaderBytes)
 	}
 
+	if cfg.MaxReqBodyPeekBytes < 0 {
+		return fmt.Errorf("MaxReqBodyPeekBytes[%d] should be >= 0", cfg.MaxReqBodyPeekBytes)
+	}
+
 	return nil
 }
 
@@ -171,37 +182,37 @@ func checkLayer4LoadBalancer(cfg *ConfigBasic) error {
 func dataFIleConfCheck(cfg *ConfigBasic, confRoot string) error {
 	if cfg.HostRuleConf == "" {
 		cfg.HostRuleConf = "server_data_conf/host_rule.data"
-		logrus.Warn("HostRuleConf not set use defaault value[%s]", cfg.HostRuleConf)
+		logrus.Warnf("HostRuleConf not set use defaault value[%s]", cfg.HostRuleConf)
 	}
 	cfg.HostRuleConf = bfe_util.ConfPathProc(cfg.HostRuleConf, confRoot)
 
 	if cfg.VipRuleConf == "" {
 		cfg.VipRuleConf = "server_data_conf/vip_rule.data"
-		logrus.Warn("VipRuleConf not set, use default value[%s]", cfg.VipRuleConf)
+		logrus.Warnf("VipRuleConf not set, use default value[%s]", cfg.VipRuleConf)
 	}
 	cfg.VipRuleConf = bfe_util.ConfPathProc(cfg.VipRuleConf, confRoot)
 
 	if cfg.RouteRuleConf == "" {
 		cfg.RouteRuleConf = "server_data_conf/route_rule.data"
-		logrus.Warn("RouteRuleConf not set, use default value[%s]", cfg.RouteRuleConf)
+		logrus.Warnf("RouteRuleConf not set, use default value[%s]", cfg.RouteRuleConf)
 	}
 	cfg.RouteRuleConf = bfe_util.ConfPathProc(cfg.RouteRuleConf, confRoot)
 
 	if cfg.ClusterTableConf == "" {
 		cfg.ClusterTableConf = "cluster_conf/cluster_table.data"
-		logrus.Warn("ClusterTableConf not set, use default value[%s]", cfg.ClusterTableConf)
+		logrus.Warnf("ClusterTableConf not set, use default value[%s]", cfg.ClusterTableConf)
 	}
 	cfg.ClusterTableConf = bfe_util.ConfPathProc(cfg.ClusterTableConf, confRoot)
 
 	if cfg.GslbConf == "" {
 		cfg.GslbConf = "cluster_conf/gslb.data"
-		logrus.Warn("GslbConf not set, use default value[%s]", cfg.GslbConf)
+		logrus.Warnf("GslbConf not set, use default value[%s]", cfg.GslbConf)
 	}
 	cfg.GslbConf = bfe_util.ConfPathProc(cfg.GslbConf, confRoot)
 
 	if cfg.ClusterConf == "" {
 		cfg.ClusterConf = "server_data_conf/cluster.data"
-		logrus.Warn("ClusterConf not set, use default value[%s]", cfg.ClusterConf)
+		logrus.Warnf("ClusterConf not set, use default value[%s]", cfg.ClusterConf)
 	}
 	cfg.ClusterConf = bfe_util.ConfPathProc(cfg.ClusterConf, confRoot)
 
@@ -18,7 +18,7 @@ var TlsVersionMap = map[string]uint16{
 }
 
 var CurvesMap = map[string]bfe_tls.CurveID{
-	"CurVeP256": bfe_tls.CurVeP256,
+	"CurveP256": bfe_tls.CurVeP256,
 	"CurveP384": bfe_tls.CurveP384,
 	"CurveP521": bfe_tls.CurveP521,
 }
@@ -97,14 +97,14 @@ func (cfg *ConfigHttpsBasic) Check(confRoot string) error {
 		ciphers := strings.Split(cipherGroup, EquivCipherSep)
 		for _, cipher := range ciphers {
 			if _, ok := CipherSuitesMap[cipher]; !ok {
-				return fmt.Errorf("cipher (%s) not support")
+				return fmt.Errorf("cipher (%s) not support", cipher)
 			}
 		}
 	}
 
 	for _, curve := range cfg.CurvePreferences {
 		if _, ok := CurvesMap[curve]; !ok {
-			return fmt.Errorf("curve (%s) not support")
+			return fmt.Errorf("curve (%s) not support", curve)
 		}
 	}
 
@@ -145,7 +145,7 @@ func tlsVersionCheck(cfg *ConfigHttpsBasic) error {
 	}
 
 	if len(cfg.MinTlsVersion) == 0 {
-		cfg.MinTlsVersion = "VersionSSl30"
+		cfg.MinTlsVersion = "VersionSSL30"
 	}
 
 	minTlsVer, ok := TlsVersionMap[cfg.MinTlsVersion]
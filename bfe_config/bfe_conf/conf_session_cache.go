@@ -25,6 +25,7 @@ func (cfg *ConfigSessionCache) SetDefaultConf() {
 	cfg.SessionCacheDisable = true
 	cfg.KeyPrefix = "bfe"
 	cfg.ConnectTimeout = 50
+	cfg.ReadTimeout = 50
 	cfg.WriteTimeout = 50
 	cfg.MaxIdle = 20
 	cfg.SessionExpire = 3600
@@ -35,6 +36,10 @@ func (cfg *ConfigSessionCache) Check(confRoot string) error {
 }
 
 func ConfSessionCacheCheck(cfg *ConfigSessionCache, confRoot string) error {
+	if cfg.SessionCacheDisable {
+		return nil
+	}
+
 	names := strings.Split(cfg.Servers, ",")
 	if len(cfg.Servers) == 0 || len(names) < 1 {
 		return fmt.Errorf("Servers[%s] invalid server names", cfg.Servers)
@@ -49,7 +54,7 @@ func ConfSessionCacheCheck(cfg *ConfigSessionCache, confRoot string) error {
 	}
 
 	if cfg.MaxIdle <= 0 {
-		return fmt.Errorf("MaxIdle[%s] should be > 0", cfg.MaxIdle)
+		return fmt.Errorf("MaxIdle[%d] should be > 0", cfg.MaxIdle)
 	}
 
 	if cfg.SessionExpire <= 0 {
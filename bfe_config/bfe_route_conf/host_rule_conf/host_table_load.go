@@ -38,7 +38,7 @@ func (conf *HostTableConf) LoadAndCheck(filename string) (string, error) {
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(*conf); err != nil {
+	if err := decoder.Decode(conf); err != nil {
 		return "", err
 	}
 
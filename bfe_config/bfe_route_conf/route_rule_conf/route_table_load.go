@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_basic/condition"
+	"github.com/crud-bird/bfe/bfe_basic/condition/parser"
 	"os"
+	"sort"
+	"strings"
 )
 
 type RouteRule struct {
@@ -26,6 +29,7 @@ type ProductRouteRuleFile map[string]RouteRuleFiles
 
 type RouteTableFile struct {
 	Version     *string
+	Vars        *map[string]string // named conditions, e.g. "$is_mobile"
 	ProductRule *ProductRouteRuleFile
 }
 
@@ -34,7 +38,7 @@ type RouteTableConf struct {
 	RuleMap ProductRouteRule
 }
 
-func convert(fileConf *RouteTableFile) (*RouteTableConf, error) {
+func convert(fileConf *RouteTableFile, filename string) (*RouteTableConf, error) {
 	conf := &RouteTableConf{
 		RuleMap: make(ProductRouteRule),
 	}
@@ -49,21 +53,33 @@ func convert(fileConf *RouteTableFile) (*RouteTableConf, error) {
 
 	conf.Version = *fileConf.Version
 
+	var vars *parser.VarTable
+	if fileConf.Vars != nil {
+		var err error
+		if vars, err = parser.NewVarTable(filename, *fileConf.Vars); err != nil {
+			return nil, fmt.Errorf("error build Vars [%s]", err)
+		}
+	}
+
+	// build all conditions to report all errors at once
+	var fails []string
 	for product, files := range *fileConf.ProductRule {
 		rules := make(RouteRules, len(files))
 		for i, file := range files {
 			if file.ClusterName == nil {
-				return nil, errors.New("no ClusterName")
+				return nil, fmt.Errorf("no ClusterName in rule[%s][%d]", product, i)
 			}
 
 			if file.Cond == nil {
-				return nil, errors.New("no cond")
+				return nil, fmt.Errorf("no cond in rule[%s][%d]", product, i)
 			}
 
 			rules[i].ClusterName = *file.ClusterName
-			cond, err := condition.Build(*file.Cond)
+			name := fmt.Sprintf("%s[%s][%d]", filename, product, i)
+			cond, err := condition.BuildWithVars(name, *file.Cond, vars)
 			if err != nil {
-				return nil, fmt.Errorf("error build [%s] [%s]", *file.Cond, err)
+				fails = append(fails, fmt.Sprintf("error build [%s] [%s]", *file.Cond, err))
+				continue
 			}
 			rules[i].Cond = cond
 		}
@@ -71,12 +87,17 @@ func convert(fileConf *RouteTableFile) (*RouteTableConf, error) {
 		conf.RuleMap[product] = rules
 	}
 
+	if len(fails) > 0 {
+		sort.Strings(fails)
+		return nil, errors.New(strings.Join(fails, "; "))
+	}
+
 	return conf, nil
 }
 
 func (conf *RouteTableConf) LoadAndCheck(filename string) (string, error) {
 	var fileConf RouteTableFile
-	file, err := os.Open("filename")
+	file, err := os.Open(filename)
 	if err != nil {
 		return "", err
 	}
@@ -87,7 +108,7 @@ func (conf *RouteTableConf) LoadAndCheck(filename string) (string, error) {
 		return "", err
 	}
 
-	pConf, err := convert(&fileConf)
+	pConf, err := convert(&fileConf, filename)
 	if err != nil {
 		return "", err
 	}
@@ -31,7 +31,7 @@ func (conf *VipTableConf) LoadAndCheck(filename string) (string, error) {
 
 	decoder := json.NewDecoder(file)
 	if err := decoder.Decode(conf); err != nil {
-		return "", nil
+		return "", err
 	}
 
 	if err := VipTableConfCheck(*conf); err != nil {
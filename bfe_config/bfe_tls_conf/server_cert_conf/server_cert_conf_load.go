@@ -0,0 +1,115 @@
+package server_cert_conf
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/crud-bird/bfe/bfe_util"
+)
+
+type ServerCertConf struct {
+	ServerCertFile string
+	ServerKeyFile  string
+}
+
+type ServerCertConfMap struct {
+	Default  string
+	CertConf map[string]ServerCertConf
+}
+
+type BfeServerCertConf struct {
+	Version string
+	Config  ServerCertConfMap
+}
+
+func (conf *BfeServerCertConf) LoadAndCheck(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(conf); err != nil {
+		return "", err
+	}
+
+	if err := BfeServerCertConfCheck(conf); err != nil {
+		return "", err
+	}
+
+	return conf.Version, nil
+}
+
+func BfeServerCertConfCheck(conf *BfeServerCertConf) error {
+	if conf.Version == "" {
+		return errors.New("no Version")
+	}
+
+	if len(conf.Config.CertConf) == 0 {
+		return errors.New("no CertConf")
+	}
+
+	if conf.Config.Default == "" {
+		return errors.New("no Default")
+	}
+
+	if _, ok := conf.Config.CertConf[conf.Config.Default]; !ok {
+		return fmt.Errorf("Default[%s] not in CertConf", conf.Config.Default)
+	}
+
+	for name, c := range conf.Config.CertConf {
+		if c.ServerCertFile == "" {
+			return fmt.Errorf("no ServerCertFile for %s", name)
+		}
+
+		if c.ServerKeyFile == "" {
+			return fmt.Errorf("no ServerKeyFile for %s", name)
+		}
+	}
+
+	return nil
+}
+
+// ServerCertConfLoad loads server cert conf and the certificates it refers to.
+// The first certificate returned is the default one.
+func ServerCertConfLoad(filename string, confRoot string) ([]tls.Certificate, error) {
+	var config BfeServerCertConf
+	if _, err := config.LoadAndCheck(filename); err != nil {
+		return nil, err
+	}
+
+	certs := make([]tls.Certificate, 0, len(config.Config.CertConf))
+
+	load := func(name string, c ServerCertConf) error {
+		certFile := bfe_util.ConfPathProc(c.ServerCertFile, confRoot)
+		keyFile := bfe_util.ConfPathProc(c.ServerKeyFile, confRoot)
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("load cert for %s: %s", name, err)
+		}
+
+		certs = append(certs, cert)
+		return nil
+	}
+
+	if err := load(config.Config.Default, config.Config.CertConf[config.Config.Default]); err != nil {
+		return nil, err
+	}
+
+	for name, c := range config.Config.CertConf {
+		if name == config.Config.Default {
+			continue
+		}
+
+		if err := load(name, c); err != nil {
+			return nil, err
+		}
+	}
+
+	return certs, nil
+}
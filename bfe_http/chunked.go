@@ -0,0 +1,176 @@
+package bfe_http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/crud-bird/bfe/bfe_bufio"
+)
+
+const maxLineLength = 4096
+
+var ErrLineTooLong = errors.New("header line too long")
+
+type chunkedReader struct {
+	r   *bfe_bufio.Reader
+	n   uint64
+	err error
+	buf [2]byte
+}
+
+func newChunkedReader(r *bfe_bufio.Reader) io.Reader {
+	return &chunkedReader{r: r}
+}
+
+func (cr *chunkedReader) beginChunk() {
+	var line []byte
+	line, cr.err = readLine(cr.r)
+	if cr.err != nil {
+		return
+	}
+
+	cr.n, cr.err = parseHexUint(line)
+	if cr.err != nil {
+		return
+	}
+
+	if cr.n == 0 {
+		cr.err = io.EOF
+	}
+}
+
+func (cr *chunkedReader) Read(b []byte) (n int, err error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+
+	if cr.n == 0 {
+		cr.beginChunk()
+		if cr.err != nil {
+			return 0, cr.err
+		}
+	}
+
+	if uint64(len(b)) > cr.n {
+		b = b[0:cr.n]
+	}
+
+	n, cr.err = cr.r.Read(b)
+	cr.n -= uint64(n)
+	if cr.n == 0 && cr.err == nil {
+		if _, cr.err = io.ReadFull(cr.r, cr.buf[:]); cr.err == nil {
+			if cr.buf[0] != '\r' || cr.buf[1] != '\n' {
+				cr.err = errors.New("malformed chunked encoding")
+			}
+		}
+	}
+
+	return n, cr.err
+}
+
+func readLine(b *bfe_bufio.Reader) ([]byte, error) {
+	p, err := b.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		} else if err == bfe_bufio.ErrBufferFull {
+			err = ErrLineTooLong
+		}
+		return nil, err
+	}
+
+	if len(p) >= maxLineLength {
+		return nil, ErrLineTooLong
+	}
+
+	return trimTrailingWhitespace(p), nil
+}
+
+func trimTrailingWhitespace(b []byte) []byte {
+	for len(b) > 0 && isASCIISpace(b[len(b)-1]) {
+		b = b[:len(b)-1]
+	}
+
+	return b
+}
+
+func isASCIISpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func parseHexUint(v []byte) (n uint64, err error) {
+	// chunk extensions are ignored
+	for i, b := range v {
+		if b == ';' {
+			v = v[:i]
+			break
+		}
+	}
+
+	if len(v) == 0 {
+		return 0, errors.New("empty hex number for chunk length")
+	}
+
+	for i, b := range v {
+		switch {
+		case '0' <= b && b <= '9':
+			b = b - '0'
+		case 'a' <= b && b <= 'f':
+			b = b - 'a' + 10
+		case 'A' <= b && b <= 'F':
+			b = b - 'A' + 10
+		default:
+			return 0, errors.New("invalid byte in chunk length")
+		}
+
+		if i == 16 {
+			return 0, errors.New("http chunk length too large")
+		}
+
+		n <<= 4
+		n |= uint64(b)
+	}
+
+	return n, nil
+}
+
+type chunkedWriter struct {
+	Wire io.Writer
+}
+
+func newChunkedWriter(w io.Writer) io.WriteCloser {
+	return &chunkedWriter{w}
+}
+
+func (cw *chunkedWriter) Write(data []byte) (n int, err error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	if _, err = io.WriteString(cw.Wire, strconv.FormatInt(int64(len(data)), 16)+"\r\n"); err != nil {
+		return 0, err
+	}
+
+	if n, err = cw.Wire.Write(data); err != nil {
+		return n, err
+	}
+
+	if n != len(data) {
+		return n, io.ErrShortWrite
+	}
+
+	_, err = io.WriteString(cw.Wire, "\r\n")
+
+	return n, err
+}
+
+func (cw *chunkedWriter) Close() error {
+	_, err := io.WriteString(cw.Wire, "0\r\n")
+	return err
+}
+
+func (cw *chunkedWriter) String() string {
+	return fmt.Sprintf("chunkedWriter(%T)", cw.Wire)
+}
@@ -1,5 +1,5 @@
 package bfe_http
 
 type RoundTripper interface {
-	RoudTrip(*Request) (*Response, error)
+	RoundTrip(*Request) (*Response, error)
 }
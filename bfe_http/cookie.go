@@ -62,7 +62,7 @@ func readSetCookies(h Header) []*Cookie {
 		}
 
 		name, value := parts[0][:j], parts[0][j+1:]
-		if !isCookieNameValid(name) {
+		if !IsCookieNameValid(name) {
 			continue
 		}
 		value, ok := parseCookieValue(value)
@@ -146,8 +146,11 @@ func SetCookie(w ResponseWriter, cookie *Cookie) {
 
 func (c *Cookie) String() string {
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "; Path=%s", sanitizeCookieName(c.Name), sanitizeCookieValue(c.Value))
+	fmt.Fprintf(&b, "%s=%s", sanitizeCookieName(c.Name), sanitizeCookieValue(c.Value))
 	if len(c.Path) > 0 {
+		fmt.Fprintf(&b, "; Path=%s", sanitizeCookiePath(c.Path))
+	}
+	if len(c.Domain) > 0 {
 		if validCookieDomain(c.Domain) {
 			d := c.Domain
 			if d[0] == '.' {
@@ -203,7 +206,7 @@ func readCookies(h Header, filter string) []*Cookie {
 				name, val = name[:j], name[j+1:]
 			}
 
-			if !isCookieNameValid(name) {
+			if !IsCookieNameValid(name) {
 				continue
 			}
 
@@ -358,7 +361,7 @@ func parseCookieEpiresValue(raw string) (string, bool) {
 
 func parseCookieValueUsing(raw string, validByte func(byte) bool) (string, bool) {
 	raw = unquoteCookieValue(raw)
-	for i := 0; i <= len(raw); i++ {
+	for i := 0; i < len(raw); i++ {
 		if !validByte(raw[i]) {
 			return "", false
 		}
@@ -367,6 +370,6 @@ func parseCookieValueUsing(raw string, validByte func(byte) bool) (string, bool)
 	return raw, true
 }
 
-func isCookieNameValid(raw string) bool {
+func IsCookieNameValid(raw string) bool {
 	return strings.IndexFunc(raw, isNotToken) < 0
 }
@@ -0,0 +1,53 @@
+package bfe_http
+
+import (
+	"testing"
+)
+
+func TestParseCookieValue(t *testing.T) {
+	tests := []struct {
+		raw   string
+		value string
+		ok    bool
+	}{
+		{"", "", true},
+		{"a", "a", true},
+		{"abc", "abc", true},
+		{`"abc"`, "abc", true},
+		{`""`, "", true},
+		{`"`, "", false},
+		{"a b", "", false},
+		{"a;b", "", false},
+		{"a\\b", "", false},
+	}
+
+	for _, tt := range tests {
+		value, ok := parseCookieValue(tt.raw)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("parseCookieValue(%q): got %q, %v, expect %q, %v", tt.raw, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestRequestCookie(t *testing.T) {
+	req := &Request{Header: Header{"Cookie": {`uid=u1; empty=; quoted="q1"; bad=a b; last=l`}}}
+
+	expect := map[string]string{"uid": "u1", "empty": "", "quoted": "q1", "last": "l"}
+	for name, value := range expect {
+		c, err := req.Cookie(name)
+		if err != nil {
+			t.Errorf("Cookie(%q): %s", name, err)
+			continue
+		}
+		if c.Value != value {
+			t.Errorf("Cookie(%q): got %q, expect %q", name, c.Value, value)
+		}
+	}
+
+	if c, err := req.Cookie("bad"); err != ErrNoCookie {
+		t.Errorf("Cookie(\"bad\"): got %v, %v, expect %v", c, err, ErrNoCookie)
+	}
+	if cookies := req.Cookies(); len(cookies) != len(expect) {
+		t.Errorf("Cookies(): got %d cookies, expect %d", len(cookies), len(expect))
+	}
+}
@@ -36,6 +36,10 @@ func (h Header) Del(key string) {
 	textproto.MIMEHeader(h).Del(key)
 }
 
+func CanonicalHeaderKey(s string) string {
+	return textproto.CanonicalMIMEHeaderKey(s)
+}
+
 func (h Header) Write(w io.Writer) error {
 	return h.WriteSubset(w, nil)
 }
@@ -1,5 +1,7 @@
 package bfe_http
 
+import "strings"
+
 var isTokenTable = [127]bool{
 	'!':  true,
 	'#':  true,
@@ -88,3 +90,39 @@ func isToken(r rune) bool {
 func isNotToken(r rune) bool {
 	return !isToken(r)
 }
+
+// hasToken reports whether token appears with v, ASCII
+// case-insensitive, with space or comma boundaries.
+func hasToken(v, token string) bool {
+	if len(token) > len(v) || token == "" {
+		return false
+	}
+
+	if v == token {
+		return true
+	}
+
+	for sp := 0; sp <= len(v)-len(token); sp++ {
+		if b := v[sp]; b != token[0] && b|0x20 != token[0] {
+			continue
+		}
+
+		if sp > 0 && !isTokenBoundary(v[sp-1]) {
+			continue
+		}
+
+		if endPos := sp + len(token); endPos != len(v) && !isTokenBoundary(v[endPos]) {
+			continue
+		}
+
+		if strings.EqualFold(v[sp:sp+len(token)], token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTokenBoundary(b byte) bool {
+	return b == ' ' || b == ',' || b == '\t'
+}
@@ -3,7 +3,7 @@ package bfe_http
 import (
 	"errors"
 	"fmt"
-	// 	"github.com/crud-bird/bfe/bfe_bufio"
+	"github.com/crud-bird/bfe/bfe_bufio"
 	"github.com/crud-bird/bfe/bfe_net/textproto"
 	"github.com/crud-bird/bfe/bfe_tls"
 	"io"
@@ -11,6 +11,8 @@ import (
 	"mime/multipart"
 	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -172,87 +174,176 @@ func valueOrDefault(value, def string) string {
 
 const defaultUserAgent = "Go 1.1 package http"
 
-// func (r *Request) Write(w io.Writer) error {
-// 	return r.write(w, false, nil)
-// }
-//
-// func (r *Request) WriteProxy(w io.Writer) error {
-// 	return r.write(w, true, nil)
-// }
-
-// func (r *Request) write(w io.Writer, usingProxy bool, header Header) error {
-// 	host := r.Host
-// 	if host == "" {
-// 		if r.URL == nil {
-// 			return errors.New("http: Request.Write on Request without host or url")
-// 		}
-// 		host = r.URL.Host
-// 	}
-//
-// 	ruri := r.URL.RequestURI()
-// 	if usingProxy && r.URL.Scheme != "" && r.URL.Opaque == "" {
-// 		ruri = r.URL.Scheme + "://" +host + ruri
-// 	} else if r.Method == "CONNECT" && r.URL.Path == "" {
-// 		ruri = host
-// 	} else {
-// 		rawurl, err := url.ParseRequestURI(r.RequestURI)
-// 		if err == nil && rawurl.RequestURI() == ruri {
-// 			if rawurl.Scheme == "" && rawurl.Host == "" &&rawurl.Opaque == "" {
-// 				ruri = r.RequestURI
-// 			}
-// 		}
-// 	}
-//
-// 	var bw *bfe_bufio.Writer
-//
-// 	switch w.(type) {
-// 	case io.ByteWriter:
-// 	case *MaxLatencyWriter:
-// 	default:
-// 		bw = bfe_bufio.NewWriter(w)
-// 		w = bw
-// 	}
-//
-// 	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", valueOrDefault(r.Method, "GET"), ruri)
-// 	fmt.Fprintf(w, "Host: %s\r\n", host)
-//
-// 	tw, err := newTransferWriter(r)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = tw.WriteHeader(w)
-// 	if err != nil {
-// 		return err
-// 	}
-//
-// 	if err = r.Header.WriteSubset(w, ReqWriteExcludeHeader); err != nil {
-// 		return err
-// 	}
-//
-// 	if header != nil {
-// 		if err = header.Write(w); err != nil {
-// 			return err
-// 		}
-// 	}
-//
-// 	io.WriteString(w, "\r\n")
-//
-// 	if rbw, ok := w.(Flusher); ok {
-// 		if err = rbw.Flush(); err !=nil {
-// 			return err
-// 		}
-// 	}
-//
-// 	n, err := tw.WriteBody(w)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	r.State.BodySize = uint32(n)
-//
-// 	if bw != nil {
-// 		return bw.Flush()
-// 	}
-//
-// 	return nil
-// }
-// todo
+func (r *Request) Write(w io.Writer) error {
+	return r.write(w, false, nil)
+}
+
+func (r *Request) WriteProxy(w io.Writer) error {
+	return r.write(w, true, nil)
+}
+
+func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders Header) error {
+	host := r.Host
+	if host == "" {
+		if r.URL == nil {
+			return errors.New("http: Request.Write on Request with no Host or URL set")
+		}
+		host = r.URL.Host
+	}
+
+	ruri := r.URL.RequestURI()
+	if usingProxy && r.URL.Scheme != "" && r.URL.Opaque == "" {
+		ruri = r.URL.Scheme + "://" + host + ruri
+	} else if r.Method == "CONNECT" && r.URL.Path == "" {
+		ruri = host
+	}
+
+	var bw *bfe_bufio.Writer
+	if _, ok := w.(io.ByteWriter); !ok {
+		bw = bfe_bufio.NewWriter(w)
+		w = bw
+	}
+
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", valueOrDefault(r.Method, "GET"), ruri)
+	fmt.Fprintf(w, "Host: %s\r\n", host)
+
+	userAgent := defaultUserAgent
+	if r.Header != nil {
+		if ua := r.Header["User-Agent"]; len(ua) > 0 {
+			userAgent = ua[0]
+		}
+	}
+	if userAgent != "" {
+		fmt.Fprintf(w, "User-Agent: %s\r\n", userAgent)
+	}
+
+	tw, err := newTransferWriter(r)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(w); err != nil {
+		return err
+	}
+
+	if err = r.Header.WriteSubset(w, reqWriteExcludeHeader); err != nil {
+		return err
+	}
+
+	if extraHeaders != nil {
+		if err = extraHeaders.Write(w); err != nil {
+			return err
+		}
+	}
+
+	if _, err = io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	n, err := tw.WriteBody(w)
+	if err != nil {
+		return err
+	}
+	if r.State != nil {
+		r.State.BodySize = uint32(n)
+	}
+
+	if bw != nil {
+		return bw.Flush()
+	}
+
+	return nil
+}
+
+func ParseHTTPVersion(vers string) (major, minor int, ok bool) {
+	const Big = 1000000
+	switch vers {
+	case "HTTP/1.1":
+		return 1, 1, true
+	case "HTTP/1.0":
+		return 1, 0, true
+	}
+
+	if !strings.HasPrefix(vers, "HTTP/") {
+		return 0, 0, false
+	}
+
+	dot := strings.Index(vers, ".")
+	if dot < 0 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(vers[5:dot])
+	if err != nil || major < 0 || major > Big {
+		return 0, 0, false
+	}
+
+	minor, err = strconv.Atoi(vers[dot+1:])
+	if err != nil || minor < 0 || minor > Big {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
+
+// ReadRequest reads and parses a request from b. The request line is
+// limited to maxUriSize bytes.
+func ReadRequest(b *bfe_bufio.Reader, maxUriSize int) (req *Request, err error) {
+	tp := textproto.NewReader(b)
+	req = new(Request)
+	req.State = new(RequestState)
+
+	var s string
+	if s, err = tp.ReadLine(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maxUriSize > 0 && len(s) > maxUriSize {
+		return nil, ErrUriTooLong
+	}
+	req.State.HeaderSize = uint32(len(s))
+
+	var f []string
+	if f = strings.SplitN(s, " ", 3); len(f) < 3 {
+		return nil, &badStringError{"malformed HTTP request", s}
+	}
+
+	var rawurl string
+	req.Method, rawurl, req.Proto = f[0], f[1], f[2]
+	var ok bool
+	if req.ProtoMajor, req.ProtoMinor, ok = ParseHTTPVersion(req.Proto); !ok {
+		return nil, &badStringError{"malformed HTTP version", req.Proto}
+	}
+
+	req.RequestURI = rawurl
+	if req.URL, err = url.ParseRequestURI(rawurl); err != nil {
+		return nil, err
+	}
+
+	mimeHeader, mimeKeys, err := tp.ReadMIMEHeaderAndKeys()
+	if err != nil {
+		return nil, err
+	}
+	req.Header = Header(mimeHeader)
+	req.HeaderKeys = mimeKeys
+
+	req.Host = req.URL.Host
+	if req.Host == "" {
+		req.Host = req.Header.Get("Host")
+	}
+	req.Header.Del("Host")
+
+	fixPragmaCacheControl(req.Header)
+
+	if err = readTransfer(req, b); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+var ErrUriTooLong = &ProtocolError{"request uri too long"}
@@ -1,8 +1,14 @@
 package bfe_http
 
 import (
-	"github.com/crud-bird/bfe/bfe_tls"
+	"errors"
 	"io"
+	"strconv"
+	"strings"
+
+	"github.com/crud-bird/bfe/bfe_bufio"
+	"github.com/crud-bird/bfe/bfe_net/textproto"
+	"github.com/crud-bird/bfe/bfe_tls"
 )
 
 var respExcludeHeader = map[string]bool{
@@ -22,12 +28,120 @@ type Response struct {
 	ProtoMajor       int
 	ProtoMinor       int
 	Header           Header
+	HeaderKeys       textproto.MIMEKeys
 	Body             io.ReadCloser
 	ContentLength    int64
 	TransferEncoding []string
 	Signer           SignCalculater
-	CLose            bool
+	Close            bool
 	Trailer          Header
 	Request          *Request
 	TLS              *bfe_tls.ConnectionState
 }
+
+func (r *Response) Cookies() []*Cookie {
+	return readSetCookies(r.Header)
+}
+
+func (r *Response) ProtoAtLeast(major, minor int) bool {
+	return r.ProtoMajor > major || r.ProtoMajor == major && r.ProtoMinor >= minor
+}
+
+func ReadResponse(r *bfe_bufio.Reader, req *Request) (*Response, error) {
+	tp := textproto.NewReader(r)
+	resp := &Response{
+		Request: req,
+	}
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	f := strings.SplitN(line, " ", 3)
+	if len(f) < 2 {
+		return nil, &badStringError{"malformed HTTP response", line}
+	}
+	reasonPhrase := ""
+	if len(f) > 2 {
+		reasonPhrase = f[2]
+	}
+	resp.Status = f[1] + " " + reasonPhrase
+	resp.StatusCode, err = strconv.Atoi(f[1])
+	if err != nil || len(f[1]) != 3 {
+		return nil, &badStringError{"malformed HTTP status code", f[1]}
+	}
+
+	resp.Proto = f[0]
+	var ok bool
+	if resp.ProtoMajor, resp.ProtoMinor, ok = ParseHTTPVersion(resp.Proto); !ok {
+		return nil, &badStringError{"malformed HTTP version", resp.Proto}
+	}
+
+	mimeHeader, mimeKeys, err := tp.ReadMIMEHeaderAndKeys()
+	if err != nil {
+		return nil, err
+	}
+	resp.Header = Header(mimeHeader)
+	resp.HeaderKeys = mimeKeys
+
+	fixPragmaCacheControl(resp.Header)
+
+	if err = readTransfer(resp, r); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func fixPragmaCacheControl(header Header) {
+	if hp, ok := header["Pragma"]; ok && len(hp) > 0 && hp[0] == "no-cache" {
+		if _, presentcc := header["Cache-Control"]; !presentcc {
+			header["Cache-Control"] = []string{"no-cache"}
+		}
+	}
+}
+
+var ErrResponseWrite = errors.New("http: write response error")
+
+func (r *Response) Write(w io.Writer) error {
+	text := r.Status
+	if text == "" {
+		text = StatusText(r.StatusCode)
+		if text == "" {
+			text = "status code " + strconv.Itoa(r.StatusCode)
+		}
+	} else {
+		text = strings.TrimPrefix(text, strconv.Itoa(r.StatusCode)+" ")
+	}
+
+	protoMajor, protoMinor := strconv.Itoa(r.ProtoMajor), strconv.Itoa(r.ProtoMinor)
+	if _, err := io.WriteString(w, "HTTP/"+protoMajor+"."+protoMinor+" "+strconv.Itoa(r.StatusCode)+" "+text+"\r\n"); err != nil {
+		return err
+	}
+
+	tw, err := newTransferWriter(r)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(w); err != nil {
+		return err
+	}
+
+	if err = r.Header.WriteSubset(w, respExcludeHeader); err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	if _, err = tw.WriteBody(w); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,415 @@
+package bfe_http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_bufio"
+)
+
+const DefaultMaxIdleConnsPerHost = 2
+
+// errors returned by Transport.RoundTrip, so that the caller can tell
+// in which stage the round trip fails
+type ConnectError struct {
+	Addr string
+	Err  error
+}
+
+func (e ConnectError) Error() string {
+	return fmt.Sprintf("connect %s: %s", e.Addr, e.Err)
+}
+
+type WriteRequestError struct {
+	Err error
+}
+
+func (e WriteRequestError) Error() string {
+	return fmt.Sprintf("write request: %s", e.Err)
+}
+
+type ReadRespHeaderError struct {
+	Err error
+}
+
+func (e ReadRespHeaderError) Error() string {
+	return fmt.Sprintf("read response header: %s", e.Err)
+}
+
+type RespHeaderTimeoutError struct{}
+
+func (e RespHeaderTimeoutError) Error() string {
+	return "timeout awaiting response headers"
+}
+
+var ErrTransportClosed = errors.New("http: transport closed")
+
+var errRequestCanceled = errors.New("http: request canceled")
+
+// Transport is a RoundTripper for HTTP/1.x backends, which caches
+// idle connections for future re-use.
+type Transport struct {
+	idleMu   sync.Mutex
+	idleConn map[string][]*persistConn
+	closed   bool
+
+	reqMu       sync.Mutex
+	reqCanceler map[*Request]func()
+
+	// Dial specifies the dial function for creating TCP connections
+	Dial func(network, addr string) (net.Conn, error)
+
+	// ConnectTimeout is the timeout of connecting to backend
+	ConnectTimeout time.Duration
+
+	// ResponseHeaderTimeout is the amount of time to wait for response
+	// headers after fully writing the request
+	ResponseHeaderTimeout time.Duration
+
+	MaxIdleConnsPerHost int
+
+	DisableKeepAlives bool
+}
+
+func (t *Transport) RoundTrip(req *Request) (*Response, error) {
+	if req.URL == nil {
+		return nil, errors.New("http: nil Request.URL")
+	}
+
+	if req.Header == nil {
+		return nil, errors.New("http: nil Request.Header")
+	}
+
+	addr := req.URL.Host
+	if addr == "" {
+		return nil, errors.New("http: no Host in request URL")
+	}
+
+	// request may be cancelled while connecting backend
+	cancelc := make(chan struct{})
+	var cancelOnce sync.Once
+	t.setReqCanceler(req, func() {
+		cancelOnce.Do(func() { close(cancelc) })
+	})
+
+	pconn, err := t.getConn(addr, cancelc)
+	if err != nil {
+		t.setReqCanceler(req, nil)
+		return nil, err
+	}
+
+	if !t.replaceReqCanceler(req, pconn.close) {
+		// cancelled before request is sent, conn is still usable
+		t.putIdleConn(pconn)
+		return nil, ConnectError{Addr: addr, Err: errRequestCanceled}
+	}
+	resp, err := pconn.roundTrip(req)
+	t.setReqCanceler(req, nil)
+
+	return resp, err
+}
+
+// CancelRequest cancels an in-flight request. Request connecting backend
+// gives up, and request which has been sent is cancelled by closing its
+// connection. Request which has got response header is not affected.
+func (t *Transport) CancelRequest(req *Request) {
+	t.reqMu.Lock()
+	cancel := t.reqCanceler[req]
+	delete(t.reqCanceler, req)
+	t.reqMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// replaceReqCanceler replaces canceler of request, and returns false if
+// request has been cancelled
+func (t *Transport) replaceReqCanceler(req *Request, fn func()) bool {
+	t.reqMu.Lock()
+	defer t.reqMu.Unlock()
+
+	if _, ok := t.reqCanceler[req]; !ok {
+		return false
+	}
+	t.reqCanceler[req] = fn
+
+	return true
+}
+
+func (t *Transport) setReqCanceler(req *Request, fn func()) {
+	t.reqMu.Lock()
+	defer t.reqMu.Unlock()
+
+	if t.reqCanceler == nil {
+		t.reqCanceler = make(map[*Request]func())
+	}
+	if fn != nil {
+		t.reqCanceler[req] = fn
+	} else {
+		delete(t.reqCanceler, req)
+	}
+}
+
+// CloseIdleConnections closes any connections which were previously
+// connected from previous requests but are now sitting idle.
+func (t *Transport) CloseIdleConnections() {
+	t.idleMu.Lock()
+	m := t.idleConn
+	t.idleConn = nil
+	t.idleMu.Unlock()
+
+	for _, conns := range m {
+		for _, pconn := range conns {
+			pconn.close()
+		}
+	}
+}
+
+func (t *Transport) maxIdleConnsPerHost() int {
+	if t.MaxIdleConnsPerHost > 0 {
+		return t.MaxIdleConnsPerHost
+	}
+
+	return DefaultMaxIdleConnsPerHost
+}
+
+func (t *Transport) putIdleConn(pconn *persistConn) bool {
+	if t.DisableKeepAlives {
+		pconn.close()
+		return false
+	}
+
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+
+	if t.idleConn == nil {
+		t.idleConn = make(map[string][]*persistConn)
+	}
+
+	if len(t.idleConn[pconn.addr]) >= t.maxIdleConnsPerHost() {
+		pconn.close()
+		return false
+	}
+
+	t.idleConn[pconn.addr] = append(t.idleConn[pconn.addr], pconn)
+
+	return true
+}
+
+func (t *Transport) getIdleConn(addr string) *persistConn {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+
+	for {
+		conns := t.idleConn[addr]
+		if len(conns) == 0 {
+			return nil
+		}
+
+		pconn := conns[len(conns)-1]
+		t.idleConn[addr] = conns[:len(conns)-1]
+		if !pconn.isBroken() {
+			return pconn
+		}
+	}
+}
+
+func (t *Transport) dial(addr string) (net.Conn, error) {
+	if t.Dial != nil {
+		return t.Dial("tcp", addr)
+	}
+
+	if t.ConnectTimeout > 0 {
+		return net.DialTimeout("tcp", addr, t.ConnectTimeout)
+	}
+
+	return net.Dial("tcp", addr)
+}
+
+// getConn returns an idle conn to addr, or a new one. Connecting gives up
+// if cancelc is closed.
+func (t *Transport) getConn(addr string, cancelc <-chan struct{}) (*persistConn, error) {
+	if pconn := t.getIdleConn(addr); pconn != nil {
+		return pconn, nil
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	dialc := make(chan dialResult, 1)
+	go func() {
+		conn, err := t.dial(addr)
+		dialc <- dialResult{conn, err}
+	}()
+
+	var conn net.Conn
+	select {
+	case res := <-dialc:
+		if res.err != nil {
+			return nil, ConnectError{Addr: addr, Err: res.err}
+		}
+		conn = res.conn
+	case <-cancelc:
+		// conn established after cancellation is not used
+		go func() {
+			if res := <-dialc; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ConnectError{Addr: addr, Err: errRequestCanceled}
+	}
+
+	return &persistConn{
+		t:    t,
+		addr: addr,
+		conn: conn,
+		br:   bfe_bufio.NewReader(conn),
+		bw:   bfe_bufio.NewWriter(conn),
+	}, nil
+}
+
+// persistConn wraps a connection, usually a persistent one
+type persistConn struct {
+	t    *Transport
+	addr string
+	conn net.Conn
+	br   *bfe_bufio.Reader
+	bw   *bfe_bufio.Writer
+
+	mu     sync.Mutex
+	broken bool
+}
+
+func (pc *persistConn) isBroken() bool {
+	pc.mu.Lock()
+	b := pc.broken
+	pc.mu.Unlock()
+
+	return b
+}
+
+func (pc *persistConn) close() {
+	pc.mu.Lock()
+	if !pc.broken {
+		pc.broken = true
+		pc.conn.Close()
+	}
+	pc.mu.Unlock()
+}
+
+func (pc *persistConn) roundTrip(req *Request) (*Response, error) {
+	if err := req.write(pc.bw, false, nil); err != nil {
+		pc.close()
+		return nil, WriteRequestError{Err: err}
+	}
+
+	if err := pc.bw.Flush(); err != nil {
+		pc.close()
+		return nil, WriteRequestError{Err: err}
+	}
+
+	if pc.t.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Now().Add(pc.t.ResponseHeaderTimeout))
+	}
+
+	resp, err := ReadResponse(pc.br, req)
+	if err != nil {
+		pc.close()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil, RespHeaderTimeoutError{}
+		}
+		return nil, ReadRespHeaderError{Err: err}
+	}
+
+	if pc.t.ResponseHeaderTimeout > 0 {
+		pc.conn.SetReadDeadline(time.Time{})
+	}
+
+	alive := !resp.Close && !req.wantsClose()
+	if resp.Body == eofReader {
+		if alive {
+			pc.t.putIdleConn(pc)
+		} else {
+			pc.close()
+		}
+		return resp, nil
+	}
+
+	resp.Body = &bodyEOFSignal{
+		body: resp.Body,
+		fn: func(err error) {
+			if err == io.EOF && alive {
+				pc.t.putIdleConn(pc)
+				return
+			}
+			pc.close()
+		},
+	}
+
+	return resp, nil
+}
+
+func (r *Request) wantsClose() bool {
+	return hasToken(r.Header.Get("Connection"), "close")
+}
+
+// bodyEOFSignal wraps a ReadCloser and calls fn exactly once when the
+// body is fully read (with io.EOF) or closed before that.
+type bodyEOFSignal struct {
+	body io.ReadCloser
+	mu   sync.Mutex
+	done bool
+	rerr error // error returned by reads after done
+	fn   func(error)
+}
+
+func (es *bodyEOFSignal) Read(p []byte) (n int, err error) {
+	es.mu.Lock()
+	done, rerr := es.done, es.rerr
+	es.mu.Unlock()
+	if done {
+		return 0, rerr
+	}
+
+	n, err = es.body.Read(p)
+	if err != nil {
+		es.condfn(err)
+	}
+
+	return n, err
+}
+
+func (es *bodyEOFSignal) Close() error {
+	es.mu.Lock()
+	done := es.done
+	es.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	err := es.body.Close()
+	es.condfn(errors.New("body closed before EOF"))
+	es.mu.Lock()
+	es.rerr = ErrBodyReadAfterClose
+	es.mu.Unlock()
+
+	return err
+}
+
+func (es *bodyEOFSignal) condfn(err error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.done {
+		return
+	}
+	es.done = true
+	es.rerr = err
+	es.fn(err)
+}
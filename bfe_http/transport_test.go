@@ -0,0 +1,57 @@
+package bfe_http
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCancelRequestConnecting(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	dialing, connected := make(chan bool), make(chan bool)
+	tr := &Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			close(dialing)
+			<-connected
+			return client, nil
+		},
+	}
+
+	req := &Request{
+		Method: "GET",
+		URL:    &url.URL{Scheme: "http", Host: "example.org:80", Path: "/"},
+		Header: make(Header),
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(req)
+		errc <- err
+	}()
+
+	<-dialing
+	tr.CancelRequest(req)
+	select {
+	case err := <-errc:
+		if _, ok := err.(ConnectError); !ok {
+			t.Errorf("got error %v, expect ConnectError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request connecting backend not cancelled")
+	}
+
+	// conn established after cancellation is closed
+	close(connected)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := server.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("conn not closed: %v", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
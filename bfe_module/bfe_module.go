@@ -50,14 +50,14 @@ func (bm *BfeModules) GetModule(name string) BfeModule {
 	return bm.workModule[name]
 }
 
-func (bm *BfeModules) Init(cbs *BfeCallbacks, whs *web_monitor.WebHandler, cr string) error {
+func (bm *BfeModules) Init(cbs *BfeCallbacks, whs *web_monitor.WebHandlers, cr string) error {
 	for _, name := range modulesAll {
 		if module, ok := bm.workModule[name]; ok {
 			if err := module.Init(cbs, whs, cr); err != nil {
 				logrus.Errorf("Err in module init for %s [%s]", module.Name(), err.Error())
 				return err
 			}
-			logrus.Errorf("%s: init ok", module.Name)
+			logrus.Infof("%s: init ok", module.Name())
 			modulesEnabled = append(modulesEnabled, name)
 		}
 	}
@@ -74,7 +74,7 @@ func ModConfDir(confRoot string, modName string) string {
 }
 
 func ModuleStatusGetJson() ([]byte, error) {
-	return json.Marhsal(map[string][]string{
+	return json.Marshal(map[string][]string{
 		"available": modulesAll,
 		"enabled":   modulesEnabled,
 	})
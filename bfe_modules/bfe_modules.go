@@ -1 +1,18 @@
 package bfe_modules
+
+import (
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/crud-bird/bfe/bfe_modules/mod_access"
+	"github.com/crud-bird/bfe/bfe_modules/mod_header"
+)
+
+var moduleList = []bfe_module.BfeModule{
+	mod_access.NewModuleAccess(),
+	mod_header.NewModuleHeader(),
+}
+
+func SetModules() {
+	for _, module := range moduleList {
+		bfe_module.AddModule(module)
+	}
+}
@@ -37,6 +37,7 @@ const (
 	FormatResProto
 	FormatResStatus
 	FormatRetryNum
+	FormatRetryDecision
 	FormatServerAddr
 	FormatSinceSessionTime
 	FormatSubclusterName
@@ -107,6 +108,7 @@ var (
 		"res_proto":             FormatResProto,
 		"response_duration":     FormatResDuration,
 		"retry_num":             FormatRetryNum,
+		"retry_decision":        FormatRetryDecision,
 		"server_addr":           FormatServerAddr,
 		"since_ses_start_time":  FormatSinceSessionTime,
 		"status_code":           FormatStatusCode,
@@ -169,6 +171,7 @@ var (
 		FormatResProto:            Request,
 		FormatResStatus:           Request,
 		FormatRetryNum:            Request,
+		FormatRetryDecision:       Request,
 		FormatServerAddr:          Request,
 		FormatSinceSessionTime:    Request,
 		FormatSubclusterName:      Request,
@@ -225,6 +228,7 @@ var (
 		FormatResProto:            onLogFmtResProto,
 		FormatResStatus:           onLogFmtResStatus,
 		FormatRetryNum:            onLogFmtRetryNum,
+		FormatRetryDecision:       onLogFmtRetryDecision,
 		FormatServerAddr:          onLogFmtServerAddr,
 		FormatSinceSessionTime:    onLogFmtSinceSessionTime,
 		FormatStatusCode:          onLogFmtStatusCode,
@@ -110,7 +110,7 @@ func (m *ModuleAccess) requestLogHandler(req *bfe_basic.Request, res *bfe_http.R
 		case FormatString:
 			byteStr.WriteString(item.Key)
 		case FormatTime:
-			onLogFmtTime(m, byteStr)
+			onLogFmtTime(m, &item, byteStr, req, res)
 		default:
 			if handler, ok := fmtHandlerTable[item.Type]; ok {
 				h := handler.(func(*ModuleAccess, *LogFmtItem, *bytes.Buffer, *bfe_basic.Request, *bfe_http.Response) error)
@@ -133,7 +133,7 @@ func (m *ModuleAccess) sessionLogHandler(session *bfe_basic.Session) int {
 		case FormatString:
 			byteStr.WriteString(item.Key)
 		case FormatTime:
-			onLogFmtTime(m, byteStr)
+			onLogFmtTime(m, &item, byteStr, nil, nil)
 		default:
 			if handler, ok := fmtHandlerTable[item.Type]; ok {
 				h := handler.(func(*ModuleAccess, *LogFmtItem, *bytes.Buffer, *bfe_basic.Session) error)
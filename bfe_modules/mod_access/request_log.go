@@ -53,6 +53,21 @@ func onLogFmtBodyLenIn(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer,
 	return nil
 }
 
+func onLogFmtBodyLenOut(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer, req *bfe_basic.Request, res *bfe_http.Response) error {
+	if req == nil {
+		return errors.New("req is nil")
+	}
+
+	if req.Stat == nil {
+		return errors.New("req.Stat is nil")
+	}
+
+	msg := fmt.Sprintf("%d", req.Stat.BodyLenOut)
+	buff.WriteString(msg)
+
+	return nil
+}
+
 func onLogFmtClientReadTime(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer, req *bfe_basic.Request, res *bfe_http.Response) error {
 	if req == nil {
 		return errors.New("req is nil")
@@ -278,7 +293,7 @@ func onLogFmtProxyDelayTime(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Bu
 	msg := "-"
 	if !req.Stat.BackendFirst.IsZero() {
 		ms := req.Stat.BackendFirst.Sub(req.Stat.ReadReqEnd).Nanoseconds() / 1000000
-		msg = fm.Sprintf("%d", ms)
+		msg = fmt.Sprintf("%d", ms)
 	}
 	buff.WriteString(msg)
 
@@ -381,8 +396,7 @@ func onLogFmtReqHeaderLen(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buff
 		return errors.New("req.Stat is nil")
 	}
 
-msg:
-	fmt.Sprintf("%d", req.Stat.HeaderLenIn)
+	msg := fmt.Sprintf("%d", req.Stat.HeaderLenIn)
 	buff.WriteString(msg)
 
 	return nil
@@ -400,7 +414,7 @@ func onLogFmtRequestHeader(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buf
 	if data := req.HttpRequest.Header.Get(logItem.Key); data != "" {
 		msg = data
 	}
-	buff.WriteString("msg")
+	buff.WriteString(msg)
 
 	return nil
 }
@@ -531,6 +545,20 @@ func onLogFmtRetryNum(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer,
 	return nil
 }
 
+func onLogFmtRetryDecision(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer, req *bfe_basic.Request, res *bfe_http.Response) error {
+	if req == nil {
+		return errors.New("req is nil")
+	}
+
+	msg := "-"
+	if len(req.RetryDecisions) > 0 {
+		msg = strings.Join(req.RetryDecisions, ",")
+	}
+	buff.WriteString(msg)
+
+	return nil
+}
+
 func onLogFmtServerAddr(m *ModuleAccess, logItem *LogFmtItem, buff *bytes.Buffer, req *bfe_basic.Request, res *bfe_http.Response) error {
 	if req == nil {
 		return errors.New("rea is nil")
@@ -0,0 +1,38 @@
+package mod_header
+
+import (
+	"github.com/crud-bird/bfe/bfe_util"
+	"github.com/sirupsen/logrus"
+	gcfg "gopkg.in/gcfg.v1"
+)
+
+type ConfModHeader struct {
+	Basic struct {
+		DataPath string // path of header rule data
+	}
+}
+
+func ConfLoad(filePath string, confRoot string) (*ConfModHeader, error) {
+	var err error
+	var cfg ConfModHeader
+
+	if err = gcfg.ReadFileInto(&cfg, filePath); err != nil {
+		return &cfg, err
+	}
+
+	if err = cfg.Check(confRoot); err != nil {
+		return &cfg, err
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *ConfModHeader) Check(confRoot string) error {
+	if cfg.Basic.DataPath == "" {
+		cfg.Basic.DataPath = "mod_header/header_rule.data"
+		logrus.Warnf("ModHeader.DataPath not set, use default value[%s]", cfg.Basic.DataPath)
+	}
+	cfg.Basic.DataPath = bfe_util.ConfPathProc(cfg.Basic.DataPath, confRoot)
+
+	return nil
+}
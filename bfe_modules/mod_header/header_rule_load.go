@@ -0,0 +1,133 @@
+package mod_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/crud-bird/bfe/bfe_basic/action"
+	"github.com/crud-bird/bfe/bfe_basic/condition"
+)
+
+var allowActions = map[string]bool{
+	// request actions
+	action.ActionReqHeaderAdd:     true,
+	action.ActionReqHeaderSet:     true,
+	action.ActionReqHeaderDel:     true,
+	action.ActionPathRegexReplace: true,
+	action.ActionQueryAdd:         true,
+
+	// response actions
+	action.ActionRspHeaderAdd: true,
+	action.ActionRspHeaderSet: true,
+	action.ActionRspHeaderDel: true,
+	action.ActionRspCookieSet: true,
+	action.ActionRspStatusSet: true,
+}
+
+type HeaderRuleFile struct {
+	Cond    *string
+	Actions *[]action.Action
+	Last    *bool // stop checking following rules if matched
+}
+
+type HeaderRule struct {
+	Cond       condition.Condition
+	ReqActions []action.Action // applied at HANDLE_AFTER_LOCATION
+	RspActions []action.Action // applied at HANDLE_READ_BACKEND
+	Last       bool
+}
+
+type RuleFileList []HeaderRuleFile
+type RuleList []HeaderRule
+
+type ProductRulesFile map[string]RuleFileList
+type ProductRules map[string]RuleList
+
+type HeaderConfFile struct {
+	Version *string
+	Config  *ProductRulesFile
+}
+
+type HeaderConf struct {
+	Version string
+	Config  ProductRules
+}
+
+func ruleConvert(ruleFile HeaderRuleFile) (HeaderRule, error) {
+	var rule HeaderRule
+
+	if ruleFile.Cond == nil {
+		return rule, fmt.Errorf("no Cond")
+	}
+	if ruleFile.Actions == nil {
+		return rule, fmt.Errorf("no Actions")
+	}
+
+	cond, err := condition.Build(*ruleFile.Cond)
+	if err != nil {
+		return rule, fmt.Errorf("error build [%s] [%s]", *ruleFile.Cond, err)
+	}
+	rule.Cond = cond
+
+	for _, ac := range *ruleFile.Actions {
+		if err := ac.Check(allowActions); err != nil {
+			return rule, err
+		}
+
+		if action.IsResponseAction(ac.Cmd) {
+			rule.RspActions = append(rule.RspActions, ac)
+		} else {
+			rule.ReqActions = append(rule.ReqActions, ac)
+		}
+	}
+
+	if ruleFile.Last != nil {
+		rule.Last = *ruleFile.Last
+	}
+
+	return rule, nil
+}
+
+func HeaderConfCheck(conf HeaderConfFile) (HeaderConf, error) {
+	var headerConf HeaderConf
+
+	if conf.Version == nil {
+		return headerConf, fmt.Errorf("no Version")
+	}
+	if conf.Config == nil {
+		return headerConf, fmt.Errorf("no Config")
+	}
+
+	headerConf.Version = *conf.Version
+	headerConf.Config = make(ProductRules)
+	for product, ruleFiles := range *conf.Config {
+		rules := make(RuleList, 0, len(ruleFiles))
+		for i, ruleFile := range ruleFiles {
+			rule, err := ruleConvert(ruleFile)
+			if err != nil {
+				return headerConf, fmt.Errorf("rule[%s][%d]: %s", product, i, err)
+			}
+			rules = append(rules, rule)
+		}
+		headerConf.Config[product] = rules
+	}
+
+	return headerConf, nil
+}
+
+func HeaderConfLoad(filename string) (HeaderConf, error) {
+	var conf HeaderConfFile
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return HeaderConf{}, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&conf); err != nil {
+		return HeaderConf{}, err
+	}
+
+	return HeaderConfCheck(conf)
+}
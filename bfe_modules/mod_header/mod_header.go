@@ -0,0 +1,127 @@
+package mod_header
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/sirupsen/logrus"
+)
+
+type ModuleHeader struct {
+	name     string
+	dataPath string
+
+	lock      sync.RWMutex
+	ruleTable ProductRules
+	version   string
+}
+
+func NewModuleHeader() *ModuleHeader {
+	return &ModuleHeader{
+		name:      "mod_header",
+		ruleTable: make(ProductRules),
+	}
+}
+
+func (m *ModuleHeader) Name() string {
+	return m.name
+}
+
+func (m *ModuleHeader) Init(cbs *bfe_module.BfeCallbacks, whs *web_monitor.WebHandlers, cr string) error {
+	confPath := bfe_module.ModConfPath(cr, m.name)
+	conf, err := ConfLoad(confPath, cr)
+	if err != nil {
+		return fmt.Errorf("%s: conf load err %s", m.name, err.Error())
+	}
+	m.dataPath = conf.Basic.DataPath
+
+	if err = m.loadConfData(nil); err != nil {
+		return fmt.Errorf("%s: loadConfData() err %s", m.name, err.Error())
+	}
+
+	if err = cbs.AddFilter(bfe_module.HANDLE_AFTER_LOCATION, m.reqHeaderHandler); err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.reqHeaderHandler): %s", m.name, err.Error())
+	}
+
+	if err = cbs.AddFilter(bfe_module.HANDLE_READ_BACKEND, m.rspHeaderHandler); err != nil {
+		return fmt.Errorf("%s.Init(): AddFilter(m.rspHeaderHandler): %s", m.name, err.Error())
+	}
+
+	if err = whs.RegisterHandler(web_monitor.WebHandleReload, m.name, m.loadConfData); err != nil {
+		return fmt.Errorf("%s.Init(): RegisterHandler(m.loadConfData): %s", m.name, err.Error())
+	}
+
+	return nil
+}
+
+func (m *ModuleHeader) loadConfData(query url.Values) error {
+	path := m.dataPath
+	if query != nil && query.Get("path") != "" {
+		path = query.Get("path")
+	}
+
+	conf, err := HeaderConfLoad(path)
+	if err != nil {
+		return fmt.Errorf("err in HeaderConfLoad(%s): %s", path, err)
+	}
+
+	m.lock.Lock()
+	m.ruleTable = conf.Config
+	m.version = conf.Version
+	m.lock.Unlock()
+
+	return nil
+}
+
+func (m *ModuleHeader) getRules(product string) RuleList {
+	m.lock.RLock()
+	rules := m.ruleTable[product]
+	m.lock.RUnlock()
+
+	return rules
+}
+
+func (m *ModuleHeader) reqHeaderHandler(req *bfe_basic.Request) (int, *bfe_http.Response) {
+	for _, rule := range m.getRules(req.Route.Product) {
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		for _, ac := range rule.ReqActions {
+			if err := ac.Do(req); err != nil {
+				logrus.Warnf("%s: action %s: %s", m.name, ac.Cmd, err)
+			}
+		}
+
+		if rule.Last {
+			break
+		}
+	}
+
+	return bfe_module.BFE_HANDLER_GOON, nil
+}
+
+func (m *ModuleHeader) rspHeaderHandler(req *bfe_basic.Request, res *bfe_http.Response) int {
+	for _, rule := range m.getRules(req.Route.Product) {
+		if !rule.Cond.Match(req) {
+			continue
+		}
+
+		for _, ac := range rule.RspActions {
+			if err := ac.DoResponse(req, res); err != nil {
+				logrus.Warnf("%s: action %s: %s", m.name, ac.Cmd, err)
+			}
+		}
+
+		if rule.Last {
+			break
+		}
+	}
+
+	return bfe_module.BFE_HANDLER_GOON
+}
@@ -0,0 +1,227 @@
+package mod_header
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+)
+
+func loadTestRules(t *testing.T, data string) *ModuleHeader {
+	var confFile HeaderConfFile
+	if err := json.Unmarshal([]byte(data), &confFile); err != nil {
+		t.Fatalf("decode conf: %s", err)
+	}
+
+	conf, err := HeaderConfCheck(confFile)
+	if err != nil {
+		t.Fatalf("HeaderConfCheck(): %s", err)
+	}
+
+	m := NewModuleHeader()
+	m.ruleTable = conf.Config
+
+	return m
+}
+
+func newTestRequest(t *testing.T, rawurl string) *bfe_basic.Request {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hreq := &bfe_http.Request{
+		Method: "GET",
+		URL:    u,
+		Host:   u.Host,
+		Header: bfe_http.Header{"Cookie": {"uid=u1"}},
+	}
+	req := bfe_basic.NewRequest(hreq, nil, nil, nil, nil)
+	req.ClientAddr = &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}
+	req.Route.Product = "p1"
+
+	return req
+}
+
+func TestPathAndQueryActions(t *testing.T) {
+	m := loadTestRules(t, `{
+		"Version": "1",
+		"Config": {
+			"p1": [{
+				"Cond": "req_path_prefix_in(\"/v1/\", false)",
+				"Actions": [
+					{"Cmd": "PATH_REGEX_REPLACE", "Params": ["^/v1/(.*)$", "/api/$1"]},
+					{"Cmd": "QUERY_ADD", "Params": ["uid", "%{cookie:uid}"]},
+					{"Cmd": "QUERY_ADD", "Params": ["from", "%{client_ip}-%{host}"]},
+					{"Cmd": "REQ_HEADER_SET", "Params": ["X-Bfe-Host", "%{host}"]}
+				]
+			}]
+		}
+	}`)
+
+	req := newTestRequest(t, "http://example.org/v1/users?id=1")
+	m.reqHeaderHandler(req)
+
+	hreq := req.HttpRequest
+	if hreq.URL.Path != "/api/users" {
+		t.Errorf("path: got %q, expect %q", hreq.URL.Path, "/api/users")
+	}
+	if expect := "id=1&uid=u1&from=10.1.2.3-example.org"; hreq.URL.RawQuery != expect {
+		t.Errorf("query: got %q, expect %q", hreq.URL.RawQuery, expect)
+	}
+	if got := hreq.Header.Get("X-Bfe-Host"); got != "example.org" {
+		t.Errorf("header: got %q, expect %q", got, "example.org")
+	}
+
+	// rule not matched
+	req = newTestRequest(t, "http://example.org/v2/users")
+	m.reqHeaderHandler(req)
+	if req.HttpRequest.URL.Path != "/v2/users" || req.HttpRequest.URL.RawQuery != "" {
+		t.Errorf("unmatched request modified: %s", req.HttpRequest.URL)
+	}
+}
+
+func newTestResponse() *bfe_http.Response {
+	return &bfe_http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header: bfe_http.Header{
+			"Server":        {"backend"},
+			"X-Powered-By":  {"php"},
+			"Cache-Control": {"no-cache"},
+		},
+	}
+}
+
+func TestResponseActions(t *testing.T) {
+	m := loadTestRules(t, `{
+		"Version": "1",
+		"Config": {
+			"p1": [{
+				"Cond": "req_path_prefix_in(\"/v1/\", false)",
+				"Actions": [
+					{"Cmd": "RSP_HEADER_SET", "Params": ["Server", "bfe"]},
+					{"Cmd": "RSP_HEADER_ADD", "Params": ["Cache-Control", "private"]},
+					{"Cmd": "RSP_HEADER_DEL", "Params": ["X-Powered-By"]},
+					{"Cmd": "RSP_COOKIE_SET", "Params": ["sid", "abc", "3600", "/v1"]},
+					{"Cmd": "RSP_STATUS_SET", "Params": ["503"]}
+				]
+			}]
+		}
+	}`)
+
+	req := newTestRequest(t, "http://example.org/v1/users")
+	res := newTestResponse()
+	m.rspHeaderHandler(req, res)
+
+	if got := res.Header.Get("Server"); got != "bfe" {
+		t.Errorf("Server: got %q, expect %q", got, "bfe")
+	}
+	if got := res.Header["Cache-Control"]; len(got) != 2 || got[1] != "private" {
+		t.Errorf("Cache-Control: got %q", got)
+	}
+	if _, ok := res.Header["X-Powered-By"]; ok {
+		t.Errorf("X-Powered-By should be deleted")
+	}
+	if got, expect := res.Header.Get("Set-Cookie"), "sid=abc; Path=/v1; Max-Age=3600"; got != expect {
+		t.Errorf("Set-Cookie: got %q, expect %q", got, expect)
+	}
+	if res.StatusCode != 503 || res.Status != "503 Service Unavailable" {
+		t.Errorf("status: got %d %q", res.StatusCode, res.Status)
+	}
+
+	// response actions are not applied to request
+	m.reqHeaderHandler(req)
+	if len(req.HttpRequest.Header) != 1 {
+		t.Errorf("request modified: %v", req.HttpRequest.Header)
+	}
+
+	// rule not matched
+	req = newTestRequest(t, "http://example.org/v2/users")
+	res = newTestResponse()
+	m.rspHeaderHandler(req, res)
+	if res.StatusCode != 200 || res.Header.Get("Server") != "backend" || len(res.Header["Set-Cookie"]) != 0 {
+		t.Errorf("unmatched response modified: %d %v", res.StatusCode, res.Header)
+	}
+}
+
+func TestResponseActionVariables(t *testing.T) {
+	m := loadTestRules(t, `{
+		"Version": "1",
+		"Config": {
+			"p1": [{
+				"Cond": "default_t()",
+				"Actions": [
+					{"Cmd": "RSP_HEADER_SET", "Params": ["X-Client", "%{client_ip}"]}
+				]
+			}]
+		}
+	}`)
+
+	req := newTestRequest(t, "http://example.org/")
+	res := &bfe_http.Response{Header: make(bfe_http.Header)}
+	m.rspHeaderHandler(req, res)
+	if got := res.Header.Get("X-Client"); got != "10.1.2.3" {
+		t.Errorf("got %q, expect %q", got, "10.1.2.3")
+	}
+}
+
+func TestResponseActionsLast(t *testing.T) {
+	m := loadTestRules(t, `{
+		"Version": "1",
+		"Config": {
+			"p1": [
+				{"Cond": "default_t()", "Actions": [{"Cmd": "RSP_HEADER_SET", "Params": ["X-Rule", "1"]}], "Last": true},
+				{"Cond": "default_t()", "Actions": [{"Cmd": "RSP_HEADER_SET", "Params": ["X-Rule", "2"]}]}
+			]
+		}
+	}`)
+
+	res := newTestResponse()
+	m.rspHeaderHandler(newTestRequest(t, "http://example.org/"), res)
+	if got := res.Header.Get("X-Rule"); got != "1" {
+		t.Errorf("got %q, expect %q", got, "1")
+	}
+}
+
+func TestResponseActionCheck(t *testing.T) {
+	for _, ac := range []string{
+		`{"Cmd": "RSP_STATUS_SET", "Params": ["99"]}`,
+		`{"Cmd": "RSP_STATUS_SET", "Params": ["abc"]}`,
+		`{"Cmd": "RSP_COOKIE_SET", "Params": ["a b", "v"]}`,
+		`{"Cmd": "RSP_COOKIE_SET", "Params": ["sid", "v", "x"]}`,
+		`{"Cmd": "RSP_COOKIE_SET", "Params": ["sid"]}`,
+		`{"Cmd": "RSP_HEADER_SET", "Params": ["Server"]}`,
+	} {
+		if err := checkAction(ac); err == nil {
+			t.Errorf("%s should be invalid", ac)
+		}
+	}
+}
+
+func TestActionNotAllowed(t *testing.T) {
+	for _, ac := range []string{
+		`{"Cmd": "HOST_SET", "Params": ["a.org"]}`,
+		`{"Cmd": "PATH_SET", "Params": ["/a"]}`,
+		`{"Cmd": "CLOSE", "Params": []}`,
+	} {
+		if err := checkAction(ac); err == nil {
+			t.Errorf("%s should not be allowed", ac)
+		}
+	}
+}
+
+// checkAction checks a rule with action ac
+func checkAction(ac string) error {
+	var confFile HeaderConfFile
+	data := `{"Version": "1", "Config": {"p1": [{"Cond": "default_t()", "Actions": [` + ac + `]}]}}`
+	if err := json.Unmarshal([]byte(data), &confFile); err != nil {
+		return err
+	}
+
+	_, err := HeaderConfCheck(confFile)
+	return err
+}
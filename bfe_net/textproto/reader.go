@@ -461,7 +461,7 @@ func canonicalMIMEHeaderKeyOriginal(a []byte) string {
 		upper = c == '-'
 
 		if lo < hi {
-			for lo < hi && (len(commonHeaders[lo]) <= i) || commonHeaders[lo][i] < c {
+			for lo < hi && (len(commonHeaders[lo]) <= i || commonHeaders[lo][i] < c) {
 				lo++
 			}
 			for hi > lo && commonHeaders[hi-1][i] > c {
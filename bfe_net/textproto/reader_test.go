@@ -0,0 +1,46 @@
+package textproto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crud-bird/bfe/bfe_bufio"
+)
+
+func TestCanonicalMIMEHeaderKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		expect string
+	}{
+		{"", ""},
+		{"host", "Host"},
+		{"CONTENT-TYPE", "Content-Type"},
+		{"user-agent", "User-Agent"},
+		{"x-test", "X-Test"},
+		{"X-Test", "X-Test"},
+		{"x-z", "X-Z"},
+		{"zz", "Zz"},
+		{"x-powered-by-proxy", "X-Powered-By-Proxy"},
+		{"foo bar", "Foo-Bar"},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalMIMEHeaderKey(tt.key); got != tt.expect {
+			t.Errorf("CanonicalMIMEHeaderKey(%q): got %q, expect %q", tt.key, got, tt.expect)
+		}
+	}
+}
+
+func TestReadMIMEHeader(t *testing.T) {
+	r := NewReader(bfe_bufio.NewReader(strings.NewReader("x-test: 1\r\nzone: a\r\nHost: example.org\r\n\r\n")))
+	m, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("ReadMIMEHeader(): %s", err)
+	}
+
+	for key, value := range map[string]string{"X-Test": "1", "Zone": "a", "Host": "example.org"} {
+		if got := m.Get(key); got != value {
+			t.Errorf("%s: got %q, expect %q", key, got, value)
+		}
+	}
+}
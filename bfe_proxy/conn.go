@@ -95,7 +95,7 @@ func (p *Conn) BalancerAddr() net.Addr {
 	return nil
 }
 
-func (p *Conn) GeNetConn() net.Conn {
+func (p *Conn) GetNetConn() net.Conn {
 	return p.conn
 }
 
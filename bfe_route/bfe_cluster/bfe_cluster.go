@@ -3,6 +3,7 @@ package bfe_cluster
 import (
 	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +14,9 @@ type BfeCluster struct {
 	backendConf *cluster_conf.BackendBasic
 	CheckConf   *cluster_conf.BackendCheck
 	GslbBasic   *cluster_conf.GslbBasicConf
+	OutlierConf *cluster_conf.OutlierDetection
+	retryConf   *cluster_conf.RetryPolicy
+	hedgeConf   *cluster_conf.HedgePolicy
 
 	timeoutReadClient      time.Duration
 	timeoutReadClientAgain time.Duration
@@ -22,6 +26,14 @@ type BfeCluster struct {
 	reqFlushInternal    time.Duration
 	resFlushInternsl    time.Duration
 	cancelOnClientClose bool
+
+	// circuit breaker counters
+	pendingNum int32
+	retryNum   int32
+	hedgeNum   int32
+
+	// latency of recent responses, for hedge delay
+	latency latencyWindow
 }
 
 func NewBfeCluster(name string) *BfeCluster {
@@ -34,12 +46,15 @@ func (cluster *BfeCluster) BasicInit(conf cluster_conf.ClusterConf) {
 	cluster.backendConf = conf.BackendConf
 	cluster.CheckConf = conf.CheckConf
 	cluster.GslbBasic = conf.GslbBasic
-	cluster.timeoutReadClient = time.Duration(*conf.ClusterBasic.TimeoutReadClient)
-	cluster.timeoutReadClientAgain = time.Duration(*conf.ClusterBasic.TimeoutReadClientAgain)
-	cluster.timeoutWriteClient = time.Duration(*conf.ClusterBasic.TimeoutWriteClient)
+	cluster.OutlierConf = conf.OutlierConf
+	cluster.retryConf = conf.RetryConf
+	cluster.hedgeConf = conf.HedgeConf
+	cluster.timeoutReadClient = time.Duration(*conf.ClusterBasic.TimeoutReadClient) * time.Millisecond
+	cluster.timeoutReadClientAgain = time.Duration(*conf.ClusterBasic.TimeoutReadClientAgain) * time.Millisecond
+	cluster.timeoutWriteClient = time.Duration(*conf.ClusterBasic.TimeoutWriteClient) * time.Millisecond
 	cluster.reqWriteBufferSize = *conf.ClusterBasic.ReqWriteBUfferSize
-	cluster.reqFlushInternal = time.Duration(*conf.ClusterBasic.ReqFlushInterval)
-	cluster.resFlushInternsl = time.Duration(*conf.ClusterBasic.ResFlushInterval)
+	cluster.reqFlushInternal = time.Duration(*conf.ClusterBasic.ReqFlushInterval) * time.Millisecond
+	cluster.resFlushInternsl = time.Duration(*conf.ClusterBasic.ResFlushInterval) * time.Millisecond
 	cluster.cancelOnClientClose = *conf.ClusterBasic.CancelOnClientClose
 }
 
@@ -79,6 +94,22 @@ func (cluster *BfeCluster) RetryLevel() int {
 	return *res
 }
 
+func (cluster *BfeCluster) RetryPolicy() *cluster_conf.RetryPolicy {
+	cluster.RLock()
+	res := cluster.retryConf
+	cluster.RUnlock()
+
+	return res
+}
+
+func (cluster *BfeCluster) HedgePolicy() *cluster_conf.HedgePolicy {
+	cluster.RLock()
+	res := cluster.hedgeConf
+	cluster.RUnlock()
+
+	return res
+}
+
 func (cluster *BfeCluster) TimeoutReadClient() time.Duration {
 	cluster.RLock()
 	res := cluster.timeoutReadClient
@@ -103,7 +134,7 @@ func (cluster *BfeCluster) TimeoutWriteClient() time.Duration {
 	return res
 }
 
-func (cluster BfeCluster) ReqWriteBUfferSize() int {
+func (cluster *BfeCluster) ReqWriteBUfferSize() int {
 	cluster.RLock()
 	res := cluster.reqWriteBufferSize
 	cluster.RUnlock()
@@ -134,3 +165,97 @@ func (cluster *BfeCluster) CancelOnClientClose() bool {
 
 	return res
 }
+
+// acquire increases counter if it is below max, max <= 0 means no limit
+func acquire(counter *int32, max int) bool {
+	if atomic.AddInt32(counter, 1) > int32(max) && max > 0 {
+		atomic.AddInt32(counter, -1)
+		return false
+	}
+
+	return true
+}
+
+// AcquirePending checks MaxPendingRequests before forwarding request to
+// the cluster. ReleasePending should be called if true is returned.
+func (cluster *BfeCluster) AcquirePending() bool {
+	return acquire(&cluster.pendingNum, *cluster.BackendConf().MaxPendingRequests)
+}
+
+func (cluster *BfeCluster) ReleasePending() {
+	atomic.AddInt32(&cluster.pendingNum, -1)
+}
+
+// AcquireRetry checks MaxRetries and retry budget before retrying request.
+// ReleaseRetry should be called if true is returned.
+func (cluster *BfeCluster) AcquireRetry() bool {
+	limit := *cluster.BackendConf().MaxRetries
+	if budget, ok := cluster.retryBudget(); ok && (limit <= 0 || budget < limit) {
+		if budget <= 0 {
+			return false
+		}
+		limit = budget
+	}
+
+	return acquire(&cluster.retryNum, limit)
+}
+
+// retryBudget returns max concurrent retries by percent of pending requests
+func (cluster *BfeCluster) retryBudget() (int, bool) {
+	policy := cluster.RetryPolicy()
+	if policy == nil || !*policy.Enable || *policy.BudgetPercent == 0 {
+		return 0, false
+	}
+
+	budget := int(atomic.LoadInt32(&cluster.pendingNum)) * *policy.BudgetPercent / 100
+	if budget < *policy.MinRetryConcurrency {
+		budget = *policy.MinRetryConcurrency
+	}
+
+	return budget, true
+}
+
+func (cluster *BfeCluster) ReleaseRetry() {
+	atomic.AddInt32(&cluster.retryNum, -1)
+}
+
+// AcquireHedge checks hedge budget before sending hedged request.
+// ReleaseHedge should be called if true is returned.
+func (cluster *BfeCluster) AcquireHedge() bool {
+	policy := cluster.HedgePolicy()
+	if policy == nil {
+		return false
+	}
+
+	budget := int(atomic.LoadInt32(&cluster.pendingNum)) * *policy.BudgetPercent / 100
+	if budget < *policy.MinHedgeConcurrency {
+		budget = *policy.MinHedgeConcurrency
+	}
+	if budget <= 0 {
+		return false
+	}
+
+	return acquire(&cluster.hedgeNum, budget)
+}
+
+func (cluster *BfeCluster) ReleaseHedge() {
+	atomic.AddInt32(&cluster.hedgeNum, -1)
+}
+
+// HedgeDelay returns delay before sending hedged request
+func (cluster *BfeCluster) HedgeDelay() time.Duration {
+	policy := cluster.HedgePolicy()
+	delay := time.Duration(*policy.Delay) * time.Millisecond
+	if *policy.DelayPercentile > 0 {
+		if d, ok := cluster.latency.percentile(*policy.DelayPercentile); ok && d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
+
+// AddLatency records response header latency of the cluster
+func (cluster *BfeCluster) AddLatency(d time.Duration) {
+	cluster.latency.add(d)
+}
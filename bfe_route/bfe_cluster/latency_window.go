@@ -0,0 +1,53 @@
+package bfe_cluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize   = 1024        // num of recent samples kept
+	latencyMinSamples   = 100         // min num of samples for percentile
+	latencySortInterval = time.Second // interval of updating percentile
+)
+
+// latencyWindow keeps latency of recent responses
+type latencyWindow struct {
+	sync.Mutex
+	samples []time.Duration // ring buffer
+	next    int
+
+	sorted   []time.Duration // sorted copy of samples
+	sortTime time.Time
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.Lock()
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+		w.next = (w.next + 1) % latencyWindowSize
+	}
+	w.Unlock()
+}
+
+// percentile returns pth percentile of recent latency. Samples are sorted
+// at most once per latencySortInterval.
+func (w *latencyWindow) percentile(p int) (time.Duration, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.samples) < latencyMinSamples {
+		return 0, false
+	}
+
+	if now := time.Now(); now.Sub(w.sortTime) > latencySortInterval {
+		w.sorted = append(w.sorted[:0], w.samples...)
+		sort.Slice(w.sorted, func(i, j int) bool { return w.sorted[i] < w.sorted[j] })
+		w.sortTime = now
+	}
+
+	return w.sorted[len(w.sorted)*p/100], true
+}
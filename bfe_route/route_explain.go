@@ -0,0 +1,62 @@
+package bfe_route
+
+import (
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_basic/condition"
+)
+
+// RuleTrace is evaluation result of a route rule
+type RuleTrace struct {
+	Index       int
+	ClusterName string
+	Match       bool
+	Trace       *condition.TraceNode
+}
+
+// RouteExplain describes how request is routed
+type RouteExplain struct {
+	Product     string
+	HostTag     string
+	ClusterName string
+	RuleIndex   int // index of matched rule, -1 if no rule matched
+	Error       string
+	Rules       []RuleTrace // rules tried, in order
+}
+
+// Explain routes req like Lookup, and records result of every node in
+// condition of each rule tried
+func (t *HostTable) Explain(req *bfe_basic.Request) *RouteExplain {
+	explain := &RouteExplain{RuleIndex: -1}
+
+	if err := t.LookupHostTagAndProduct(req); err != nil {
+		explain.Error = err.Error()
+		return explain
+	}
+	explain.Product = req.Route.Product
+	explain.HostTag = req.Route.HostTag
+
+	rules, ok := t.productRouteTable[req.Route.Product]
+	if !ok {
+		explain.Error = ErrNoProductRule.Error()
+		return explain
+	}
+
+	for i, rule := range rules {
+		trace := condition.Explain(rule.Cond, req)
+		explain.Rules = append(explain.Rules, RuleTrace{
+			Index:       i,
+			ClusterName: rule.ClusterName,
+			Match:       trace.Result,
+			Trace:       trace,
+		})
+
+		if trace.Result {
+			explain.ClusterName = rule.ClusterName
+			explain.RuleIndex = i
+			return explain
+		}
+	}
+
+	explain.Error = ErrNoMatchRule.Error()
+	return explain
+}
@@ -1,11 +1,14 @@
 package bfe_route
 
 import (
+	"errors"
 	"fmt"
 	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/host_rule_conf"
 	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/route_rule_conf"
 	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/vip_rule_conf"
 	"github.com/crud-bird/bfe/bfe_route/bfe_cluster"
+	"sort"
+	"strings"
 )
 
 type ServerDataConf struct {
@@ -68,6 +71,8 @@ func (s *ServerDataConf) clusterTableLoad(clusterConf string) error {
 }
 
 func (s *ServerDataConf) check() error {
+	var fails []string
+
 	for pro1 := range s.HostTable.productRouteTable {
 		found := false
 		for _, pro2 := range s.HostTable.hostTagTable {
@@ -78,17 +83,26 @@ func (s *ServerDataConf) check() error {
 		}
 
 		if !found {
-			return fmt.Errorf("product[%s] in route should exist in host", pro1)
+			fails = append(fails, fmt.Sprintf("product[%s] in route should exist in host", pro1))
 		}
 	}
 
+	missing := make(map[string]bool)
 	for _, rules := range s.HostTable.productRouteTable {
 		for _, rule := range rules {
 			if _, err := s.ClusterTable.Lookup(rule.ClusterName); err != nil {
-				return fmt.Errorf("cluster[%s] in route should exist in cluster_conf", rule.ClusterName)
+				missing[rule.ClusterName] = true
 			}
 		}
 	}
+	for name := range missing {
+		fails = append(fails, fmt.Sprintf("cluster[%s] in route should exist in cluster_conf", name))
+	}
+
+	if len(fails) > 0 {
+		sort.Strings(fails)
+		return errors.New(strings.Join(fails, "; "))
+	}
 
 	return nil
 }
@@ -97,6 +111,6 @@ func (s *ServerDataConf) HostTableLookup(hostname string) (string, error) {
 	return s.HostTable.LookupProduct(hostname)
 }
 
-func (s *ServerDataConf) CLusterTableLookup(clusterName string) (*bfe_cluster.BfeCluster, error) {
+func (s *ServerDataConf) ClusterTableLookup(clusterName string) (*bfe_cluster.BfeCluster, error) {
 	return s.ClusterTable.Lookup(clusterName)
 }
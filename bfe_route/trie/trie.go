@@ -26,7 +26,7 @@ func (t *Trie) Get(path []string) (entry interface{}, ok bool) {
 	key := path[0]
 	newPath := path[1:]
 
-	if res, ok := t.Children[key]; ok {
+	if res, found := t.Children[key]; found {
 		entry, ok = res.Get(newPath)
 	}
 
@@ -1,7 +1,8 @@
 package bfe_server
 
 import (
-	"github.com/crud-bird/bfe/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_proxy"
 	"github.com/crud-bird/bfe/bfe_util"
 	"github.com/sirupsen/logrus"
 	"net"
@@ -22,7 +23,7 @@ func NewBfeListener(listener net.Listener, config bfe_conf.BfeConfig) *BfeListen
 	return &BfeListener{
 		listener,
 		config.Server.Layer4LoadBalancer,
-		time.Duration(config.Server.ClientReadTimeout * time.Second),
+		time.Duration(config.Server.ClientReadTimeout) * time.Second,
 		int64(config.Server.MaxProxyHeaderBytes),
 	}
 }
@@ -30,19 +31,27 @@ func NewBfeListener(listener net.Listener, config bfe_conf.BfeConfig) *BfeListen
 func (l *BfeListener) Accept() (net.Conn, error) {
 	conn, err := l.Listener.Accept()
 	if err != nil {
-		logrus.Debug("BfeListener: accept error: %s", err)
+		logrus.Debugf("BfeListener: accept error: %s", err)
 		return nil, err
 	}
 
 	switch l.BalanceType {
-	case bfe_conf.BALANCER_BGW:
+	case bfe_conf.BALANCE_BGW:
 		conn = bfe_util.NewBgwConn(conn.(*net.TCPConn))
 		logrus.Debug("BfeListener: accept connection via BGW")
 
-	case bfe_conf.BALANCER_PROXY:
-		conn = bfe_util.NewConn(conn, l.ProxyHeaderTimeout, l.proxyHeaderLimit)
+	case bfe_conf.BALANCE_PROXY:
+		conn = bfe_proxy.NewConn(conn, l.ProxyHeaderTimeout, l.proxyHeaderLimit)
 		logrus.Debug("NewBfeListener: accept connection via PROXY")
 	}
 
 	return conn, nil
 }
+
+func (l *BfeListener) Close() error {
+	return l.Listener.Close()
+}
+
+func (l *BfeListener) Addr() net.Addr {
+	return l.Listener.Addr()
+}
@@ -0,0 +1,264 @@
+package bfe_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/baidu/go-lib/web-monitor/metrics"
+	"github.com/baidu/go-lib/web-monitor/web_monitor"
+	"github.com/crud-bird/bfe/bfe_balance/bal_gslb"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/crud-bird/bfe/bfe_proxy"
+	"github.com/crud-bird/bfe/bfe_route"
+)
+
+type BfeMonitor struct {
+	srv         *BfeServer
+	WebServer   *web_monitor.MonitorServer
+	WebHandlers *web_monitor.WebHandlers
+
+	proxyMetrics      metrics.Metrics
+	balMetrics        metrics.Metrics
+	proxyProtoMetrics metrics.Metrics
+}
+
+func newBfeMonitor(srv *BfeServer, monitorPort int) (*BfeMonitor, error) {
+	m := new(BfeMonitor)
+	m.srv = srv
+
+	if err := m.proxyMetrics.Init(GetProxyState(), "PROXY", srv.Config.Server.MonitorIterval); err != nil {
+		return nil, fmt.Errorf("newBfeMonitor(): proxyMetrics.Init(): %s", err)
+	}
+	if err := m.balMetrics.Init(bal_gslb.GetBalErrState(), "PROXY", srv.Config.Server.MonitorIterval); err != nil {
+		return nil, fmt.Errorf("newBfeMonitor(): balMetrics.Init(): %s", err)
+	}
+	if err := m.proxyProtoMetrics.Init(bfe_proxy.GetProxyState(), "PROXY", srv.Config.Server.MonitorIterval); err != nil {
+		return nil, fmt.Errorf("newBfeMonitor(): proxyProtoMetrics.Init(): %s", err)
+	}
+
+	m.WebHandlers = web_monitor.NewWebHandlers()
+	if err := m.WebHandlersInit(srv); err != nil {
+		return nil, err
+	}
+
+	m.WebServer = web_monitor.NewMonitorServer(monitorPort, srv.Version, m.WebHandlers.Handlers)
+
+	return m, nil
+}
+
+func (m *BfeMonitor) WebHandlersInit(srv *BfeServer) error {
+	handlers := map[string]interface{}{
+		"proxy_state":       m.proxyStateGetJson,
+		"proxy_state_diff":  m.proxyStateDiffGetJson,
+		"bal_state":         m.balStateGetJson,
+		"proxy_proto_state": m.proxyProtoStateGetJson,
+		"bal_table":         m.balTableGetJson,
+		"backend_state":     m.backendStateGetJson,
+		"bal_versions":      m.balVersionsGetJson,
+		"host_table":        m.hostTableGetJson,
+		"module_status":     m.moduleStatusGetJson,
+		"route_explain":     m.routeExplainGetJson,
+	}
+	for name, handler := range handlers {
+		if err := m.WebHandlers.RegisterHandler(web_monitor.WebHandleMonitor, name, handler); err != nil {
+			return fmt.Errorf("WebHandlersInit(): RegisterHandler(%s): %s", name, err)
+		}
+	}
+
+	reloadHandlers := map[string]interface{}{
+		"server_data_conf": srv.serverDataConfReload,
+		"gslb_data_conf":   srv.gslbDataConfReload,
+	}
+	for name, handler := range reloadHandlers {
+		if err := m.WebHandlers.RegisterHandler(web_monitor.WebHandleReload, name, handler); err != nil {
+			return fmt.Errorf("WebHandlersInit(): RegisterHandler(%s): %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *BfeMonitor) Start() {
+	go m.WebServer.Start()
+}
+
+func (m *BfeMonitor) proxyStateGetJson(params map[string][]string) ([]byte, error) {
+	return m.proxyMetrics.GetAll().Format(params)
+}
+
+func (m *BfeMonitor) proxyStateDiffGetJson(params map[string][]string) ([]byte, error) {
+	return m.proxyMetrics.GetDiff().Format(params)
+}
+
+func (m *BfeMonitor) balStateGetJson(params map[string][]string) ([]byte, error) {
+	return m.balMetrics.GetAll().Format(params)
+}
+
+func (m *BfeMonitor) proxyProtoStateGetJson(params map[string][]string) ([]byte, error) {
+	return m.proxyProtoMetrics.GetAll().Format(params)
+}
+
+func (m *BfeMonitor) balTableGetJson(params map[string][]string) ([]byte, error) {
+	return json.Marshal(m.srv.balTable.GetState())
+}
+
+// backendStateGetJson returns status of backends.
+// params: cluster, sub_cluster
+func (m *BfeMonitor) backendStateGetJson(params map[string][]string) ([]byte, error) {
+	query := url.Values(params)
+	state, err := m.srv.balTable.GetBackendState(query.Get("cluster"), query.Get("sub_cluster"))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
+
+func (m *BfeMonitor) balVersionsGetJson(params map[string][]string) ([]byte, error) {
+	return json.Marshal(m.srv.balTable.GetVersions())
+}
+
+func (m *BfeMonitor) hostTableGetJson(params map[string][]string) ([]byte, error) {
+	sf := m.srv.GetServerConf()
+	if sf == nil {
+		return nil, fmt.Errorf("server data conf not loaded")
+	}
+
+	status := map[string]interface{}{
+		"versions": sf.HostTable.GetVersions(),
+		"status":   sf.HostTable.GetStatus(),
+	}
+
+	return json.Marshal(status)
+}
+
+func (m *BfeMonitor) moduleStatusGetJson(params map[string][]string) ([]byte, error) {
+	return bfe_module.ModuleStatusGetJson()
+}
+
+// routeExplainGetJson routes a synthetic request built from params and returns
+// the matched product, rule index and result of every node in rule conditions.
+// params: host, method, path, header ("Name: value", repeatable), cip, vip, body
+func (m *BfeMonitor) routeExplainGetJson(params map[string][]string) ([]byte, error) {
+	sf := m.srv.GetServerConf()
+	if sf == nil {
+		return nil, fmt.Errorf("server data conf not loaded")
+	}
+
+	req, err := newExplainRequest(url.Values(params))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(sf.HostTable.Explain(req))
+}
+
+func newExplainRequest(params url.Values) (*bfe_basic.Request, error) {
+	host := params.Get("host")
+	if host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+
+	method := params.Get("method")
+	if method == "" {
+		method = "GET"
+	}
+
+	path := params.Get("path")
+	if path == "" {
+		path = "/"
+	}
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s: %s", path, err)
+	}
+
+	header := make(bfe_http.Header)
+	for _, h := range params["header"] {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid header %s, should be \"Name: value\"", h)
+		}
+		header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	body := params.Get("body")
+	hreq := &bfe_http.Request{
+		Method:        method,
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Host:          host,
+		RequestURI:    path,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}
+
+	session := bfe_basic.NewSession(nil)
+	if vip := params.Get("vip"); vip != "" {
+		if session.Vip = net.ParseIP(vip); session.Vip == nil {
+			return nil, fmt.Errorf("invalid vip %s", vip)
+		}
+	}
+
+	req := bfe_basic.NewRequest(hreq, nil, nil, session, nil)
+	if cip := params.Get("cip"); cip != "" {
+		ip := net.ParseIP(cip)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid cip %s", cip)
+		}
+		session.RemoteAddr = &net.TCPAddr{IP: ip}
+		req.RemoteAddr = session.RemoteAddr
+		req.ClientAddr = session.RemoteAddr
+	}
+
+	return req, nil
+}
+
+func (srv *BfeServer) InitWebMonitor(port int) error {
+	var err error
+
+	srv.Monitor, err = newBfeMonitor(srv, port)
+
+	return err
+}
+
+func (srv *BfeServer) serverDataConfReload(query url.Values) error {
+	cfg := srv.Config.Server
+	newConf, err := bfe_route.LoadServerDataConf(cfg.HostRuleConf, cfg.VipRuleConf, cfg.RouteRuleConf, cfg.ClusterConf)
+	if err != nil {
+		return fmt.Errorf("serverDataConfReload(): %s", err)
+	}
+
+	srv.confLock.Lock()
+	srv.ServerConf = newConf
+	srv.confLock.Unlock()
+
+	srv.balTable.SetGslbBasic(newConf.ClusterTable)
+
+	return nil
+}
+
+func (srv *BfeServer) gslbDataConfReload(query url.Values) error {
+	cfg := srv.Config.Server
+	gslbConf, clusterTableConf, err := srv.balTable.BalTableConfLoad(cfg.GslbConf, cfg.ClusterTableConf)
+	if err != nil {
+		return fmt.Errorf("gslbDataConfReload(): %s", err)
+	}
+
+	if err = srv.balTable.BalTableReload(gslbConf, clusterTableConf); err != nil {
+		return fmt.Errorf("gslbDataConfReload(): %s", err)
+	}
+
+	srv.balTable.SetGslbBasic(srv.GetServerConf().ClusterTable)
+
+	return nil
+}
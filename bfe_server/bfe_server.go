@@ -0,0 +1,206 @@
+package bfe_server
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_balance"
+	"github.com/crud-bird/bfe/bfe_basic/condition"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/crud-bird/bfe/bfe_route"
+	"github.com/sirupsen/logrus"
+)
+
+type BfeServer struct {
+	Config   bfe_conf.BfeConfig
+	ConfRoot string
+	Version  string
+
+	listenerMap   map[string]net.Listener
+	HttpListener  net.Listener
+	HttpsListener net.Listener
+
+	TLSServerConfig *tls.Config
+
+	ReverseProxy *ReverseProxy
+
+	confLock   sync.RWMutex
+	ServerConf *bfe_route.ServerDataConf
+	balTable   *bfe_balance.BalTable
+
+	CallBacks *bfe_module.BfeCallbacks
+	Modules   *bfe_module.BfeModules
+	Monitor   *BfeMonitor
+
+	connWaitGroup sync.WaitGroup
+	closeChan     chan bool
+}
+
+func NewBfeServer(cfg bfe_conf.BfeConfig, lnMap map[string]net.Listener, version string) *BfeServer {
+	s := new(BfeServer)
+
+	s.Config = cfg
+	s.Version = version
+	s.listenerMap = lnMap
+	s.HttpListener = lnMap["HTTP"]
+	s.HttpsListener = lnMap["HTTPS"]
+
+	s.CallBacks = bfe_module.NewBfeCallbacks()
+	s.Modules = bfe_module.NewBfeModules()
+	s.balTable = bfe_balance.NewBalTable(s.GetCheckConf)
+	s.closeChan = make(chan bool)
+
+	return s
+}
+
+func (srv *BfeServer) InitHttp() error {
+	srv.ReverseProxy = NewReverseProxy(srv)
+	condition.SetBodyPeekLimit(srv.Config.Server.MaxReqBodyPeekBytes)
+	return nil
+}
+
+func (srv *BfeServer) InitModules(confRoot string) error {
+	srv.ConfRoot = confRoot
+	return srv.Modules.Init(srv.CallBacks, srv.Monitor.WebHandlers, confRoot)
+}
+
+func (srv *BfeServer) RegisterModules(modules []string) error {
+	if modules == nil {
+		return nil
+	}
+
+	for _, moduleName := range modules {
+		if err := srv.Modules.RegisterModule(moduleName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (srv *BfeServer) InitDataLoad() error {
+	serverConf, err := bfe_route.LoadServerDataConf(srv.Config.Server.HostRuleConf, srv.Config.Server.VipRuleConf,
+		srv.Config.Server.RouteRuleConf, srv.Config.Server.ClusterConf)
+	if err != nil {
+		return err
+	}
+	srv.ServerConf = serverConf
+	logrus.Info("InitDataLoad():ServerDataConf init OK")
+
+	if err = srv.balTable.Init(srv.Config.Server.GslbConf, srv.Config.Server.ClusterTableConf); err != nil {
+		return err
+	}
+	srv.balTable.SetGslbBasic(srv.ServerConf.ClusterTable)
+	logrus.Info("InitDataLoad():BalTable init OK")
+
+	return nil
+}
+
+// GetServerConf returns the current server data conf.
+func (srv *BfeServer) GetServerConf() *bfe_route.ServerDataConf {
+	srv.confLock.RLock()
+	sf := srv.ServerConf
+	srv.confLock.RUnlock()
+
+	return sf
+}
+
+// GetCheckConf returns health check conf of given cluster.
+func (srv *BfeServer) GetCheckConf(clusterName string) *cluster_conf.BackendCheck {
+	sf := srv.GetServerConf()
+	if sf == nil {
+		return nil
+	}
+
+	cluster, err := sf.ClusterTable.Lookup(clusterName)
+	if err != nil {
+		return nil
+	}
+
+	return cluster.BackendCheckConf()
+}
+
+func (srv *BfeServer) ServeHttp(ln net.Listener) error {
+	return srv.Serve(ln, ln, "HTTP")
+}
+
+func (srv *BfeServer) ServeHttps(ln net.Listener) error {
+	tlsListener := tls.NewListener(ln, srv.TLSServerConfig)
+	return srv.Serve(tlsListener, ln, "HTTPS")
+}
+
+// Serve accepts incoming connections on the Listener l, creating a new
+// service goroutine for each.
+func (srv *BfeServer) Serve(l net.Listener, raw net.Listener, proto string) error {
+	var tempDelay time.Duration
+
+	for {
+		rw, err := l.Accept()
+		if err != nil {
+			select {
+			case <-srv.closeChan:
+				return nil
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				logrus.Warnf("http: Accept error: %v; retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+
+			logrus.Errorf("http: Accept error: %v", err)
+			return err
+		}
+		tempDelay = 0
+
+		c, err := newConn(rw, srv)
+		if err != nil {
+			continue
+		}
+
+		srv.connWaitGroup.Add(1)
+		go c.serve()
+	}
+}
+
+// ShutdownListeners stops accepting new connections and waits at most
+// timeout for active connections to finish.
+func (srv *BfeServer) ShutdownListeners(timeout time.Duration) {
+	close(srv.closeChan)
+	srv.closeListeners()
+
+	done := make(chan bool)
+	go func() {
+		srv.connWaitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logrus.Warnf("ShutdownListeners(): timeout(%s) waiting for active connections", timeout)
+	}
+}
+
+func (srv *BfeServer) isClosing() bool {
+	select {
+	case <-srv.closeChan:
+		return true
+	default:
+	}
+
+	return false
+}
@@ -18,6 +18,7 @@ func StartUp(cfg bfe_conf.BfeConfig, version string, confRoot string) error {
 	bfe_modules.SetModules()
 
 	bfeServer := NewBfeServer(cfg, lnMap, version)
+	bfeServer.ConfRoot = confRoot
 
 	if err = bfeServer.InitHttp(); err != nil {
 		logrus.Errorf("StartUp(): InitHttp() %s", err)
@@ -68,8 +69,10 @@ func StartUp(cfg bfe_conf.BfeConfig, version string, confRoot string) error {
 	}()
 
 	err = <-serveChan
+	logrus.Errorf("StartUp(): serve error: %s", err)
+	bfeServer.closeListeners()
 
-	return nil
+	return err
 }
 
 func createListeners(config bfe_conf.BfeConfig) (map[string]net.Listener, error) {
@@ -87,7 +90,7 @@ func createListeners(config bfe_conf.BfeConfig) (map[string]net.Listener, error)
 
 		listener = NewBfeListener(listener, config)
 		lnMap[proto] = listener
-		logrus.Info("Createlistener(): begin to listen port[%d]", port)
+		logrus.Infof("createListeners(): begin to listen port[%d]", port)
 	}
 
 	return lnMap, nil
@@ -0,0 +1,106 @@
+package bfe_server
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/crud-bird/bfe/bfe_balance"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/gslb_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/host_rule_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/route_rule_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_route_conf/vip_rule_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_tls_conf/server_cert_conf"
+	"github.com/crud-bird/bfe/bfe_route"
+)
+
+// ConfError is error found in a conf file
+type ConfError struct {
+	File string
+	Err  error
+}
+
+func (e ConfError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+// CheckConf loads bfe.conf under confRoot and all data files it refers to,
+// without starting server. All errors found are returned rather than the
+// first one.
+func CheckConf(confRoot string) []error {
+	var errs []error
+	fail := func(file string, err error) {
+		errs = append(errs, ConfError{File: file, Err: err})
+	}
+
+	confPath := path.Join(confRoot, "bfe.conf")
+	config, err := bfe_conf.BfeConfigLoad(confPath, confRoot)
+	if err != nil {
+		fail(confPath, err)
+		return errs
+	}
+	cfg := config.Server
+
+	if _, err := server_cert_conf.ServerCertConfLoad(config.HttpsBasic.ServerCertConf, confRoot); err != nil {
+		fail(config.HttpsBasic.ServerCertConf, err)
+	}
+
+	// load each data file alone, so that errors in all of them are reported
+	dataOK := true
+	if _, err := host_rule_conf.HostRuleConfLoad(cfg.HostRuleConf); err != nil {
+		fail(cfg.HostRuleConf, err)
+		dataOK = false
+	}
+	if _, err := vip_rule_conf.VipRuleConfLoad(cfg.VipRuleConf); err != nil {
+		fail(cfg.VipRuleConf, err)
+		dataOK = false
+	}
+	if _, err := route_rule_conf.RouteConfLoad(cfg.RouteRuleConf); err != nil {
+		fail(cfg.RouteRuleConf, err)
+		dataOK = false
+	}
+	clusterConf, err := cluster_conf.ClusterConfLoad(cfg.ClusterConf)
+	if err != nil {
+		fail(cfg.ClusterConf, err)
+		dataOK = false
+	}
+
+	gslbConf, err := gslb_conf.GslbConfLoad(cfg.GslbConf)
+	if err != nil {
+		fail(cfg.GslbConf, err)
+		dataOK = false
+	}
+	if _, err := cluster_table_conf.CLusterTableLoad(cfg.ClusterTableConf); err != nil {
+		fail(cfg.ClusterTableConf, err)
+		dataOK = false
+	}
+
+	if !dataOK {
+		return errs
+	}
+
+	// check references between data files
+	if _, err := bfe_route.LoadServerDataConf(cfg.HostRuleConf, cfg.VipRuleConf, cfg.RouteRuleConf, cfg.ClusterConf); err != nil {
+		fail(cfg.RouteRuleConf, err)
+	}
+
+	if err := bfe_balance.BalTableConfCheck(cfg.GslbConf, cfg.ClusterTableConf); err != nil {
+		fail(cfg.ClusterTableConf, err)
+	}
+
+	var clusters []string
+	for name := range *clusterConf.Config {
+		if _, ok := (*gslbConf.Clusters)[name]; !ok {
+			clusters = append(clusters, name)
+		}
+	}
+	sort.Strings(clusters)
+	for _, name := range clusters {
+		fail(cfg.GslbConf, fmt.Errorf("cluster[%s] in cluster_conf should exist in gslb", name))
+	}
+
+	return errs
+}
@@ -0,0 +1,153 @@
+package bfe_server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes self-signed certificate and key in pem to dir
+func writeTestCert(t *testing.T, dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.org"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFiles(t, dir, map[string]string{
+		"tls_conf/example.crt": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"tls_conf/example.key": string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+	})
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestConfRoot writes a valid conf of bfe to a temp dir, with files
+// replaced by those in overrides. It returns the conf root.
+func newTestConfRoot(t *testing.T, overrides map[string]string) string {
+	dir := t.TempDir()
+	writeTestCert(t, dir)
+
+	files := map[string]string{
+		"bfe.conf": "[Server]\nHttpPort = 8080\n",
+
+		"server_data_conf/host_rule.data":    `{"Version":"1","DefaultProduct":null,"Hosts":{"tag1":["example.org"]},"HostTags":{"p1":["tag1"]}}`,
+		"server_data_conf/vip_rule.data":     `{"Version":"1","Vips":{}}`,
+		"server_data_conf/route_rule.data":   `{"Version":"1","ProductRule":{"p1":[{"Cond":"req_path_prefix_in(\"/v2\", false)","ClusterName":"c2"},{"Cond":"default_t()","ClusterName":"c1"}]}}`,
+		"server_data_conf/cluster_conf.data": `{"Version":"1","Config":{"c1":{},"c2":{}}}`,
+		"cluster_conf/gslb.data":             `{"Clusters":{"c1":{"sub1":100},"c2":{"sub1":100}},"Hostname":"h","Ts":"1"}`,
+		"cluster_conf/cluster_table.data": `{"Version":"1","Config":{
+			"c1":{"sub1":[{"Name":"b1","Addr":"127.0.0.1","Port":8001,"Weight":10}]},
+			"c2":{"sub1":[{"Name":"b2","Addr":"127.0.0.1","Port":8002,"Weight":10}]}}}`,
+
+		"tls_conf/server_cert_conf.data": `{"Version":"1","Config":{"Default":"example","CertConf":{
+			"example":{"ServerCertFile":"tls_conf/example.crt","ServerKeyFile":"tls_conf/example.key"}}}}`,
+	}
+	for name, content := range overrides {
+		files[name] = content
+	}
+	writeTestFiles(t, dir, files)
+
+	return dir
+}
+
+func TestCheckConfValid(t *testing.T) {
+	dir := newTestConfRoot(t, nil)
+
+	if errs := CheckConf(dir); len(errs) != 0 {
+		t.Errorf("got errors %v, expect none", errs)
+	}
+}
+
+// checkConfErrors checks that errs are for files in order, and contain
+// substrings in msgs
+func checkConfErrors(t *testing.T, dir string, errs []error, files []string, msgs []string) {
+	t.Helper()
+
+	if len(errs) != len(files) {
+		t.Fatalf("got %d errors %v, expect %d", len(errs), errs, len(files))
+	}
+	for i, err := range errs {
+		confErr, ok := err.(ConfError)
+		if !ok {
+			t.Errorf("error %d: got %T, expect ConfError", i, err)
+			continue
+		}
+		if expect := filepath.Join(dir, files[i]); confErr.File != expect {
+			t.Errorf("error %d: got file %s, expect %s", i, confErr.File, expect)
+		}
+		if !strings.Contains(err.Error(), msgs[i]) {
+			t.Errorf("error %d: got %q, expect %q", i, err, msgs[i])
+		}
+	}
+}
+
+func TestCheckConfBadRoute(t *testing.T) {
+	// route rule refers to cluster not in cluster conf
+	dir := newTestConfRoot(t, map[string]string{
+		"server_data_conf/route_rule.data": `{"Version":"1","ProductRule":{"p1":[{"Cond":"default_t()","ClusterName":"c3"}]}}`,
+	})
+
+	checkConfErrors(t, dir, CheckConf(dir),
+		[]string{"server_data_conf/route_rule.data"},
+		[]string{"c3"})
+}
+
+func TestCheckConfBadCluster(t *testing.T) {
+	// c2 is not in gslb, and c3 in gslb has no backends
+	dir := newTestConfRoot(t, map[string]string{
+		"cluster_conf/gslb.data": `{"Clusters":{"c1":{"sub1":100},"c3":{"sub1":100}},"Hostname":"h","Ts":"1"}`,
+	})
+
+	checkConfErrors(t, dir, CheckConf(dir),
+		[]string{"cluster_conf/cluster_table.data", "cluster_conf/gslb.data"},
+		[]string{"c3", "cluster[c2] in cluster_conf should exist in gslb"})
+}
+
+func TestCheckConfAllErrors(t *testing.T) {
+	// errors in all data files are reported, rather than the first one
+	dir := newTestConfRoot(t, map[string]string{
+		"server_data_conf/route_rule.data": `{"Version":"1","ProductRule":{"p1":[{"Cond":"req_foo()","ClusterName":"c1"}]}}`,
+		"cluster_conf/gslb.data":           `{"Clusters":`,
+		"tls_conf/server_cert_conf.data": `{"Version":"1","Config":{"Default":"example","CertConf":{
+			"example":{"ServerCertFile":"tls_conf/missing.crt","ServerKeyFile":"tls_conf/example.key"}}}}`,
+	})
+
+	checkConfErrors(t, dir, CheckConf(dir),
+		[]string{"tls_conf/server_cert_conf.data", "server_data_conf/route_rule.data", "cluster_conf/gslb.data"},
+		[]string{"missing.crt", "primitive req_foo not found", ""})
+}
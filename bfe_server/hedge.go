@@ -0,0 +1,161 @@
+package bfe_server
+
+import (
+	"time"
+
+	bal_backend "github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_balance/bal_gslb"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_route/bfe_cluster"
+)
+
+// attempt is a round trip to a backend
+type attempt struct {
+	backend *bal_backend.BfeBackend
+	res     *bfe_http.Response
+	err     error
+}
+
+// doAttempt sends outreq to backend. Latency of response is recorded in
+// backend, and in cluster if it is not nil. Failed attempt is not recorded,
+// since a backend failing fast would otherwise look fast.
+func doAttempt(transport *bfe_http.Transport, backend *bal_backend.BfeBackend, outreq *bfe_http.Request,
+	cluster *bfe_cluster.BfeCluster) *attempt {
+	start := time.Now()
+	backend.AddConnNum()
+	res, err := transport.RoundTrip(outreq)
+	backend.DecConnNum()
+
+	if err == nil {
+		latency := time.Since(start)
+		backend.AddLatency(latency)
+		if cluster != nil {
+			cluster.AddLatency(latency)
+		}
+	}
+
+	return &attempt{backend: backend, res: res, err: err}
+}
+
+// hedgeable checks whether request could be hedged. Only the first attempt
+// of GET request without body is hedged.
+func hedgeable(req *bfe_basic.Request, cluster *bfe_cluster.BfeCluster) bool {
+	policy := cluster.HedgePolicy()
+	if policy == nil || !*policy.Enable || req.RetryTime > 0 {
+		return false
+	}
+
+	outreq := req.OutRequest
+	return outreq.Method == "GET" && outreq.ContentLength == 0 && len(outreq.TransferEncoding) == 0
+}
+
+// roundTrip forwards request to backend. If request is hedgeable, a hedged
+// request is sent to another backend when no response header is received
+// within hedge delay, and the first response wins while the other is
+// cancelled. It returns the winning attempt. Latency of all requests, not
+// only hedgeable ones, is recorded in cluster for hedge delay.
+func (p *ReverseProxy) roundTrip(req *bfe_basic.Request, cluster *bfe_cluster.BfeCluster, bal *bal_gslb.BalanceGslb,
+	transport *bfe_http.Transport, backend *bal_backend.BfeBackend) *attempt {
+	if !hedgeable(req, cluster) {
+		return doAttempt(transport, backend, req.OutRequest, cluster)
+	}
+
+	// requests may still be in flight after winner returns, so that both
+	// are copies of req.OutRequest
+	outreq := copyRequest(req.OutRequest, backend)
+	results := make(chan *attempt, 2)
+	go func() {
+		results <- doAttempt(transport, backend, outreq, cluster)
+	}()
+
+	timer := time.NewTimer(cluster.HedgeDelay())
+	select {
+	case a := <-results:
+		timer.Stop()
+		return a
+	case <-timer.C:
+	}
+
+	hedge := hedgeBackend(cluster, bal, backend)
+	if hedge == nil {
+		return <-results
+	}
+
+	hreq := copyRequest(outreq, hedge)
+	proxyState.HedgeSent.Inc(1)
+	go func() {
+		results <- doAttempt(transport, hedge, hreq, cluster)
+		cluster.ReleaseHedge()
+	}()
+
+	first := <-results
+	if first.err != nil {
+		// wait for the other one, failure of first one is counted here
+		bal.OnResult(first.backend, 0)
+		first.backend.OnFail(cluster.Name)
+		first = <-results
+	} else {
+		if first.backend == hedge {
+			transport.CancelRequest(outreq)
+		} else {
+			transport.CancelRequest(hreq)
+		}
+		go drainAttempt(results, bal)
+	}
+
+	if first.backend == hedge && first.err == nil {
+		proxyState.HedgeWon.Inc(1)
+	}
+
+	return first
+}
+
+// hedgeBackend selects a backend other than backend for hedged request,
+// nil if hedge budget is used up or no other backend is available
+func hedgeBackend(cluster *bfe_cluster.BfeCluster, bal *bal_gslb.BalanceGslb,
+	backend *bal_backend.BfeBackend) *bal_backend.BfeBackend {
+	if !cluster.AcquireHedge() {
+		proxyState.HedgeNoBudget.Inc(1)
+		return nil
+	}
+
+	hedge, err := bal.BalanceExclude(backend)
+	if err != nil {
+		proxyState.HedgeNoBackend.Inc(1)
+		cluster.ReleaseHedge()
+		return nil
+	}
+
+	return hedge
+}
+
+// copyRequest copies outreq for backend. Body and state are not copied,
+// since request to be hedged has no body.
+func copyRequest(outreq *bfe_http.Request, backend *bal_backend.BfeBackend) *bfe_http.Request {
+	hreq := new(bfe_http.Request)
+	*hreq = *outreq
+
+	u := *outreq.URL
+	u.Host = backend.GetAddrInfo()
+	hreq.URL = &u
+	hreq.Header = make(bfe_http.Header, len(outreq.Header))
+	for k, vv := range outreq.Header {
+		hreq.Header[k] = append([]string(nil), vv...)
+	}
+	hreq.Body = nil
+	hreq.State = nil
+
+	return hreq
+}
+
+// drainAttempt waits for the cancelled attempt and releases its response.
+// Error of it is probably caused by cancellation, and is ignored.
+func drainAttempt(results chan *attempt, bal *bal_gslb.BalanceGslb) {
+	a := <-results
+	if a.err == nil {
+		bal.OnResult(a.backend, a.res.StatusCode)
+		a.backend.OnSuccess()
+		a.res.Body.Close()
+	}
+}
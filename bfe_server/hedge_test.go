@@ -0,0 +1,85 @@
+package bfe_server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeConsistentHash(t *testing.T) {
+	// the first request is slow, and is cancelled when hedged one wins
+	var reqNum int32
+	cancelled := make(chan bool, 1)
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&reqNum, 1) == 1 {
+				select {
+				case <-r.Context().Done():
+					cancelled <- true
+					return
+				case <-time.After(5 * time.Second):
+				}
+			}
+			fmt.Fprintf(w, "hello from %s", name)
+		})
+	}
+	b0 := httptest.NewServer(handler("b0"))
+	defer b0.Close()
+	b1 := httptest.NewServer(handler("b1"))
+	defer b1.Close()
+
+	// all requests are balanced to the same backend by consistent hash
+	addr, _ := startTestServer(t, `{
+		"GslbBasic": {"BalanceMode": "MAGLEV"},
+		"HedgeConf": {"Enable": true, "Delay": 20, "MinHedgeConcurrency": 1}
+	}`, b0, b1)
+
+	start := time.Now()
+	c := dialRaw(t, addr)
+	res, body := c.do("GET /a HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	if res.StatusCode != 200 || time.Since(start) > 2*time.Second {
+		t.Fatalf("got %d %q in %s, expect response of hedged request", res.StatusCode, body, time.Since(start))
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Errorf("slow request not cancelled")
+	}
+}
+
+func TestHedgeDelayPercentile(t *testing.T) {
+	b0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintf(w, "hello")
+	}))
+	defer b0.Close()
+
+	addr, srv := startTestServer(t, `{
+		"CheckConf": {"FailNum": 100},
+		"HedgeConf": {"Enable": true, "Delay": 1, "DelayPercentile": 50}
+	}`, b0)
+	cluster, err := srv.GetServerConf().ClusterTable.Lookup("c1")
+	if err != nil {
+		t.Fatalf("Lookup(): %s", err)
+	}
+
+	// requests with body are not hedged, but their latency is recorded
+	c := dialRaw(t, addr)
+	c.conn.SetDeadline(time.Now().Add(20 * time.Second))
+	for i := 0; i < 100; i++ {
+		res, body := c.do("POST /a HTTP/1.1\r\nHost: example.org\r\nContent-Length: 2\r\n\r\nok")
+		if res.StatusCode != 200 {
+			t.Fatalf("request %d: got %d %q", i, res.StatusCode, body)
+		}
+	}
+
+	if delay := cluster.HedgeDelay(); delay < 20*time.Millisecond {
+		t.Errorf("got hedge delay %s, expect median latency of non-hedged requests", delay)
+	}
+}
@@ -0,0 +1,430 @@
+package bfe_server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_bufio"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/crud-bird/bfe/bfe_util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// extra bytes allowed for the buffered reader when limiting header size
+	headerLimitSlack = 4096
+)
+
+// connContextKey is key in req.Context for conn serving the request
+type connContextKey struct{}
+
+// conn represents the server side of an http connection.
+type conn struct {
+	rwc     net.Conn
+	server  *BfeServer
+	session *bfe_basic.Session
+
+	lr   *io.LimitedReader
+	bufr *bfe_bufio.Reader
+	cw   *countWriter
+	bufw *bfe_bufio.Writer
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func newConn(rwc net.Conn, srv *BfeServer) (*conn, error) {
+	c := new(conn)
+	c.rwc = rwc
+	c.server = srv
+
+	c.session = bfe_basic.NewSession(rwc)
+	if c.session.RemoteAddr == nil {
+		logrus.Warnf("newConn(): unsupported remote addr %s", rwc.RemoteAddr())
+		rwc.Close()
+		return nil, fmt.Errorf("unsupported remote addr %s", rwc.RemoteAddr())
+	}
+
+	netConn := rwc
+	if tlsConn, ok := rwc.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	if vip, vport, err := bfe_util.GetVipPort(netConn); err == nil {
+		c.session.Vip = vip
+		c.session.Vport = vport
+	}
+
+	c.lr = io.LimitReader(rwc, math.MaxInt64).(*io.LimitedReader)
+	c.bufr = bfe_bufio.NewReader(c.lr)
+	c.cw = &countWriter{w: rwc}
+	c.bufw = bfe_bufio.NewWriterSize(c.cw, 4<<10)
+
+	return c, nil
+}
+
+func (c *conn) serve() {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Errorf("panic: conn.serve(): %v, %v\n%s", c.rwc.RemoteAddr(), err, debug.Stack())
+			proxyState.PanicClientConnServe.Inc(1)
+		}
+
+		c.finish()
+	}()
+
+	proxyState.ClientConnServed.Inc(1)
+	proxyState.ClientConnActive.Inc(1)
+
+	hl := c.server.CallBacks.GetHandlerList(bfe_module.HANDLE_ACCEPT)
+	if hl != nil {
+		if retVal := hl.FilterAccept(c.session); retVal != bfe_module.BFE_HANDLER_GOON {
+			return
+		}
+	}
+
+	if tlsConn, ok := c.rwc.(*tls.Conn); ok {
+		if !c.serveHandshake(tlsConn) {
+			return
+		}
+	}
+
+	for {
+		if c.server.isClosing() {
+			return
+		}
+
+		readTimeout := time.Duration(c.server.Config.Server.ClientReadTimeout) * time.Second
+		c.rwc.SetReadDeadline(time.Now().Add(readTimeout))
+
+		start := time.Now()
+		req, err := c.readRequest()
+		if err != nil {
+			c.handleReadError(err)
+			return
+		}
+
+		if closeAfter := c.serveRequest(req, start); closeAfter {
+			return
+		}
+	}
+}
+
+func (c *conn) serveHandshake(tlsConn *tls.Conn) bool {
+	timeout := time.Duration(c.server.Config.Server.TlsHandshakeTimeout) * time.Second
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+
+	proxyState.TlsHandshakeAll.Inc(1)
+	if err := tlsConn.Handshake(); err != nil {
+		c.session.SetError(bfe_basic.ErrClientTlsHandshake, err.Error())
+		logrus.Debugf("conn.serveHandshake(): %s, %s", c.rwc.RemoteAddr(), err)
+		return false
+	}
+	proxyState.TlsHandshakeSucc.Inc(1)
+	tlsConn.SetDeadline(time.Time{})
+
+	c.session.IsSecure = true
+	c.session.Proto = "https"
+
+	hl := c.server.CallBacks.GetHandlerList(bfe_module.HANDLE_HANDSHAKE)
+	if hl != nil {
+		if retVal := hl.FilterAccept(c.session); retVal != bfe_module.BFE_HANDLER_GOON {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *conn) readRequest() (*bfe_http.Request, error) {
+	maxHeaderBytes := c.server.Config.Server.MaxHeaderBytes
+	c.lr.N = int64(maxHeaderBytes) + headerLimitSlack
+
+	buffered := c.bufr.Buffered()
+	limit := c.lr.N
+
+	req, err := bfe_http.ReadRequest(c.bufr, c.server.Config.Server.MaxHeaderUriBytes)
+	if err != nil {
+		if c.lr.N == 0 {
+			return nil, errTooLarge
+		}
+		return nil, err
+	}
+	req.State.HeaderSize = uint32(limit - c.lr.N + int64(buffered-c.bufr.Buffered()))
+	c.lr.N = math.MaxInt64
+
+	req.RemoteAddr = c.rwc.RemoteAddr().String()
+	req.State.Conn = c.rwc
+
+	return req, nil
+}
+
+var errTooLarge = fmt.Errorf("http: request too large")
+
+func (c *conn) handleReadError(err error) {
+	var code int
+
+	switch {
+	case err == io.EOF:
+		c.session.SetError(bfe_basic.ErrClientClose, err.Error())
+		return
+	case isTimeout(err):
+		c.session.SetError(bfe_basic.ErrClientTimeout, err.Error())
+		proxyState.ErrClientTimeout.Inc(1)
+		return
+	case err == errTooLarge:
+		c.session.SetError(bfe_basic.ErrClientLongHeader, err.Error())
+		proxyState.ErrClientLongHeader.Inc(1)
+		code = bfe_http.StatusRequestEntityTooLarge
+	case err == bfe_http.ErrUriTooLong:
+		c.session.SetError(bfe_basic.ErrClientLongUrl, err.Error())
+		proxyState.ErrClientLongUrl.Inc(1)
+		code = bfe_http.StatusRequestURITooLong
+	default:
+		c.session.SetError(bfe_basic.ErrClientBadRequest, err.Error())
+		proxyState.ErrClientBadRequest.Inc(1)
+		code = bfe_http.StatusBadRequest
+	}
+
+	res := newRespFromStatus(nil, code)
+	res.Close = true
+	c.writeResponse(res)
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func (c *conn) serveRequest(hreq *bfe_http.Request, start time.Time) (closeAfter bool) {
+	srv := c.server
+
+	c.session.IncReqNum(1)
+	c.session.IncReqNumActive(1)
+	defer c.session.IncReqNumActive(-1)
+	proxyState.ClientReqServed.Inc(1)
+	proxyState.ClientReqActive.Inc(1)
+	defer proxyState.ClientReqActive.Dec(1)
+
+	stat := bfe_basic.NewRequestStat(start)
+	stat.ReadReqEnd = time.Now()
+	stat.HeaderLenIn = int(hreq.State.HeaderSize)
+	hreq.State.StartTime = start
+
+	if hreq.ProtoAtLeast(1, 1) && hreq.Header.Get("Expect") == "100-continue" {
+		c.session.Use100Continue = true
+		proxyState.ClientConnUse100Continue.Inc(1)
+		hreq.Header.Del("Expect")
+		if hreq.ContentLength != 0 {
+			hreq.Body = &expectContinueReader{conn: c, readCloser: hreq.Body}
+		}
+	}
+
+	req := bfe_basic.NewRequest(hreq, c.rwc, stat, c.session, srv.GetServerConf())
+	req.ClientAddr = c.session.RemoteAddr
+	req.SetContext(connContextKey{}, c)
+
+	action := srv.ReverseProxy.ServeHTTP(req)
+
+	res := req.HttpResponse
+	if action == bfe_module.BFE_HANDLER_CLOSE {
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		return true
+	}
+
+	if res == nil {
+		res = newRespFromStatus(hreq, bfe_http.StatusInternalServerError)
+		req.HttpResponse = res
+	}
+	if req.ErrCode != nil {
+		proxyState.ClientReqFail.Inc(1)
+	}
+
+	closeAfter = action == bfe_module.BFE_HANDLER_FINISH || c.shouldClose(hreq)
+	closeAfter = c.fixResponse(hreq, res, closeAfter)
+
+	stat.BodyLenIn = int(hreq.State.BodySize)
+	stat.ResponseStart = time.Now()
+	written := c.cw.n
+	if err := c.writeResponse(res); err != nil {
+		req.ErrCode = bfe_basic.ErrClientWrite
+		req.ErrMsg = err.Error()
+		c.session.SetError(bfe_basic.ErrClientWrite, err.Error())
+		proxyState.ErrClientWrite.Inc(1)
+		closeAfter = true
+	}
+	stat.ResponseEnd = time.Now()
+	stat.BodyLenOut = int(c.cw.n - written)
+	if res.ContentLength >= 0 && int64(stat.BodyLenOut) >= res.ContentLength {
+		stat.HeaderLenOut = stat.BodyLenOut - int(res.ContentLength)
+		stat.BodyLenOut = int(res.ContentLength)
+	}
+	c.session.UpdateWriteTotal(int(c.cw.n))
+
+	// drain request body for next request on the same connection
+	if hreq.Body != nil {
+		if err := hreq.Body.Close(); err != nil {
+			closeAfter = true
+		}
+	}
+
+	hl := srv.CallBacks.GetHandlerList(bfe_module.HANDLE_REQUEST_FINISH)
+	if hl != nil {
+		if retVal := hl.FilterResponse(req, res); retVal == bfe_module.BFE_HANDLER_CLOSE {
+			closeAfter = true
+		}
+	}
+
+	return closeAfter
+}
+
+// waitClient waits for d while request is being served, and returns false
+// early if client closes connection. Data sent by client is kept in buffer,
+// and read deadline is restored to deadline.
+func (c *conn) waitClient(d time.Duration, deadline time.Time) bool {
+	end := time.Now().Add(d)
+	c.rwc.SetReadDeadline(end)
+	_, err := c.bufr.Peek(1)
+	c.rwc.SetReadDeadline(deadline)
+
+	switch {
+	case err == nil:
+		// pipelined request or body not read yet
+		time.Sleep(time.Until(end))
+		return true
+	case isTimeout(err):
+		return true
+	}
+
+	return false
+}
+
+func (c *conn) shouldClose(hreq *bfe_http.Request) bool {
+	if !c.server.Config.Server.KeepAlivedEnabled || c.server.isClosing() {
+		return true
+	}
+
+	connection := hreq.Header.Get("Connection")
+	if hreq.ProtoAtLeast(1, 1) {
+		return hasToken(connection, "close")
+	}
+
+	return !hasToken(connection, "keep-alive")
+}
+
+// fixResponse prepares response from backend (or bfe) to be sent to client.
+// It returns whether connection should be closed after the response, which
+// is true if end of response body can only be told by closing connection.
+func (c *conn) fixResponse(hreq *bfe_http.Request, res *bfe_http.Response, closeAfter bool) bool {
+	removeHopHeaders(res.Header)
+
+	res.Request = hreq
+	res.Proto = "HTTP/1.1"
+	res.ProtoMajor = 1
+	res.ProtoMinor = 1
+
+	if res.ContentLength < 0 && !chunkedEncoding(res.TransferEncoding) {
+		if hreq.ProtoAtLeast(1, 1) {
+			res.TransferEncoding = []string{"chunked"}
+		} else {
+			closeAfter = true
+		}
+	}
+
+	if !hreq.ProtoAtLeast(1, 1) {
+		res.TransferEncoding = nil
+		if res.ContentLength < 0 {
+			closeAfter = true
+		}
+		if !closeAfter {
+			res.Header.Set("Connection", "keep-alive")
+		}
+	}
+
+	res.Close = closeAfter
+
+	return closeAfter
+}
+
+func (c *conn) writeResponse(res *bfe_http.Response) error {
+	writeTimeout := time.Duration(c.server.Config.Server.ClientWriteTimeout) * time.Second
+	c.rwc.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	err := res.Write(c.bufw)
+	if err == nil {
+		err = c.bufw.Flush()
+	}
+
+	if err != nil && res.Body != nil {
+		res.Body.Close()
+	}
+
+	return err
+}
+
+func (c *conn) finish() {
+	c.bufw.Flush()
+	c.rwc.Close()
+
+	c.session.UpdateWriteTotal(int(c.cw.n))
+	c.session.Finish()
+
+	hl := c.server.CallBacks.GetHandlerList(bfe_module.HANDLE_FINISH)
+	if hl != nil {
+		hl.FilterFinish(c.session)
+	}
+
+	proxyState.ClientConnActive.Dec(1)
+	c.server.connWaitGroup.Done()
+}
+
+// expectContinueReader sends "100 Continue" to client before the first read
+// of request body.
+type expectContinueReader struct {
+	conn       *conn
+	readCloser io.ReadCloser
+	sawEOF     bool
+	wroteResp  bool
+}
+
+func (ecr *expectContinueReader) Read(p []byte) (n int, err error) {
+	if !ecr.wroteResp {
+		ecr.wroteResp = true
+		io.WriteString(ecr.conn.bufw, "HTTP/1.1 100 Continue\r\n\r\n")
+		if err = ecr.conn.bufw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = ecr.readCloser.Read(p)
+	if err == io.EOF {
+		ecr.sawEOF = true
+	}
+
+	return n, err
+}
+
+func (ecr *expectContinueReader) Close() error {
+	if !ecr.wroteResp {
+		// client is still waiting for 100 Continue, so don't drain body
+		return fmt.Errorf("request body not sent by client")
+	}
+
+	return ecr.readCloser.Close()
+}
@@ -0,0 +1,250 @@
+package bfe_server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+)
+
+// startTestServer starts bfe proxying example.org to given backends, which
+// are in sub cluster sub1 of cluster c1. It returns address of bfe.
+func startTestServer(t *testing.T, clusterConf string, backends ...*httptest.Server) (string, *BfeServer) {
+	return startRouteTestServer(t, "default_t()", clusterConf, backends...)
+}
+
+// startRouteTestServer is like startTestServer, but only requests matching
+// cond are proxied to cluster c1.
+func startRouteTestServer(t *testing.T, cond string, clusterConf string, backends ...*httptest.Server) (string, *BfeServer) {
+	dir := t.TempDir()
+
+	var confs []string
+	for i, backend := range backends {
+		addr := backend.Listener.Addr().(*net.TCPAddr)
+		confs = append(confs, fmt.Sprintf(`{"Name":"b%d","Addr":"127.0.0.1","Port":%d,"Weight":10}`, i, addr.Port))
+	}
+
+	files := map[string]string{
+		"host_rule.data":     `{"Version":"1","DefaultProduct":null,"Hosts":{"tag1":["example.org"]},"HostTags":{"p1":["tag1"]}}`,
+		"vip_rule.data":      `{"Version":"1","Vips":{}}`,
+		"route_rule.data":    `{"Version":"1","ProductRule":{"p1":[{"Cond":` + strconv.Quote(cond) + `,"ClusterName":"c1"}]}}`,
+		"cluster_conf.data":  `{"Version":"1","Config":{"c1":` + clusterConf + `}}`,
+		"gslb.data":          `{"Clusters":{"c1":{"sub1":100}},"Hostname":"h","Ts":"1"}`,
+		"cluster_table.data": `{"Version":"1","Config":{"c1":{"sub1":[` + strings.Join(confs, ",") + `]}}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cfg bfe_conf.BfeConfig
+	bfe_conf.SetDefaultConf(&cfg)
+	cfg.Server.HostRuleConf = filepath.Join(dir, "host_rule.data")
+	cfg.Server.VipRuleConf = filepath.Join(dir, "vip_rule.data")
+	cfg.Server.RouteRuleConf = filepath.Join(dir, "route_rule.data")
+	cfg.Server.ClusterConf = filepath.Join(dir, "cluster_conf.data")
+	cfg.Server.GslbConf = filepath.Join(dir, "gslb.data")
+	cfg.Server.ClusterTableConf = filepath.Join(dir, "cluster_table.data")
+	cfg.Server.Layer4LoadBalancer = "NONE"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := NewBfeServer(cfg, map[string]net.Listener{"HTTP": ln}, "test")
+	if err := srv.InitHttp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.InitWebMonitor(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.InitDataLoad(); err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeHttp(ln)
+
+	return ln.Addr().String(), srv
+}
+
+// rawConn sends raw requests to bfe and reads responses
+type rawConn struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string) *rawConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+
+	return &rawConn{t: t, conn: conn, br: bufio.NewReader(conn)}
+}
+
+func (c *rawConn) do(req string) (*http.Response, string) {
+	if _, err := io.WriteString(c.conn, req); err != nil {
+		c.t.Fatal(err)
+	}
+
+	res, err := http.ReadResponse(c.br, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatalf("read body: %s", err)
+	}
+	res.Body.Close()
+
+	return res, string(body)
+}
+
+// closed checks whether bfe closes connection
+func (c *rawConn) closed() bool {
+	_, err := c.br.ReadByte()
+	return err == io.EOF
+}
+
+func newStreamBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			// no content length, sent in chunks
+			io.WriteString(w, "part1,")
+			w.(http.Flusher).Flush()
+			io.WriteString(w, "part2")
+			return
+		}
+		fmt.Fprintf(w, "hello %s", r.URL.Path)
+	}))
+}
+
+func TestServeKeepAlive(t *testing.T) {
+	backend := newStreamBackend()
+	defer backend.Close()
+	addr, _ := startTestServer(t, `{}`, backend)
+
+	c := dialRaw(t, addr)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		res, body := c.do("GET " + path + " HTTP/1.1\r\nHost: example.org\r\n\r\n")
+		if res.StatusCode != 200 || body != "hello "+path {
+			t.Fatalf("GET %s: %d %q", path, res.StatusCode, body)
+		}
+		if res.Close {
+			t.Fatalf("GET %s: connection not kept alive", path)
+		}
+	}
+
+	res, _ := c.do("GET /d HTTP/1.1\r\nHost: example.org\r\nConnection: close\r\n\r\n")
+	if !res.Close || !c.closed() {
+		t.Fatalf("connection should be closed if requested by client")
+	}
+}
+
+func TestServeChunked(t *testing.T) {
+	backend := newStreamBackend()
+	defer backend.Close()
+	addr, _ := startTestServer(t, `{}`, backend)
+
+	c := dialRaw(t, addr)
+	res, body := c.do("GET /stream HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	if res.StatusCode != 200 || body != "part1,part2" {
+		t.Fatalf("unexpected response %d %q", res.StatusCode, body)
+	}
+	if len(res.TransferEncoding) == 0 || res.TransferEncoding[0] != "chunked" {
+		t.Fatalf("response should be chunked, got %v", res.TransferEncoding)
+	}
+
+	// connection is still usable
+	res, body = c.do("GET /a HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	if res.StatusCode != 200 || body != "hello /a" {
+		t.Fatalf("unexpected response %d %q", res.StatusCode, body)
+	}
+}
+
+func TestServeHTTP10(t *testing.T) {
+	backend := newStreamBackend()
+	defer backend.Close()
+	addr, _ := startTestServer(t, `{}`, backend)
+
+	// response of known length keeps connection alive if asked
+	c := dialRaw(t, addr)
+	res, body := c.do("GET /a HTTP/1.0\r\nHost: example.org\r\nConnection: keep-alive\r\n\r\n")
+	if res.StatusCode != 200 || body != "hello /a" || res.Close {
+		t.Fatalf("unexpected response %d %q close=%v", res.StatusCode, body, res.Close)
+	}
+
+	// response of unknown length ends by closing connection
+	res, body = c.do("GET /stream HTTP/1.0\r\nHost: example.org\r\nConnection: keep-alive\r\n\r\n")
+	if res.StatusCode != 200 || body != "part1,part2" {
+		t.Fatalf("unexpected response %d %q", res.StatusCode, body)
+	}
+	if len(res.TransferEncoding) != 0 {
+		t.Fatalf("chunked encoding sent to HTTP/1.0 client")
+	}
+	if !c.closed() {
+		t.Fatalf("connection should be closed after response of unknown length")
+	}
+
+	// connection is closed by default
+	c = dialRaw(t, addr)
+	c.do("GET /a HTTP/1.0\r\nHost: example.org\r\n\r\n")
+	if !c.closed() {
+		t.Fatalf("HTTP/1.0 connection should be closed by default")
+	}
+}
+
+func TestServeBodyAfterPeek(t *testing.T) {
+	// backend echoes request body, which is read before writing response
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		w.Write(data)
+	}))
+	defer backend.Close()
+	addr, _ := startRouteTestServer(t, `req_body_contain("beta", false)`, `{}`, backend)
+
+	// body larger than peek limit is forwarded as a whole, chunked or not
+	large := "beta" + strings.Repeat("0123456789", 10000)
+	chunked := fmt.Sprintf("%x\r\n%s\r\n%x\r\n%s\r\n0\r\n\r\n", 4, "beta", len(large)-4, large[4:])
+
+	c := dialRaw(t, addr)
+	for _, tt := range []struct {
+		req  string
+		body string
+	}{
+		{"POST /a HTTP/1.1\r\nHost: example.org\r\nContent-Length: 9\r\n\r\nbeta=1&b=", "beta=1&b="},
+		{fmt.Sprintf("POST /a HTTP/1.1\r\nHost: example.org\r\nContent-Length: %d\r\n\r\n%s", len(large), large), large},
+		{"POST /a HTTP/1.1\r\nHost: example.org\r\nTransfer-Encoding: chunked\r\n\r\n" + chunked, large},
+	} {
+		res, body := c.do(tt.req)
+		if res.StatusCode != 200 || body != tt.body {
+			t.Fatalf("got %d and %d bytes of body, expect 200 and %d bytes", res.StatusCode, len(body), len(tt.body))
+		}
+	}
+
+	// body beyond peek limit is not matched
+	tail := strings.Repeat("0123456789", 10000) + "beta"
+	res, _ := c.do(fmt.Sprintf("POST /a HTTP/1.1\r\nHost: example.org\r\nContent-Length: %d\r\n\r\n%s", len(tail), tail))
+	if res.StatusCode != 500 {
+		t.Errorf("got %d, expect 500 as body beyond peek limit is not matched", res.StatusCode)
+	}
+}
@@ -0,0 +1,51 @@
+package bfe_server
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_conf"
+	"github.com/crud-bird/bfe/bfe_config/bfe_tls_conf/server_cert_conf"
+	"github.com/sirupsen/logrus"
+)
+
+func (srv *BfeServer) InitHttps() error {
+	httpsConf := srv.Config.HttpsBasic
+
+	certs, err := server_cert_conf.ServerCertConfLoad(httpsConf.ServerCertConf, srv.ConfRoot)
+	if err != nil {
+		logrus.Errorf("InitHttps(): ServerCertConfLoad(%s): %s", httpsConf.ServerCertConf, err)
+		return err
+	}
+
+	config := &tls.Config{
+		Certificates:             certs,
+		PreferServerCipherSuites: true,
+		NextProtos:               []string{"http/1.1"},
+	}
+
+	for _, cipherGroup := range httpsConf.CipherSuites {
+		for _, cipher := range strings.Split(cipherGroup, bfe_conf.EquivCipherSep) {
+			if id, ok := bfe_conf.CipherSuitesMap[cipher]; ok {
+				config.CipherSuites = append(config.CipherSuites, id)
+			}
+		}
+	}
+
+	for _, curve := range httpsConf.CurvePreferences {
+		if id, ok := bfe_conf.CurvesMap[curve]; ok {
+			config.CurvePreferences = append(config.CurvePreferences, tls.CurveID(id))
+		}
+	}
+
+	if version, ok := bfe_conf.TlsVersionMap[httpsConf.MinTlsVersion]; ok {
+		config.MinVersion = version
+	}
+	if version, ok := bfe_conf.TlsVersionMap[httpsConf.MaxTlsVersion]; ok {
+		config.MaxVersion = version
+	}
+
+	srv.TLSServerConfig = config
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package bfe_server
+
+import (
+	"github.com/baidu/go-lib/web-monitor/metrics"
+)
+
+type ProxyState struct {
+	// panic
+	PanicClientConnServe *metrics.Counter
+	PanicBackendRead     *metrics.Counter
+
+	// client side
+	ClientConnServed         *metrics.Counter
+	ClientConnActive         *metrics.Gauge
+	ClientConnUse100Continue *metrics.Counter
+	ClientReqServed          *metrics.Counter
+	ClientReqActive          *metrics.Gauge
+	ClientReqFail            *metrics.Counter
+	ClientReqFailWithNoRetry *metrics.Counter
+
+	// client side errors
+	ErrClientLongHeader *metrics.Counter
+	ErrClientLongUrl    *metrics.Counter
+	ErrClientClose      *metrics.Counter
+	ErrClientTimeout    *metrics.Counter
+	ErrClientBadRequest *metrics.Counter
+	ErrClientWrite      *metrics.Counter
+
+	// backend side errors
+	ErrBkFindProduct       *metrics.Counter
+	ErrBkFindLocation      *metrics.Counter
+	ErrBkNoCluster         *metrics.Counter
+	ErrBkNoBalance         *metrics.Counter
+	ErrBkConnectBackend    *metrics.Counter
+	ErrBkWriteRequest      *metrics.Counter
+	ErrBkReadRespHeader    *metrics.Counter
+	ErrBkRespHeaderTimeout *metrics.Counter
+	ErrBkTransportBroken   *metrics.Counter
+	ErrBkCircuitOpen       *metrics.Counter
+
+	// request hedging
+	HedgeSent      *metrics.Counter
+	HedgeWon       *metrics.Counter // response of hedged request wins
+	HedgeNoBudget  *metrics.Counter
+	HedgeNoBackend *metrics.Counter // no other backend for hedged request
+
+	// tls
+	TlsHandshakeAll  *metrics.Counter
+	TlsHandshakeSucc *metrics.Counter
+}
+
+var proxyState ProxyState
+
+func GetProxyState() *ProxyState {
+	return &proxyState
+}
@@ -0,0 +1,178 @@
+package bfe_server
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_balance/bal_gslb"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_route/bfe_cluster"
+)
+
+// causes of failed attempt
+const (
+	retryCauseConnect = "connect" // fail to connect backend, request not sent
+	retryCauseReset   = "reset"   // conn broken before response header is read
+	retryCauseTimeout = "timeout" // response header timeout
+)
+
+// retry decisions, recorded in access log
+const (
+	retryDecisionRetry  = "retry"
+	retryDecisionNo     = "no"     // cause not retryable by policy
+	retryDecisionMethod = "method" // method not allowed to retry
+	retryDecisionBody   = "body"   // request with body could not be replayed
+	retryDecisionMax    = "max"    // reach RetryMax/CrossRetry of gslb
+	retryDecisionBudget = "budget" // reach MaxRetries or retry budget of cluster
+)
+
+// retryState tracks retries of a request forwarded to a cluster
+type retryState struct {
+	cluster *bfe_cluster.BfeCluster
+	policy  *cluster_conf.RetryPolicy // nil if not enabled
+	level   int
+
+	num     int  // num of retries
+	holding bool // holds a retry slot of cluster
+
+	readDeadline time.Time // deadline of reading request from client
+}
+
+func newRetryState(cluster *bfe_cluster.BfeCluster) *retryState {
+	rs := &retryState{
+		cluster: cluster,
+		level:   cluster.RetryLevel(),
+	}
+	if policy := cluster.RetryPolicy(); policy != nil && *policy.Enable {
+		rs.policy = policy
+	}
+
+	return rs
+}
+
+// retryOnStatus checks whether response with status code should be retried
+func (rs *retryState) retryOnStatus(code int) bool {
+	return rs.policy != nil && rs.policy.RetryOnStatus(code)
+}
+
+// allow decides whether request is retried after an attempt failed for
+// cause, and records the decision in req.RetryDecisions.
+func (rs *retryState) allow(req *bfe_basic.Request, bal *bal_gslb.BalanceGslb, cause string) string {
+	decision := rs.decide(req, bal, cause)
+	req.RetryDecisions = append(req.RetryDecisions, cause+":"+decision)
+
+	return decision
+}
+
+func (rs *retryState) decide(req *bfe_basic.Request, bal *bal_gslb.BalanceGslb, cause string) string {
+	if decision := rs.retryable(req.OutRequest, cause); decision != retryDecisionRetry {
+		return decision
+	}
+
+	if !bal.RetryAllowed(req) {
+		return retryDecisionMax
+	}
+
+	// a retrying request holds one retry slot until it finishes
+	if !rs.holding {
+		if !rs.cluster.AcquireRetry() {
+			return retryDecisionBudget
+		}
+		rs.holding = true
+	}
+	rs.num++
+
+	return retryDecisionRetry
+}
+
+// retryable checks cause and request by retry policy, or by RetryLevel if
+// policy is not enabled
+func (rs *retryState) retryable(outreq *bfe_http.Request, cause string) string {
+	// request has not been sent yet
+	if cause == retryCauseConnect {
+		return retryDecisionRetry
+	}
+
+	if rs.policy == nil {
+		if rs.level != cluster_conf.RetryGet {
+			return retryDecisionNo
+		}
+		if outreq.Method != "GET" {
+			return retryDecisionMethod
+		}
+	} else {
+		switch cause {
+		case retryCauseReset:
+			if !*rs.policy.RetryOnReset {
+				return retryDecisionNo
+			}
+		case retryCauseTimeout:
+			if !*rs.policy.RetryOnTimeout {
+				return retryDecisionNo
+			}
+		}
+		if !rs.policy.MethodAllowed(outreq.Method) {
+			return retryDecisionMethod
+		}
+	}
+
+	if outreq.ContentLength != 0 || len(outreq.TransferEncoding) != 0 {
+		return retryDecisionBody
+	}
+
+	return retryDecisionRetry
+}
+
+// backoff waits before next retry. It returns false if client closes
+// connection while waiting.
+func (rs *retryState) backoff(req *bfe_basic.Request) bool {
+	if rs.policy == nil || *rs.policy.BackoffBase == 0 {
+		return true
+	}
+
+	d := *rs.policy.BackoffBase
+	for i := 1; i < rs.num && d < *rs.policy.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > *rs.policy.BackoffMax {
+		d = *rs.policy.BackoffMax
+	}
+
+	// half of backoff is random jitter
+	jitter := rand.Intn(d/2 + 1)
+	wait := time.Duration(d-jitter) * time.Millisecond
+
+	c, ok := req.GetContext(connContextKey{}).(*conn)
+	if !ok {
+		time.Sleep(wait)
+		return true
+	}
+
+	return c.waitClient(wait, rs.readDeadline)
+}
+
+func (rs *retryState) release() {
+	if rs.holding {
+		rs.cluster.ReleaseRetry()
+	}
+}
+
+// retryCause returns cause of failed attempt
+func retryCause(err error) string {
+	switch err.(type) {
+	case bfe_http.ConnectError:
+		return retryCauseConnect
+	case bfe_http.RespHeaderTimeoutError:
+		return retryCauseTimeout
+	}
+
+	return retryCauseReset
+}
+
+// statusCause returns cause of attempt failed with response status code
+func statusCause(code int) string {
+	return strconv.Itoa(code)
+}
@@ -0,0 +1,135 @@
+package bfe_server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+)
+
+// newStatusBackend returns backend replying with status code, and counts
+// requests in hits
+func newStatusBackend(code int, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(hits, 1)
+		w.WriteHeader(code)
+		fmt.Fprintf(w, "%d from %s #%d", code, r.URL.Path, n)
+	}))
+}
+
+// retryClusterConf retries on 503. Backends are not marked down on failure,
+// whose health checks would outlive the test.
+func retryClusterConf(retryMax, backoff int) string {
+	return fmt.Sprintf(`{
+		"CheckConf": {"FailNum": 100},
+		"GslbBasic": {"RetryMax": %d, "CrossRetry": 0},
+		"RetryConf": {"Enable": true, "StatusCodes": [503], "BackoffBase": %d, "BackoffMax": %d}
+	}`, retryMax, backoff, backoff)
+}
+
+func TestRetryKeepsLastResponse(t *testing.T) {
+	// backends of sub cluster are removed on the first request, so that
+	// balancing of retry fails
+	var server atomic.Value
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		bal, err := server.Load().(*BfeServer).balTable.Lookup("c1")
+		if err != nil {
+			t.Errorf("Lookup(): %s", err)
+		} else {
+			bal.BackendReload(cluster_table_conf.ClusterBackend{"sub1": {}})
+		}
+		w.WriteHeader(503)
+		io.WriteString(w, "busy")
+	}))
+	defer backend.Close()
+
+	addr, srv := startTestServer(t, retryClusterConf(2, 0), backend)
+	server.Store(srv)
+
+	c := dialRaw(t, addr)
+	res, body := c.do("GET /a HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	if res.StatusCode != 503 || body != "busy" {
+		t.Fatalf("got %d %q, expect response of backend", res.StatusCode, body)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("got %d requests to backend, expect 1", n)
+	}
+}
+
+func TestRetryKeepsLastResponseOnFailure(t *testing.T) {
+	var hits int32
+	backend := newStatusBackend(503, &hits)
+	defer backend.Close()
+
+	// the second backend refuses connection
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	addr, _ := startTestServer(t, retryClusterConf(3, 0), backend, down)
+
+	for i := 0; i < 5; i++ {
+		c := dialRaw(t, addr)
+		res, body := c.do(fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.org\r\n\r\n", i))
+		if res.StatusCode != 503 {
+			t.Fatalf("got %d %q, expect 503 of backend", res.StatusCode, body)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var hits int32
+	backend := newStatusBackend(503, &hits)
+	defer backend.Close()
+	addr, _ := startTestServer(t, retryClusterConf(2, 20), backend)
+
+	// pipelined request is kept while waiting for retry
+	c := dialRaw(t, addr)
+	req := "GET /a HTTP/1.1\r\nHost: example.org\r\n\r\n"
+	if _, err := io.WriteString(c.conn, req+req); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		res, body := c.do("")
+		if res.StatusCode != 503 {
+			t.Fatalf("got %d %q", res.StatusCode, body)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 6 {
+		t.Errorf("got %d requests to backend, expect 6", n)
+	}
+}
+
+func TestRetryBackoffClientClose(t *testing.T) {
+	var hits int32
+	backend := newStatusBackend(503, &hits)
+	defer backend.Close()
+	addr, _ := startTestServer(t, retryClusterConf(2, 5000), backend)
+
+	closed := proxyState.ErrClientClose.Get()
+	c := dialRaw(t, addr)
+	io.WriteString(c.conn, "GET /a HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&hits) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("request not forwarded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.conn.Close()
+
+	for proxyState.ErrClientClose.Get() == closed {
+		if time.Now().After(deadline) {
+			t.Fatalf("backoff not stopped after client closed connection")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("got %d requests to backend, expect 1", n)
+	}
+}
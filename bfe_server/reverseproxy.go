@@ -0,0 +1,463 @@
+package bfe_server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	bal_backend "github.com/crud-bird/bfe/bfe_balance/backend"
+	"github.com/crud-bird/bfe/bfe_balance/bal_gslb"
+	"github.com/crud-bird/bfe/bfe_basic"
+	"github.com/crud-bird/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/crud-bird/bfe/bfe_debug"
+	"github.com/crud-bird/bfe/bfe_http"
+	"github.com/crud-bird/bfe/bfe_module"
+	"github.com/crud-bird/bfe/bfe_route"
+	"github.com/crud-bird/bfe/bfe_route/bfe_cluster"
+	"github.com/sirupsen/logrus"
+)
+
+// hop-by-hop headers, which should not be forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type transportEntry struct {
+	conf      *cluster_conf.BackendBasic
+	transport *bfe_http.Transport
+}
+
+// ReverseProxy forwards requests to backends of the cluster matched by
+// route rules.
+type ReverseProxy struct {
+	server *BfeServer
+
+	tsLock     sync.RWMutex
+	transports map[string]transportEntry
+}
+
+func NewReverseProxy(server *BfeServer) *ReverseProxy {
+	return &ReverseProxy{
+		server:     server,
+		transports: make(map[string]transportEntry),
+	}
+}
+
+// getTransport returns transport for given cluster. A new transport is created
+// when backend conf of cluster changes.
+func (p *ReverseProxy) getTransport(cluster *bfe_cluster.BfeCluster) *bfe_http.Transport {
+	conf := cluster.BackendConf()
+
+	p.tsLock.RLock()
+	entry, ok := p.transports[cluster.Name]
+	p.tsLock.RUnlock()
+	if ok && entry.conf == conf {
+		return entry.transport
+	}
+
+	p.tsLock.Lock()
+	defer p.tsLock.Unlock()
+
+	entry, ok = p.transports[cluster.Name]
+	if ok && entry.conf == conf {
+		return entry.transport
+	}
+	if ok {
+		entry.transport.CloseIdleConnections()
+	}
+
+	transport := &bfe_http.Transport{
+		ConnectTimeout:        time.Duration(*conf.TimeoutConnSrv) * time.Millisecond,
+		ResponseHeaderTimeout: time.Duration(*conf.TimeoutResponseHeader) * time.Millisecond,
+		MaxIdleConnsPerHost:   *conf.MaxIdleConnsPerHost,
+	}
+	p.transports[cluster.Name] = transportEntry{conf: conf, transport: transport}
+
+	return transport
+}
+
+// callRequestFilters runs request handlers at given callback point.
+func (p *ReverseProxy) callRequestFilters(point int, req *bfe_basic.Request) int {
+	hl := p.server.CallBacks.GetHandlerList(point)
+	if hl == nil {
+		return bfe_module.BFE_HANDLER_GOON
+	}
+
+	retVal, res := hl.FilterRequest(req)
+	switch retVal {
+	case bfe_module.BFE_HANDLER_REDIRECT:
+		req.HttpResponse = newRedirectResp(req)
+	case bfe_module.BFE_HANDLER_RESPONSE:
+		req.HttpResponse = res
+	case bfe_module.BFE_HANDLER_FINISH:
+		if res == nil {
+			res = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		}
+		req.HttpResponse = res
+	}
+
+	return retVal
+}
+
+// ServeHTTP finds the target cluster for the request, forwards it and stores
+// the response in req.HttpResponse. It returns the action for the connection.
+func (p *ReverseProxy) ServeHTTP(req *bfe_basic.Request) int {
+	var err error
+	srv := p.server
+
+	if retVal := p.callRequestFilters(bfe_module.HANDLE_BEFORE_LOCATION, req); retVal != bfe_module.BFE_HANDLER_GOON {
+		return retVal
+	}
+
+	serverConf, ok := req.SvrDataConf.(*bfe_route.ServerDataConf)
+	if !ok || serverConf == nil {
+		req.ErrCode = bfe_basic.ErrBkFindProduct
+		req.ErrMsg = "server data conf not loaded"
+		proxyState.ErrBkFindProduct.Inc(1)
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+
+	req.Stat.FindProStart = time.Now()
+	err = serverConf.HostTable.LookupHostTagAndProduct(req)
+	req.Stat.FindProEnd = time.Now()
+	if err != nil {
+		req.ErrCode = bfe_basic.ErrBkFindProduct
+		req.ErrMsg = fmt.Sprintf("host:%s, vip:%s, err:%s", req.HttpRequest.Host, req.Session.Vip, err)
+		proxyState.ErrBkFindProduct.Inc(1)
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+
+	if retVal := p.callRequestFilters(bfe_module.HANDLE_FOUND_PRODUCT, req); retVal != bfe_module.BFE_HANDLER_GOON {
+		return retVal
+	}
+
+	req.Stat.LocateStart = time.Now()
+	err = serverConf.HostTable.LookupCluster(req)
+	req.Stat.LocateEnd = time.Now()
+	if err != nil {
+		req.ErrCode = bfe_basic.ErrBkFindLocation
+		req.ErrMsg = fmt.Sprintf("product:%s, err:%s", req.Route.Product, err)
+		proxyState.ErrBkFindLocation.Inc(1)
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+
+	if retVal := p.callRequestFilters(bfe_module.HANDLE_AFTER_LOCATION, req); retVal != bfe_module.BFE_HANDLER_GOON {
+		return retVal
+	}
+
+	cluster, err := serverConf.ClusterTable.Lookup(req.Route.ClusterName)
+	if err != nil {
+		req.ErrCode = bfe_basic.ErrBkNoCluster
+		req.ErrMsg = fmt.Sprintf("cluster:%s, err:%s", req.Route.ClusterName, err)
+		proxyState.ErrBkNoCluster.Inc(1)
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+	req.Backend.ClusterName = cluster.Name
+
+	bal, err := srv.balTable.Lookup(cluster.Name)
+	if err != nil {
+		req.ErrCode = bfe_basic.ErrBkNoCluster
+		req.ErrMsg = fmt.Sprintf("cluster:%s, err:%s", cluster.Name, err)
+		proxyState.ErrBkNoCluster.Inc(1)
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, bfe_http.StatusInternalServerError)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+
+	res, err := p.clusterInvoke(req, cluster, bal)
+	if err != nil {
+		if req.ErrCode == bfe_basic.ErrClientClose {
+			return bfe_module.BFE_HANDLER_CLOSE
+		}
+
+		if bfe_debug.DebugServHTTP {
+			logrus.Debugf("ReverseProxy.ServeHTTP(): cluster %s, err %s, %s", cluster.Name, req.ErrCode, req.ErrMsg)
+		}
+
+		code := bfe_http.StatusBadGateway
+		switch req.ErrCode {
+		case bfe_basic.ErrBkRespHeaderTimeout:
+			code = bfe_http.StatusGatewayTimeout
+		case bfe_basic.ErrBkCircuitOpen:
+			code = bfe_http.StatusServiceUnavailable
+		}
+		req.HttpResponse = newRespFromStatus(req.HttpRequest, code)
+		return bfe_module.BFE_HANDLER_FINISH
+	}
+	req.HttpResponse = res
+
+	if cookie := bal.StickyCookie(req, req.Trans.Backend); cookie != nil {
+		res.Header.Add("Set-Cookie", cookie.String())
+	}
+
+	hl := srv.CallBacks.GetHandlerList(bfe_module.HANDLE_READ_BACKEND)
+	if hl != nil {
+		retVal := hl.FilterResponse(req, res)
+		if retVal == bfe_module.BFE_HANDLER_FINISH || retVal == bfe_module.BFE_HANDLER_CLOSE {
+			return retVal
+		}
+	}
+
+	return bfe_module.BFE_HANDLER_GOON
+}
+
+// clusterInvoke balances request among backends of the cluster and forwards
+// it. Request is retried according to retry policy or RetryLevel of the
+// cluster. Response retried on status is kept until another attempt succeeds,
+// and is returned if no other response is got.
+func (p *ReverseProxy) clusterInvoke(req *bfe_basic.Request, cluster *bfe_cluster.BfeCluster,
+	bal *bal_gslb.BalanceGslb) (*bfe_http.Response, error) {
+	outreq := p.newOutRequest(req)
+	req.OutRequest = outreq
+
+	transport := p.getTransport(cluster)
+	rs := newRetryState(cluster)
+	rs.readDeadline = time.Now().Add(cluster.TimeoutReadClient())
+	req.Connection.SetReadDeadline(rs.readDeadline)
+
+	req.Stat.ClusterStart = time.Now()
+	defer func() {
+		req.Stat.CLusterEnd = time.Now()
+	}()
+
+	if !cluster.AcquirePending() {
+		return nil, circuitOpen(req, fmt.Sprintf("cluster %s: too many pending requests", cluster.Name))
+	}
+	defer cluster.ReleasePending()
+
+	defer rs.release()
+
+	// last response retried on status, and backend of it
+	var last *bfe_http.Response
+	var lastBackend *bal_backend.BfeBackend
+	useLast := func() (*bfe_http.Response, error) {
+		setBackend(req, lastBackend, transport)
+		req.ErrCode = nil
+		req.ErrMsg = ""
+		return last, nil
+	}
+
+	for {
+		backend, err := bal.Balance(req)
+		if err != nil {
+			if last != nil {
+				return useLast()
+			}
+			if req.ErrCode == nil {
+				req.ErrCode = err
+			}
+			proxyState.ErrBkNoBalance.Inc(1)
+			return nil, err
+		}
+
+		setBackend(req, backend, transport)
+		outreq.URL.Host = backend.GetAddrInfo()
+
+		hl := p.server.CallBacks.GetHandlerList(bfe_module.HANDLE_FORWARD)
+		if hl != nil {
+			hl.FilterForward(req)
+		}
+
+		req.Stat.BackendStart = time.Now()
+		if req.Stat.BackendFirst.IsZero() {
+			req.Stat.BackendFirst = req.Stat.BackendStart
+		}
+
+		a := p.roundTrip(req, cluster, bal, transport, backend)
+		req.Stat.BackendEnd = time.Now()
+		res, err := a.res, a.err
+		if a.backend != backend {
+			// response of hedged request wins
+			backend = a.backend
+			setBackend(req, backend, transport)
+		}
+
+		if err == nil {
+			bal.OnResult(backend, res.StatusCode)
+			backend.OnSuccess()
+			req.ErrCode = nil
+			req.ErrMsg = ""
+			if last != nil {
+				last.Body.Close()
+			}
+			if !rs.retryOnStatus(res.StatusCode) ||
+				rs.allow(req, bal, statusCause(res.StatusCode)) != retryDecisionRetry {
+				return res, nil
+			}
+			last, lastBackend = res, backend
+		} else {
+			req.ErrCode = transportErrCode(err)
+			req.ErrMsg = fmt.Sprintf("backend %s: %s", backend.Name, err)
+			bal.OnResult(backend, 0)
+			backend.OnFail(cluster.Name)
+
+			switch rs.allow(req, bal, retryCause(err)) {
+			case retryDecisionRetry:
+			case retryDecisionBudget:
+				if last != nil {
+					return useLast()
+				}
+				return nil, circuitOpen(req, fmt.Sprintf("cluster %s: too many retries", cluster.Name))
+			default:
+				if last != nil {
+					return useLast()
+				}
+				return nil, err
+			}
+		}
+
+		if !rs.backoff(req) {
+			if last != nil {
+				last.Body.Close()
+			}
+			proxyState.ErrClientClose.Inc(1)
+			req.ErrCode = bfe_basic.ErrClientClose
+			req.ErrMsg = "client closed connection before retry"
+			return nil, req.ErrCode
+		}
+		req.RetryTime++
+	}
+}
+
+// setBackend records backend of request
+func setBackend(req *bfe_basic.Request, backend *bal_backend.BfeBackend, transport *bfe_http.Transport) {
+	req.Backend.SubclusterName = backend.SubCluster
+	req.Backend.BackendAddr = backend.GetAddr()
+	req.Backend.BackendPort = uint32(backend.Port)
+	req.Backend.BackendName = backend.Name
+	req.SetRequestTransport(backend, transport)
+}
+
+func circuitOpen(req *bfe_basic.Request, msg string) error {
+	proxyState.ErrBkCircuitOpen.Inc(1)
+	req.ErrCode = bfe_basic.ErrBkCircuitOpen
+	req.ErrMsg = msg
+
+	return bfe_basic.ErrBkCircuitOpen
+}
+
+func transportErrCode(err error) error {
+	switch err.(type) {
+	case bfe_http.ConnectError:
+		proxyState.ErrBkConnectBackend.Inc(1)
+		return bfe_basic.ErrBkConnectBackend
+	case bfe_http.WriteRequestError:
+		proxyState.ErrBkWriteRequest.Inc(1)
+		return bfe_basic.ErrBkWriteRequest
+	case bfe_http.ReadRespHeaderError:
+		proxyState.ErrBkReadRespHeader.Inc(1)
+		return bfe_basic.ErrBkReadRespHeader
+	case bfe_http.RespHeaderTimeoutError:
+		proxyState.ErrBkRespHeaderTimeout.Inc(1)
+		return bfe_basic.ErrBkRespHeaderTimeout
+	}
+
+	proxyState.ErrBkTransportBroken.Inc(1)
+	return bfe_basic.ErrBkTransportBroken
+}
+
+// newOutRequest creates request to be sent to backend.
+func (p *ReverseProxy) newOutRequest(req *bfe_basic.Request) *bfe_http.Request {
+	hreq := req.HttpRequest
+
+	outreq := new(bfe_http.Request)
+	*outreq = *hreq
+
+	u := *hreq.URL
+	u.Scheme = "http"
+	outreq.URL = &u
+
+	outreq.Proto = "HTTP/1.1"
+	outreq.ProtoMajor = 1
+	outreq.ProtoMinor = 1
+
+	outreq.Header = make(bfe_http.Header, len(hreq.Header))
+	for k, vv := range hreq.Header {
+		outreq.Header[k] = append([]string(nil), vv...)
+	}
+	removeHopHeaders(outreq.Header)
+
+	if req.ClientAddr != nil {
+		clientIP := req.ClientAddr.IP.String()
+		if prior, ok := outreq.Header[bfe_basic.HeaderForwardedFor]; ok {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		outreq.Header.Set(bfe_basic.HeaderForwardedFor, clientIP)
+	}
+
+	return outreq
+}
+
+// removeHopHeaders removes hop-by-hop headers, including those listed in
+// Connection header.
+func removeHopHeaders(h bfe_http.Header) {
+	for _, f := range h["Connection"] {
+		for _, sf := range strings.Split(f, ",") {
+			if sf = strings.TrimSpace(sf); sf != "" {
+				h.Del(sf)
+			}
+		}
+	}
+
+	for _, header := range hopHeaders {
+		h.Del(header)
+	}
+}
+
+func newRespFromStatus(hreq *bfe_http.Request, code int) *bfe_http.Response {
+	body := fmt.Sprintf("%d %s\n", code, bfe_http.StatusText(code))
+
+	res := &bfe_http.Response{
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(bfe_http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       hreq,
+	}
+	res.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	return res
+}
+
+func newRedirectResp(req *bfe_basic.Request) *bfe_http.Response {
+	code := req.Redirect.Code
+	if code == 0 {
+		code = bfe_http.StatusFound
+	}
+
+	res := newRespFromStatus(req.HttpRequest, code)
+	res.Header.Set("Location", req.Redirect.Url)
+
+	return res
+}
+
+func chunkedEncoding(te []string) bool {
+	return len(te) > 0 && te[0] == "chunked"
+}
+
+// hasToken reports whether token appears in comma separated value v.
+func hasToken(v, token string) bool {
+	for _, t := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package bfe_server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SignalHandler func(s os.Signal)
+
+type SignalTable struct {
+	shs map[os.Signal]SignalHandler
+}
+
+func NewSignalTable() *SignalTable {
+	return &SignalTable{
+		shs: make(map[os.Signal]SignalHandler),
+	}
+}
+
+func (table *SignalTable) Register(s os.Signal, handler SignalHandler) {
+	table.shs[s] = handler
+}
+
+func (table *SignalTable) handle(sig os.Signal) {
+	if handler, ok := table.shs[sig]; ok {
+		handler(sig)
+	}
+}
+
+// StartSignalHandle starts a goroutine to handle registered signals.
+func (table *SignalTable) StartSignalHandle() {
+	c := make(chan os.Signal, 1)
+	for sig := range table.shs {
+		signal.Notify(c, sig)
+	}
+
+	go func() {
+		for sig := range c {
+			logrus.Infof("signal received: %s", sig)
+			table.handle(sig)
+		}
+	}()
+}
+
+func ignoreHandler(s os.Signal) {}
+
+func termHandler(s os.Signal) {
+	os.Exit(0)
+}
+
+func (srv *BfeServer) InitSignalTable() {
+	table := NewSignalTable()
+
+	table.Register(syscall.SIGHUP, ignoreHandler)
+	table.Register(syscall.SIGPIPE, ignoreHandler)
+	table.Register(syscall.SIGTERM, termHandler)
+	table.Register(syscall.SIGQUIT, srv.gracefulShutdownHandler)
+
+	table.StartSignalHandle()
+}
+
+func (srv *BfeServer) gracefulShutdownHandler(s os.Signal) {
+	timeout := time.Duration(srv.Config.Server.GracefulShutdownTimeout) * time.Second
+	logrus.Infof("gracefulShutdownHandler(): graceful shutdown begin, timeout %s", timeout)
+
+	srv.ShutdownListeners(timeout)
+
+	logrus.Info("gracefulShutdownHandler(): graceful shutdown end")
+	os.Exit(0)
+}
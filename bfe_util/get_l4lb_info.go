@@ -15,25 +15,47 @@ const (
 
 var (
 	ErrAddressFormat = errors.New("address format error")
+	ErrNoTtmInfo     = errors.New("no ttm info")
 )
 
+// GetVipPort returns the virtual address the client connected to. It falls
+// back to the local address if the conn carries no l4lb info.
 func GetVipPort(conn net.Conn) (net.IP, int, error) {
-	return net.IP{}, 0, nil
+	var addr net.Addr
+
+	if f, ok := conn.(AddrFetcher); ok {
+		addr = f.VirtualAddr()
+	}
+	if addr == nil {
+		addr = conn.LocalAddr()
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil, 0, ErrAddressFormat
+	}
+
+	return tcpAddr.IP, tcpAddr.Port, nil
 }
 
 func GetVip(conn net.Conn) net.IP {
-	return net.IP{}
+	vip, _, err := GetVipPort(conn)
+	if err != nil {
+		return nil
+	}
+
+	return vip
 }
 
 func getVipPortViaBGW(conn net.Conn) (net.IP, int, error) {
-	return net.IP{}, 0, nil
+	return nil, 0, ErrNoTtmInfo
 }
 func getCipPortViaBGW(conn net.Conn) (net.IP, int, error) {
-	return net.IP{}, 0, nil
+	return nil, 0, ErrNoTtmInfo
 }
 
 func getCipPortBGW(conn net.Conn) (net.IP, int, error) {
-	return net.IP{}, 0, nil
+	return nil, 0, ErrNoTtmInfo
 }
 
 func parseSocketAddr(rawAddr []byte) (net.IP, int, error) {
@@ -129,7 +151,7 @@ func (c *BgwConn) checkTtmInfo() {
 func (c *BgwConn) initSrcAddr() {
 	cip, cport, err := getCipPortViaBGW(c)
 	if err != nil {
-		logrus.Debug("BgwConn getCipPortViaBGW failed, error: %s", err)
+		logrus.Debugf("BgwConn getCipPortViaBGW failed, error: %s", err)
 		return
 	}
 
@@ -142,7 +164,7 @@ func (c *BgwConn) initSrcAddr() {
 func (c *BgwConn) initDstAddr() {
 	vip, vport, err := getVipPortViaBGW(c)
 	if err != nil {
-		logrus.Debug("BgwConn getVipPortViaBGW failed, error: %s", err)
+		logrus.Debugf("BgwConn getVipPortViaBGW failed, error: %s", err)
 		return
 	}
 
@@ -1,7 +1,7 @@
 package bfe_util
 
 import (
-	"github.com/crud-bird/bfe/bfe_tls"
+	"fmt"
 	"net"
 )
 
@@ -13,7 +13,7 @@ type AddrFetcher interface {
 	RemoteAddr() net.Addr
 	LocalAddr() net.Addr
 	VirtualAddr() net.Addr
-	BalanceAddr() net.Addr
+	BalancerAddr() net.Addr
 }
 
 type ConnFetcher interface {
@@ -21,9 +21,12 @@ type ConnFetcher interface {
 }
 
 func GetTCPConn(conn net.Conn) (*net.TCPConn, error) {
-	switch conn.(type) {
-	case *bfe_tls.Conn:
-		c := (*bfe_tls.Conn).GetNetConn()
-		return c.(*net.TCPConn), nil
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		return c, nil
+	case ConnFetcher:
+		return GetTCPConn(c.GetNetConn())
 	}
+
+	return nil, fmt.Errorf("GetTCPConn(): conn type not support %T", conn)
 }
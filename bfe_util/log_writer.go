@@ -0,0 +1,142 @@
+package bfe_util
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeRotateWriter writes log to file, and rotates the file by time.
+// Rotated files are named as "<name>.<time suffix>".
+type TimeRotateWriter struct {
+	lock sync.Mutex
+
+	fileName    string
+	interval    time.Duration
+	suffix      string
+	backupCount int
+
+	file       *os.File
+	rolloverAt time.Time
+}
+
+// NewTimeRotateWriter creates writer for logDir/name. when should be "M"(minute),
+// "H"(hour) or "D"(day); backupCount is the number of rotated files kept.
+func NewTimeRotateWriter(logDir string, name string, when string, backupCount int) (*TimeRotateWriter, error) {
+	w := &TimeRotateWriter{
+		fileName:    path.Join(logDir, name),
+		backupCount: backupCount,
+	}
+
+	switch strings.ToUpper(when) {
+	case "M":
+		w.interval = time.Minute
+		w.suffix = "200601021504"
+	case "H":
+		w.interval = time.Hour
+		w.suffix = "2006010215"
+	case "D":
+		w.interval = 24 * time.Hour
+		w.suffix = "20060102"
+	default:
+		return nil, fmt.Errorf("invalid rotate interval[%s]", when)
+	}
+
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := w.openFile(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *TimeRotateWriter) openFile() error {
+	file, err := w.createFile()
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.rolloverAt = w.nextRollover(time.Now())
+
+	return nil
+}
+
+func (w *TimeRotateWriter) createFile() (*os.File, error) {
+	return os.OpenFile(w.fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+func (w *TimeRotateWriter) nextRollover(now time.Time) time.Time {
+	if w.interval == 24*time.Hour {
+		year, month, day := now.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	}
+
+	return now.Truncate(w.interval).Add(w.interval)
+}
+
+func (w *TimeRotateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if now := time.Now(); !now.Before(w.rolloverAt) {
+		if err := w.rotate(now); err != nil {
+			fmt.Fprintf(os.Stderr, "TimeRotateWriter.rotate(): %s\n", err)
+		}
+	}
+
+	return w.file.Write(p)
+}
+
+func (w *TimeRotateWriter) rotate(now time.Time) error {
+	backupName := w.fileName + "." + w.rolloverAt.Add(-w.interval).Format(w.suffix)
+
+	// on failure, keep writing to current file and retry at next rollover
+	w.rolloverAt = w.nextRollover(now)
+
+	if err := os.Rename(w.fileName, backupName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := w.createFile()
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+
+	w.removeExpired()
+
+	return nil
+}
+
+func (w *TimeRotateWriter) removeExpired() {
+	if w.backupCount <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(w.fileName + ".*")
+	if err != nil || len(backups) <= w.backupCount {
+		return
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-w.backupCount] {
+		os.Remove(backup)
+	}
+}
+
+func (w *TimeRotateWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.file.Close()
+}